@@ -0,0 +1,85 @@
+package rn2483
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BreakSender is implemented by serial devices capable of sending a break condition, as required for auto-baud
+type BreakSender interface {
+	SendBreak(duration time.Duration) error
+}
+
+var (
+	ErrBreakUnsupported = errors.New("serial device does not support sending a break")
+	ErrAutoBaudFailed   = errors.New("device did not respond to auto-baud")
+)
+
+var (
+	// AutoBaudBreakDuration is how long the break condition is held for when performing auto-baud
+	AutoBaudBreakDuration = 20 * time.Millisecond
+	// AutoBaudProbeLines is how many lines of output will be examined for a response to the version query sent after
+	// auto-baud, before giving up
+	AutoBaudProbeLines = 4
+)
+
+const autoBaudSyncCharacter = 0x55
+
+// AutoBaud resynchronises the device's UART with the host's baud rate by sending a break condition followed by 0x55,
+// then confirms the device is responsive by querying its version. The transport must implement BreakSender.
+func (d *Device) AutoBaud() (*FirmwareVersion, error) {
+	if err := d.sendAutoBaudSequence(); err != nil {
+		return nil, err
+	}
+
+	// anything already buffered was received before resynchronising, so is likely garbage
+	if err := d.discardBuffered(); err != nil {
+		return nil, err
+	}
+
+	if err := d.Sendf("sys get ver"); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < AutoBaudProbeLines; i++ {
+		line, err := d.ReadResponse()
+		if err != nil {
+			return nil, err
+		}
+
+		if version, err := ParseFirmwareVersion(line); err == nil {
+			d.firmware = version
+			return version, nil
+		}
+	}
+
+	return nil, ErrAutoBaudFailed
+}
+
+// sendAutoBaudSequence sends the break condition followed by 0x55 that triggers auto-baud detection on the device
+func (d *Device) sendAutoBaudSequence() error {
+	if err := d.serial.SendBreak(AutoBaudBreakDuration); err != nil {
+		if errors.Is(err, ErrBreakUnsupported) {
+			return err
+		}
+		return fmt.Errorf("error sending break: %w", err)
+	}
+
+	if _, err := d.serial.Write([]byte{autoBaudSyncCharacter}); err != nil {
+		return fmt.Errorf("error writing to serial device: %w", err)
+	}
+
+	return nil
+}
+
+// isGarbled determines whether a response contains characters the device would never send, which is typical of the
+// host and device disagreeing on baud rate
+func isGarbled(line string) bool {
+	for i := 0; i < len(line); i++ {
+		if line[i] < 0x20 || line[i] > 0x7E {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package rn2483_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+func TestAutoBaud(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.Group("on demand", func() {
+		o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+			ctx := prepareTestContext(t)
+			ctx.fake.Sys.BaudMismatch = true
+			return t, ctx
+		})
+
+		o.Spec("garbled responses are reported as unknown", func(t *testing.T, ctx *testContext) {
+			Expect(t, ctx.device.SetRadioPower(5)).To(testutils.MatchError(rn2483.ErrUnknown))
+		})
+
+		o.Spec("auto-baud resynchronises the device", func(t *testing.T, ctx *testContext) {
+			version, err := ctx.device.AutoBaud()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, version.IsKnownSKU()).To(BeTrue())
+			Expect(t, ctx.fake.Sys.BaudMismatch).To(BeFalse())
+
+			Expect(t, ctx.device.SetRadioPower(5)).To(Not(HaveOccurred()))
+		})
+
+		o.Spec("auto-baud requires a serial device that can send a break", func(t *testing.T, ctx *testContext) {
+			d := rn2483.New(rn2483.Config{
+				Serial: struct{ io.ReadWriteCloser }{ctx.fake},
+			})
+
+			_, err := d.AutoBaud()
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrBreakUnsupported))
+		})
+	})
+
+	o.Group("automatically on garbled responses", func() {
+		o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+			ctx := prepareTestContext(t, func(cfg *rn2483.Config) {
+				cfg.AutoBaudOnGarbage = true
+			})
+			ctx.fake.Sys.BaudMismatch = true
+			return t, ctx
+		})
+
+		o.Spec("commands succeed after resynchronising", func(t *testing.T, ctx *testContext) {
+			Expect(t, ctx.device.SetRadioPower(5)).To(Not(HaveOccurred()))
+			Expect(t, ctx.fake.Sys.BaudMismatch).To(BeFalse())
+
+			power, err := ctx.device.GetRadioPower()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, power).To(Equal(5))
+		})
+	})
+}
@@ -0,0 +1,310 @@
+// Package bootloader communicates with the serial bootloader that a device runs once its firmware has been erased
+// (see rn2483.Device.EraseFirmware), allowing new firmware to be written.
+//
+// The protocol is a binary one: each command is a sync byte (0x55) followed by a fixed size header, and for writes,
+// the data to write. Every response begins with an echo of the command's header, followed by any data read or a status
+// byte.
+// As the application firmware only acts upon complete lines of text, sending a bootloader command to a device that is
+// running its firmware elicits no response, which allows the presence of the bootloader to be detected.
+package bootloader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/omaskery/rn2483"
+)
+
+const (
+	// DefaultTimeout is how long to wait for a response when no timeout is configured
+	DefaultTimeout = time.Second
+	// DefaultDetectAttempts is how many times to try detecting the bootloader when not configured
+	DefaultDetectAttempts = 3
+)
+
+var (
+	// ErrTimeout is returned when the bootloader does not respond in time
+	ErrTimeout = errors.New("timed out waiting for bootloader response")
+	// ErrNoBootloader is returned when the bootloader cannot be detected
+	ErrNoBootloader = errors.New("bootloader not detected")
+	// ErrUnexpectedResponse is returned when a response does not echo the command it should be for
+	ErrUnexpectedResponse = errors.New("unexpected bootloader response")
+	// ErrCommandFailed is returned when the bootloader reports that a command failed
+	ErrCommandFailed = errors.New("bootloader command failed")
+)
+
+// Config configures a Client
+type Config struct {
+	Logger logr.Logger
+	// Serial is the serial device connected to the device, which is likely also in use by a rn2483.Device. The
+	// rn2483.Device must not be used while the bootloader is in use.
+	Serial io.ReadWriter
+	// Clock is used for response timeouts, defaulting to the real clock
+	Clock clockwork.Clock
+	// Timeout is how long to wait for each response, defaulting to DefaultTimeout
+	Timeout time.Duration
+	// DetectAttempts is how many commands Detect sends before concluding there is no bootloader, defaulting to
+	// DefaultDetectAttempts
+	DetectAttempts int
+}
+
+type readResult struct {
+	data []byte
+	err  error
+}
+
+// Client sends commands to a device's bootloader
+type Client struct {
+	logger         logr.Logger
+	serial         io.ReadWriter
+	clock          clockwork.Clock
+	timeout        time.Duration
+	detectAttempts int
+
+	// pending is the result of a read that was still in progress when a response timed out, which is collected before
+	// reading again so that two reads are never in progress at once
+	pending chan readResult
+	// received holds bytes read beyond the end of the last response
+	received []byte
+	// info is the bootloader's most recently reported version information
+	info *Info
+}
+
+// New creates a Client to communicate with a device's bootloader
+func New(cfg Config) *Client {
+	logger := logr.Discard()
+	if cfg.Logger != nil {
+		logger = cfg.Logger
+	}
+
+	clock := cfg.Clock
+	if clock == nil {
+		clock = clockwork.NewRealClock()
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	detectAttempts := cfg.DetectAttempts
+	if detectAttempts == 0 {
+		detectAttempts = DefaultDetectAttempts
+	}
+
+	return &Client{
+		logger:         logger,
+		serial:         cfg.Serial,
+		clock:          clock,
+		timeout:        timeout,
+		detectAttempts: detectAttempts,
+	}
+}
+
+// Enter erases the device's firmware, as described by rn2483.Device.EraseFirmware, then detects the bootloader that
+// the device starts in its place. cfg.Serial must be the serial device used by d, which must not be used again until
+// new firmware has been written and the device reset.
+func Enter(d *rn2483.Device, opts rn2483.EraseFirmwareOptions, cfg Config) (*Client, *Info, error) {
+	if err := d.EraseFirmware(opts); err != nil {
+		return nil, nil, err
+	}
+
+	c := New(cfg)
+	info, err := c.Detect()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, info, nil
+}
+
+// Detect determines whether the bootloader is running by requesting its version, returning ErrNoBootloader if it does
+// not respond as expected. Unless Config.Serial supports read deadlines (see rn2483.ReadDeadliner), a read of it is
+// left outstanding when the bootloader is not detected, which will consume whatever the device sends next, so the
+// serial device should be reopened before being used for anything else.
+func (c *Client) Detect() (*Info, error) {
+	var lastErr error
+	for attempt := 1; attempt <= c.detectAttempts; attempt++ {
+		info, err := c.ReadVersion()
+		if err == nil {
+			c.logger.Info("bootloader detected", "version", info.VersionString(), "device-id", info.DeviceID)
+			return info, nil
+		}
+		c.logger.V(1).Info("bootloader did not respond", "attempt", attempt, "err", err)
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("%w: %v", ErrNoBootloader, lastErr)
+}
+
+// ReadVersion requests the bootloader's version and the layout of the device's flash
+func (c *Client) ReadVersion() (*Info, error) {
+	data, err := c.execute(Header{Command: CommandReadVersion}, nil, InfoLength)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := DecodeInfo(data)
+	if err != nil {
+		return nil, err
+	}
+
+	c.info = &info
+	return &info, nil
+}
+
+// ReadFlash reads length bytes of flash starting from address, length must be no more than Info.MaxPacketSize
+func (c *Client) ReadFlash(address uint32, length uint16) ([]byte, error) {
+	return c.execute(Header{Command: CommandReadFlash, Address: address, Length: length}, nil, int(length))
+}
+
+// WriteFlash writes data to flash starting from address, which must first have been erased. Both the address and the
+// length of data must be multiples of Info.WriteLatchSize, and the length no more than Info.MaxPacketSize.
+func (c *Client) WriteFlash(address uint32, data []byte) error {
+	return c.executeWithStatus(Header{Command: CommandWriteFlash, Address: address, Length: uint16(len(data))}, data)
+}
+
+// EraseFlash erases rows of flash starting from the row at address, which must be a multiple of Info.EraseRowSize
+func (c *Client) EraseFlash(address uint32, rows uint16) error {
+	return c.executeWithStatus(Header{Command: CommandEraseFlash, Address: address, Length: rows}, nil)
+}
+
+// CalculateChecksum has the bootloader calculate the checksum of length bytes of flash starting from address, as
+// calculated locally by Checksum
+func (c *Client) CalculateChecksum(address uint32, length uint16) (uint16, error) {
+	response, err := c.execute(Header{Command: CommandCalculateChecksum, Address: address, Length: length}, nil, 2)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint16(response), nil
+}
+
+// Reset restarts the device, which then runs its application firmware if any has been written, or otherwise remains in
+// the bootloader. Once running, the firmware writes its version information as it would after sys reset.
+func (c *Client) Reset() error {
+	return c.executeWithStatus(Header{Command: CommandReset}, nil)
+}
+
+// executeWithStatus executes a command whose response is a status byte, returning ErrCommandFailed if it is not success
+func (c *Client) executeWithStatus(header Header, data []byte) error {
+	response, err := c.execute(header, data, 1)
+	if err != nil {
+		return err
+	}
+
+	if status := Status(response[0]); status != StatusSuccess {
+		return fmt.Errorf("%w: %s at %08X: %s", ErrCommandFailed, header.Command, header.Address, status)
+	}
+
+	return nil
+}
+
+// execute sends a command and reads its response, checking it echoes the command's header and returning the
+// responseLength bytes that follow it
+func (c *Client) execute(header Header, data []byte, responseLength int) ([]byte, error) {
+	header.Unlocked = header.Command.modifiesFlash()
+	encoded := header.Encode()
+
+	c.logger.V(1).Info("sending bootloader command", "command", header.Command, "address", header.Address,
+		"length", header.Length)
+
+	command := append([]byte{SyncByte}, encoded...)
+	command = append(command, data...)
+	if _, err := c.serial.Write(command); err != nil {
+		return nil, fmt.Errorf("error sending %s command: %w", header.Command, err)
+	}
+
+	response, err := c.read(HeaderLength + responseLength)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s response: %w", header.Command, err)
+	}
+
+	if !bytes.Equal(response[:HeaderLength], encoded) {
+		return nil, fmt.Errorf("%w: expected %X, got %X", ErrUnexpectedResponse, encoded, response[:HeaderLength])
+	}
+
+	return response[HeaderLength:], nil
+}
+
+// read reads exactly n bytes, returning ErrTimeout if they are not all received within the client's timeout. Unless
+// the serial device supports read deadlines, a read that times out is left in progress, and the data it eventually
+// reads is returned by the next call.
+func (c *Client) read(n int) ([]byte, error) {
+	if c.pending == nil {
+		if data, ok, err := c.readWithDeadline(n); ok {
+			return data, err
+		}
+	}
+
+	deadline := c.clock.After(c.timeout)
+
+	buffer := c.received
+	c.received = nil
+	for len(buffer) < n {
+		if c.pending == nil {
+			c.pending = make(chan readResult, 1)
+			go func(pending chan<- readResult, size int) {
+				data := make([]byte, size)
+				count, err := c.serial.Read(data)
+				pending <- readResult{data: data[:count], err: err}
+			}(c.pending, n-len(buffer))
+		}
+
+		select {
+		case result := <-c.pending:
+			c.pending = nil
+			buffer = append(buffer, result.data...)
+			if result.err != nil {
+				return nil, result.err
+			}
+		case <-deadline:
+			return nil, fmt.Errorf("%w: received %d of %d bytes", ErrTimeout, len(buffer), n)
+		}
+	}
+
+	// a read left outstanding by an earlier timeout may have returned more than is needed now
+	c.received = buffer[n:]
+	return buffer[:n], nil
+}
+
+// readWithDeadline reads exactly n bytes using a read deadline, so that no read is left in progress if it times out,
+// reporting false if the serial device does not support read deadlines
+func (c *Client) readWithDeadline(n int) ([]byte, bool, error) {
+	deadliner, ok := c.serial.(rn2483.ReadDeadliner)
+	if !ok {
+		return nil, false, nil
+	}
+	if err := deadliner.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, false, nil
+	}
+	defer func() {
+		_ = deadliner.SetReadDeadline(time.Time{})
+	}()
+
+	buffer := c.received
+	c.received = nil
+	for len(buffer) < n {
+		data := make([]byte, n-len(buffer))
+		count, err := c.serial.Read(data)
+		buffer = append(buffer, data[:count]...)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, true, fmt.Errorf("%w: received %d of %d bytes", ErrTimeout, len(buffer), n)
+		}
+		if err != nil {
+			return nil, true, err
+		}
+	}
+
+	// bytes left over by an earlier read may be more than is needed now
+	c.received = buffer[n:]
+	return buffer[:n], true, nil
+}
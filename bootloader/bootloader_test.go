@@ -0,0 +1,248 @@
+package bootloader_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/bootloader"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/intelhex"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+// readTracker is a network connection that records whether a read is in progress
+type readTracker struct {
+	net.Conn
+	reading int32
+}
+
+func (r *readTracker) Read(p []byte) (int, error) {
+	atomic.AddInt32(&r.reading, 1)
+	defer atomic.AddInt32(&r.reading, -1)
+	return r.Conn.Read(p)
+}
+
+type testContext struct {
+	logger logr.Logger
+	fake   *fake.Device
+	device *rn2483.Device
+}
+
+func (ctx *testContext) config() bootloader.Config {
+	return bootloader.Config{
+		Logger:  ctx.logger.WithName("bootloader"),
+		Serial:  ctx.fake,
+		Timeout: 50 * time.Millisecond,
+	}
+}
+
+func (ctx *testContext) bootloaderState() fake.BootloaderState {
+	var state fake.BootloaderState
+	ctx.fake.Update(func(d *fake.Device) {
+		state = d.Bootloader
+	})
+	return state
+}
+
+var confirmed = rn2483.EraseFirmwareOptions{
+	Confirmation: rn2483.EraseFirmwareConfirmation,
+	SKU:          rn2483.DeviceRN2483,
+}
+
+func TestBootloader(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		logger := testutils.CreateTestLogger(t)
+
+		f, d := fake.NewFakeDevice(fake.Config{
+			Logger: logger.WithName("fake-device"),
+		})
+		t.Cleanup(func() {
+			if err := d.Close(); err != nil {
+				logger.Error(err, "error cleaning up fake device")
+			}
+		})
+
+		return t, &testContext{
+			logger: logger,
+			fake:   f,
+			device: d,
+		}
+	})
+
+	o.Spec("can enter the bootloader", func(t *testing.T, ctx *testContext) {
+		_, info, err := bootloader.Enter(ctx.device, confirmed, ctx.config())
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		state := ctx.bootloaderState()
+		Expect(t, state.Active).To(BeTrue())
+		Expect(t, state.ApplicationPresent()).To(BeFalse())
+		Expect(t, *info).To(Equal(state.Info))
+		Expect(t, info.VersionString()).To(Equal("1.0"))
+	})
+
+	o.Spec("is not entered unless confirmed", func(t *testing.T, ctx *testContext) {
+		_, _, err := bootloader.Enter(ctx.device, rn2483.EraseFirmwareOptions{SKU: rn2483.DeviceRN2483}, ctx.config())
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrEraseNotConfirmed))
+		Expect(t, ctx.bootloaderState().Active).To(BeFalse())
+	})
+
+	o.Spec("is not entered for the wrong SKU", func(t *testing.T, ctx *testContext) {
+		opts := confirmed
+		opts.SKU = rn2483.DeviceRN2903
+
+		_, _, err := bootloader.Enter(ctx.device, opts, ctx.config())
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrSKUMismatch))
+		Expect(t, ctx.bootloaderState().Active).To(BeFalse())
+	})
+
+	o.Spec("is not detected while the firmware is running", func(t *testing.T, ctx *testContext) {
+		_, err := bootloader.New(ctx.config()).Detect()
+		Expect(t, err).To(testutils.MatchError(bootloader.ErrNoBootloader))
+	})
+
+	o.Spec("leaves no read in progress when not detected, given read deadlines", func(t *testing.T, ctx *testContext) {
+		client, server := net.Pipe()
+		go func() {
+			_, _ = io.Copy(ctx.fake, server)
+		}()
+		go func() {
+			_, _ = io.Copy(server, ctx.fake)
+		}()
+		defer server.Close()
+
+		conn := &readTracker{Conn: client}
+		cfg := ctx.config()
+		cfg.Serial = conn
+		_, err := bootloader.New(cfg).Detect()
+		Expect(t, err).To(testutils.MatchError(bootloader.ErrNoBootloader))
+		Expect(t, atomic.LoadInt32(&conn.reading)).To(Equal(int32(0)))
+	})
+
+	o.Spec("remains in the bootloader after reset without firmware", func(t *testing.T, ctx *testContext) {
+		client, _, err := bootloader.Enter(ctx.device, confirmed, ctx.config())
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		Expect(t, client.Reset()).To(Not(HaveOccurred()))
+		Expect(t, ctx.bootloaderState().Active).To(BeTrue())
+
+		_, err = client.Detect()
+		Expect(t, err).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("runs the firmware after reset once written", func(t *testing.T, ctx *testContext) {
+		client, _, err := bootloader.Enter(ctx.device, confirmed, ctx.config())
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		ctx.fake.Update(func(d *fake.Device) {
+			d.Bootloader.Flash[d.Bootloader.ApplicationStart] = 0x00
+		})
+		Expect(t, client.Reset()).To(Not(HaveOccurred()))
+
+		banner, err := bufio.NewReader(ctx.fake).ReadString('\n')
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, banner).To(Equal("RN2483 1.0.4 Mar 23 1991 13:37:00\r\n"))
+		Expect(t, ctx.bootloaderState().Active).To(BeFalse())
+
+		version, err := ctx.device.GetVersion()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, version.SKU).To(Equal(rn2483.DeviceRN2483))
+	})
+	o.Group("firmware update", func() {
+		firmware := []intelhex.Segment{
+			{Address: 0x0800, Data: pattern(200, 1)},
+			{Address: 0x1010, Data: pattern(10, 7)},
+		}
+
+		o.BeforeEach(func(t *testing.T, ctx *testContext) (*testing.T, *testContext, *bootloader.Client) {
+			client, _, err := bootloader.Enter(ctx.device, confirmed, ctx.config())
+			Expect(t, err).To(Not(HaveOccurred()))
+			return t, ctx, client
+		})
+
+		o.Spec("writes firmware, application start last", func(t *testing.T, ctx *testContext, client *bootloader.Client) {
+			var progress []bootloader.Progress
+			stats, err := client.Update(firmware, bootloader.UpdateOptions{
+				Progress: func(p bootloader.Progress) {
+					progress = append(progress, p)
+				},
+			})
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, stats).To(Equal(bootloader.UpdateStats{Written: 5}))
+
+			Expect(t, progress).To(HaveLen(5))
+			Expect(t, progress[0]).To(Equal(bootloader.Progress{Row: 1, Rows: 5, Address: 0x0840}))
+			Expect(t, progress[4]).To(Equal(bootloader.Progress{Row: 5, Rows: 5, Address: 0x0800}))
+
+			state := ctx.bootloaderState()
+			Expect(t, state.Flash[0x0800:0x08C8]).To(Equal(firmware[0].Data))
+			Expect(t, state.Flash[0x1000:0x1010]).To(Equal(bytes.Repeat([]byte{0xFF}, 0x10)))
+			Expect(t, state.Flash[0x1010:0x101A]).To(Equal(firmware[1].Data))
+			Expect(t, client.Verify(firmware)).To(Not(HaveOccurred()))
+		})
+
+		o.Spec("resumes interrupted updates", func(t *testing.T, ctx *testContext, client *bootloader.Client) {
+			_, err := client.Update(firmware[1:], bootloader.UpdateOptions{})
+			Expect(t, err).To(Not(HaveOccurred()))
+
+			stats, err := client.Update(firmware, bootloader.UpdateOptions{Resume: true})
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, stats).To(Equal(bootloader.UpdateStats{Written: 4, Skipped: 1}))
+			Expect(t, client.Verify(firmware)).To(Not(HaveOccurred()))
+		})
+
+		o.Spec("detects flash that does not match", func(t *testing.T, ctx *testContext, client *bootloader.Client) {
+			_, err := client.Update(firmware, bootloader.UpdateOptions{})
+			Expect(t, err).To(Not(HaveOccurred()))
+
+			ctx.fake.Update(func(d *fake.Device) {
+				d.Bootloader.Flash[0x1012] = 0x00
+			})
+			err = client.Verify(firmware)
+			Expect(t, err).To(testutils.MatchError(bootloader.ErrVerifyFailed))
+		})
+
+		o.Spec("refuses to overwrite the bootloader", func(t *testing.T, ctx *testContext, client *bootloader.Client) {
+			_, err := client.Update([]intelhex.Segment{{Address: 0x07C0, Data: pattern(64, 0)}}, bootloader.UpdateOptions{})
+			Expect(t, err).To(testutils.MatchError(bootloader.ErrOutOfBounds))
+
+			err = client.WriteFlash(0x07C0, pattern(64, 0))
+			Expect(t, err).To(testutils.MatchError(bootloader.ErrCommandFailed))
+		})
+
+		o.Spec("runs the new firmware after reset", func(t *testing.T, ctx *testContext, client *bootloader.Client) {
+			_, err := client.Update(firmware, bootloader.UpdateOptions{})
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, client.Reset()).To(Not(HaveOccurred()))
+
+			banner, err := bufio.NewReader(ctx.fake).ReadString('\n')
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, banner).To(Equal("RN2483 1.0.4 Mar 23 1991 13:37:00\r\n"))
+		})
+	})
+}
+
+// pattern generates length bytes of recognisable, non-erased, data
+func pattern(length int, seed byte) []byte {
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = byte(i)*3 + seed
+		if data[i] == 0xFF {
+			data[i] = 0
+		}
+	}
+	return data
+}
@@ -0,0 +1,178 @@
+package bootloader
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Command identifies an operation performed by the bootloader
+type Command byte
+
+const (
+	CommandReadVersion       Command = 0x00
+	CommandReadFlash         Command = 0x01
+	CommandWriteFlash        Command = 0x02
+	CommandEraseFlash        Command = 0x03
+	CommandCalculateChecksum Command = 0x08
+	CommandReset             Command = 0x09
+)
+
+func (c Command) String() string {
+	switch c {
+	case CommandReadVersion:
+		return "read-version"
+	case CommandReadFlash:
+		return "read-flash"
+	case CommandWriteFlash:
+		return "write-flash"
+	case CommandEraseFlash:
+		return "erase-flash"
+	case CommandCalculateChecksum:
+		return "calculate-checksum"
+	case CommandReset:
+		return "reset"
+	default:
+		return fmt.Sprintf("Command(0x%02X)", byte(c))
+	}
+}
+
+// modifiesFlash determines whether the command must be unlocked before the bootloader will perform it
+func (c Command) modifiesFlash() bool {
+	return c == CommandWriteFlash || c == CommandEraseFlash
+}
+
+// Status is the result reported by the bootloader for commands that do not return data
+type Status byte
+
+const (
+	StatusSuccess      Status = 0x01
+	StatusUnsupported  Status = 0xFF
+	StatusAddressError Status = 0xFE
+	StatusLocked       Status = 0xFD
+	StatusLengthError  Status = 0xFC
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusSuccess:
+		return "success"
+	case StatusUnsupported:
+		return "unsupported command"
+	case StatusAddressError:
+		return "address error"
+	case StatusLocked:
+		return "not unlocked"
+	case StatusLengthError:
+		return "invalid length"
+	default:
+		return fmt.Sprintf("Status(0x%02X)", byte(s))
+	}
+}
+
+const (
+	// SyncByte precedes every command, allowing the bootloader to detect the host's baud rate
+	SyncByte = 0x55
+	// HeaderLength is the size of the header that begins every command, and is echoed at the start of every response
+	HeaderLength = 9
+	// InfoLength is the size of the data returned by CommandReadVersion
+	InfoLength = 16
+)
+
+// unlockSequence must be present in the header of commands that modify flash
+var unlockSequence = [2]byte{0x55, 0xAA}
+
+var (
+	// ErrMalformed is returned when a header or response cannot be decoded
+	ErrMalformed = errors.New("malformed bootloader message")
+)
+
+// Header begins every command sent to the bootloader, and is echoed back at the start of every response. Encoded, it
+// is laid out as [command][length (2 bytes)][unlock (2 bytes)][address (4 bytes)] with multi-byte fields little-endian.
+type Header struct {
+	Command Command
+	// Length is the number of bytes of data read, written, erased (in rows) or checksummed by the command
+	Length uint16
+	// Unlocked is set for commands that modify flash, which the bootloader refuses to perform otherwise
+	Unlocked bool
+	Address  uint32
+}
+
+// Encode returns the header's wire representation
+func (h Header) Encode() []byte {
+	encoded := make([]byte, HeaderLength)
+	encoded[0] = byte(h.Command)
+	binary.LittleEndian.PutUint16(encoded[1:3], h.Length)
+	if h.Unlocked {
+		copy(encoded[3:5], unlockSequence[:])
+	}
+	binary.LittleEndian.PutUint32(encoded[5:9], h.Address)
+	return encoded
+}
+
+// DecodeHeader decodes a header from its wire representation
+func DecodeHeader(encoded []byte) (Header, error) {
+	if len(encoded) < HeaderLength {
+		return Header{}, fmt.Errorf("%w: header of %d bytes is too short", ErrMalformed, len(encoded))
+	}
+
+	return Header{
+		Command:  Command(encoded[0]),
+		Length:   binary.LittleEndian.Uint16(encoded[1:3]),
+		Unlocked: encoded[3] == unlockSequence[0] && encoded[4] == unlockSequence[1],
+		Address:  binary.LittleEndian.Uint32(encoded[5:9]),
+	}, nil
+}
+
+// Info describes the bootloader and the device's flash memory, as returned by CommandReadVersion
+type Info struct {
+	// Version is the bootloader's version, with the major version in the upper byte
+	Version uint16
+	// MaxPacketSize is the largest amount of data the bootloader accepts in a single command
+	MaxPacketSize uint16
+	DeviceID      uint16
+	// EraseRowSize is the number of bytes erased as a single row
+	EraseRowSize uint8
+	// WriteLatchSize is the number of bytes written to flash at once, writes should be aligned to this size
+	WriteLatchSize uint8
+}
+
+// Encode returns the info's wire representation
+func (i Info) Encode() []byte {
+	encoded := make([]byte, InfoLength)
+	binary.LittleEndian.PutUint16(encoded[0:2], i.Version)
+	binary.LittleEndian.PutUint16(encoded[2:4], i.MaxPacketSize)
+	binary.LittleEndian.PutUint16(encoded[6:8], i.DeviceID)
+	encoded[10] = i.EraseRowSize
+	encoded[11] = i.WriteLatchSize
+	return encoded
+}
+
+// DecodeInfo decodes bootloader info from its wire representation
+func DecodeInfo(encoded []byte) (Info, error) {
+	if len(encoded) < InfoLength {
+		return Info{}, fmt.Errorf("%w: info of %d bytes is too short", ErrMalformed, len(encoded))
+	}
+
+	return Info{
+		Version:        binary.LittleEndian.Uint16(encoded[0:2]),
+		MaxPacketSize:  binary.LittleEndian.Uint16(encoded[2:4]),
+		DeviceID:       binary.LittleEndian.Uint16(encoded[6:8]),
+		EraseRowSize:   encoded[10],
+		WriteLatchSize: encoded[11],
+	}, nil
+}
+
+// VersionString formats the bootloader's version for printing
+func (i Info) VersionString() string {
+	return fmt.Sprintf("%d.%d", i.Version>>8, i.Version&0xFF)
+}
+
+// Checksum calculates the checksum of data as calculated by CommandCalculateChecksum, the 16 bit sum of its bytes
+func Checksum(data []byte) uint16 {
+	var sum uint16
+	for _, b := range data {
+		sum += uint16(b)
+	}
+	return sum
+}
@@ -0,0 +1,243 @@
+package bootloader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/omaskery/rn2483/intelhex"
+)
+
+// DefaultApplicationStart is the address of the application firmware, immediately after the bootloader, used when no
+// other address is configured
+const DefaultApplicationStart = 0x0800
+
+// erasedFlash is the value of flash that has been erased, used to fill parts of rows that the firmware does not cover
+const erasedFlash = 0xFF
+
+var (
+	// ErrOutOfBounds is returned for firmware that would overwrite the bootloader
+	ErrOutOfBounds = errors.New("firmware overlaps the bootloader")
+	// ErrVerifyFailed is returned when the contents of flash do not match the firmware
+	ErrVerifyFailed = errors.New("flash does not match firmware")
+)
+
+// Progress describes how far an update has got
+type Progress struct {
+	// Row is the number of rows completed, out of Rows
+	Row  int
+	Rows int
+	// Address is the address of the row just completed
+	Address uint32
+	// Skipped is set when the row already matched the firmware, and so was not written
+	Skipped bool
+}
+
+// UpdateOptions configures how firmware is written by Update
+type UpdateOptions struct {
+	// ApplicationStart is the address of the application firmware, defaulting to DefaultApplicationStart. Firmware
+	// addressed before it is refused, to protect the bootloader.
+	ApplicationStart uint32
+	// Resume skips rows of flash that already match the firmware, allowing an interrupted update to be continued
+	// without rewriting everything
+	Resume bool
+	// Progress, if set, is called after each row is written or skipped
+	Progress func(Progress)
+}
+
+// UpdateStats describes the work done by Update
+type UpdateStats struct {
+	// Written is the number of rows erased and written
+	Written int
+	// Skipped is the number of rows that already matched the firmware
+	Skipped int
+}
+
+// Update writes firmware (such as decoded by intelhex.Decode) to flash one row at a time, erasing each row before it is
+// written and reading it back to verify it. The row containing ApplicationStart is written last, so that the device
+// stays in the bootloader if the update is interrupted, and Resume can then be used to continue it. The device must be
+// reset afterwards to run the new firmware.
+func (c *Client) Update(firmware []intelhex.Segment, opts UpdateOptions) (UpdateStats, error) {
+	var stats UpdateStats
+
+	info, err := c.flashInfo()
+	if err != nil {
+		return stats, err
+	}
+
+	applicationStart := opts.ApplicationStart
+	if applicationStart == 0 {
+		applicationStart = DefaultApplicationStart
+	}
+
+	for _, segment := range firmware {
+		if segment.Address < applicationStart {
+			return stats, fmt.Errorf("%w: firmware at %08X, application starts at %08X", ErrOutOfBounds,
+				segment.Address, applicationStart)
+		}
+	}
+
+	rowSize := uint32(info.EraseRowSize)
+	rows := firmwareRows(firmware, rowSize, applicationStart)
+	c.logger.Info("updating firmware", "rows", len(rows), "row-size", rowSize, "resume", opts.Resume)
+
+	for i, row := range rows {
+		expected := intelhex.Flatten(firmware, row, int(rowSize), erasedFlash)
+
+		skipped := false
+		if opts.Resume {
+			actual, err := c.readRange(info, row, len(expected))
+			if err != nil {
+				return stats, fmt.Errorf("error reading row %08X: %w", row, err)
+			}
+			skipped = bytes.Equal(actual, expected)
+		}
+
+		if skipped {
+			stats.Skipped++
+		} else {
+			if err := c.writeRow(info, row, expected); err != nil {
+				return stats, err
+			}
+			stats.Written++
+		}
+
+		c.logger.V(1).Info("row complete", "address", row, "skipped", skipped)
+		if opts.Progress != nil {
+			opts.Progress(Progress{
+				Row:     i + 1,
+				Rows:    len(rows),
+				Address: row,
+				Skipped: skipped,
+			})
+		}
+	}
+
+	c.logger.Info("firmware update complete", "rows-written", stats.Written, "rows-skipped", stats.Skipped)
+	return stats, nil
+}
+
+// Verify checks that flash matches the firmware, using checksums calculated by the bootloader so that the flash need
+// not be read back, returning ErrVerifyFailed if not
+func (c *Client) Verify(firmware []intelhex.Segment) error {
+	info, err := c.flashInfo()
+	if err != nil {
+		return err
+	}
+
+	chunkSize := uint32(info.MaxPacketSize)
+	for _, segment := range firmware {
+		for offset := uint32(0); offset < uint32(len(segment.Data)); offset += chunkSize {
+			end := offset + chunkSize
+			if end > uint32(len(segment.Data)) {
+				end = uint32(len(segment.Data))
+			}
+			address := segment.Address + offset
+
+			actual, err := c.CalculateChecksum(address, uint16(end-offset))
+			if err != nil {
+				return fmt.Errorf("error calculating checksum at %08X: %w", address, err)
+			}
+			if expected := Checksum(segment.Data[offset:end]); actual != expected {
+				return fmt.Errorf("%w: checksum at %08X is %04X, expected %04X", ErrVerifyFailed, address, actual,
+					expected)
+			}
+		}
+	}
+
+	return nil
+}
+
+// flashInfo returns the bootloader's description of the flash, querying it if not already known
+func (c *Client) flashInfo() (*Info, error) {
+	info := c.info
+	if info == nil {
+		var err error
+		if info, err = c.ReadVersion(); err != nil {
+			return nil, err
+		}
+	}
+
+	if info.EraseRowSize == 0 || info.WriteLatchSize == 0 || info.MaxPacketSize < uint16(info.WriteLatchSize) {
+		return nil, fmt.Errorf("%w: unusable flash layout %+v", ErrMalformed, *info)
+	}
+
+	return info, nil
+}
+
+// writeRow erases and writes a single row of flash, reading it back afterwards to verify it
+func (c *Client) writeRow(info *Info, row uint32, data []byte) error {
+	if err := c.EraseFlash(row, 1); err != nil {
+		return fmt.Errorf("error erasing row %08X: %w", row, err)
+	}
+
+	// writes must be a whole number of write latches, which fits in a single command
+	chunkSize := int(info.MaxPacketSize) - int(info.MaxPacketSize)%int(info.WriteLatchSize)
+	for offset := 0; offset < len(data); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		address := row + uint32(offset)
+		if err := c.WriteFlash(address, data[offset:end]); err != nil {
+			return fmt.Errorf("error writing %08X: %w", address, err)
+		}
+	}
+
+	actual, err := c.readRange(info, row, len(data))
+	if err != nil {
+		return fmt.Errorf("error reading back row %08X: %w", row, err)
+	}
+	if !bytes.Equal(actual, data) {
+		return fmt.Errorf("%w: row %08X", ErrVerifyFailed, row)
+	}
+
+	return nil
+}
+
+// readRange reads flash in as many commands as needed to respect the bootloader's maximum packet size
+func (c *Client) readRange(info *Info, address uint32, length int) ([]byte, error) {
+	data := make([]byte, 0, length)
+	for len(data) < length {
+		chunk := length - len(data)
+		if chunk > int(info.MaxPacketSize) {
+			chunk = int(info.MaxPacketSize)
+		}
+
+		read, err := c.ReadFlash(address+uint32(len(data)), uint16(chunk))
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, read...)
+	}
+
+	return data, nil
+}
+
+// firmwareRows lists the address of every row containing firmware, in the order they should be written: ascending,
+// except for the row containing the application's start, which is last
+func firmwareRows(firmware []intelhex.Segment, rowSize, applicationStart uint32) []uint32 {
+	unique := map[uint32]bool{}
+	for _, segment := range firmware {
+		for row := segment.Address - segment.Address%rowSize; row < segment.End(); row += rowSize {
+			unique[row] = true
+		}
+	}
+
+	startRow := applicationStart - applicationStart%rowSize
+	rows := make([]uint32, 0, len(unique))
+	for row := range unique {
+		if row != startRow {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i] < rows[j]
+	})
+	if unique[startRow] {
+		rows = append(rows, startRow)
+	}
+
+	return rows
+}
@@ -0,0 +1,108 @@
+package rn2483
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupported is returned by commands that the device's firmware does not support
+var ErrUnsupported = errors.New("not supported by the device's firmware")
+
+// Capability identifies a feature that is only supported by some firmware versions
+type Capability string
+
+const (
+	// CapabilityGPIOInput is the configuration of GPIO pin modes and the reading of digital and analog inputs
+	// (sys set pinmode, sys get pindig and sys get pinana)
+	CapabilityGPIOInput Capability = "gpio-input"
+	// CapabilityRadioRSSI is reading the current RSSI of the channel (radio get rssi)
+	CapabilityRadioRSSI Capability = "radio-rssi"
+	// CapabilityPacketRSSI is reading the RSSI of the last received packet (radio get pktrssi)
+	CapabilityPacketRSSI Capability = "packet-rssi"
+	// CapabilityClassC is operating as a LoRaWAN Class C device (mac set class c)
+	CapabilityClassC Capability = "class-c"
+)
+
+// AllCapabilities lists every capability known to this library
+var AllCapabilities = []Capability{
+	CapabilityGPIOInput,
+	CapabilityRadioRSSI,
+	CapabilityPacketRSSI,
+	CapabilityClassC,
+}
+
+// capabilityRequirements records the firmware versions of each SKU that support each capability, as described by
+// the release notes of each device's firmware
+var capabilityRequirements = map[Capability]map[DeviceSKU]*VersionConstraint{
+	CapabilityGPIOInput: {
+		DeviceRN2483: MustParseVersionConstraint(">=1.0.3"),
+		DeviceRN2903: MustParseVersionConstraint(">=1.0.3"),
+	},
+	CapabilityRadioRSSI: {
+		DeviceRN2483: MustParseVersionConstraint(">=1.0.3"),
+		DeviceRN2903: MustParseVersionConstraint(">=1.0.3"),
+	},
+	CapabilityPacketRSSI: {
+		DeviceRN2483: MustParseVersionConstraint(">=1.0.5"),
+		DeviceRN2903: MustParseVersionConstraint(">=1.0.5"),
+	},
+	CapabilityClassC: {
+		DeviceRN2483: MustParseVersionConstraint(">=1.0.3"),
+		DeviceRN2903: MustParseVersionConstraint(">=1.0.5"),
+	},
+}
+
+// Capabilities records which capabilities a device supports
+type Capabilities map[Capability]bool
+
+// Supports determines whether the capability is supported
+func (c Capabilities) Supports(capability Capability) bool {
+	return c[capability]
+}
+
+// CapabilitiesOf determines the capabilities supported by a firmware version. Devices with unknown SKUs are assumed
+// to support every capability, leaving the device itself to reject anything it does not support.
+func CapabilitiesOf(fw *FirmwareVersion) Capabilities {
+	capabilities := Capabilities{}
+	for _, capability := range AllCapabilities {
+		requirement, known := capabilityRequirements[capability][fw.SKU]
+		capabilities[capability] = !known || fw.Satisfies(requirement)
+	}
+
+	return capabilities
+}
+
+// Capabilities determines the capabilities supported by the device, querying its firmware version if it has not
+// already been retrieved
+func (d *Device) Capabilities() (Capabilities, error) {
+	fw, err := d.firmwareVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	return CapabilitiesOf(fw), nil
+}
+
+// firmwareVersion returns the version most recently reported by the device, querying it if not yet known
+func (d *Device) firmwareVersion() (*FirmwareVersion, error) {
+	if d.firmware != nil {
+		return d.firmware, nil
+	}
+
+	return d.GetVersion()
+}
+
+// require fails with ErrUnsupported if the device's firmware does not support the capability
+func (d *Device) require(capability Capability) error {
+	fw, err := d.firmwareVersion()
+	if err != nil {
+		return fmt.Errorf("error determining firmware capabilities: %w", err)
+	}
+
+	if !CapabilitiesOf(fw).Supports(capability) {
+		return fmt.Errorf("%w: %s requires %s firmware %s, device has %s", ErrUnsupported, capability, fw.SKU,
+			capabilityRequirements[capability][fw.SKU], fw.VersionString())
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package rn2483_test
+
+import (
+	"testing"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+func parseVersion(t *testing.T, raw string) *rn2483.FirmwareVersion {
+	version, err := rn2483.ParseFirmwareVersion(raw)
+	Expect(t, err).To(Not(HaveOccurred()))
+	return version
+}
+
+func TestCapabilities(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.Group("capabilities are determined by firmware version", func() {
+		o.Spec("old firmware lacks newer capabilities", func(t *testing.T) {
+			capabilities := rn2483.CapabilitiesOf(parseVersion(t, "RN2483 1.0.1 Dec 15 2015 09:38:09"))
+			for _, capability := range rn2483.AllCapabilities {
+				Expect(t, capabilities.Supports(capability)).To(BeFalse())
+			}
+		})
+
+		o.Spec("the latest firmware has every capability", func(t *testing.T) {
+			capabilities := rn2483.CapabilitiesOf(parseVersion(t, "RN2483 1.0.5 Oct 31 2018 15:06:52"))
+			for _, capability := range rn2483.AllCapabilities {
+				Expect(t, capabilities.Supports(capability)).To(BeTrue())
+			}
+		})
+
+		o.Spec("capabilities differ between SKUs", func(t *testing.T) {
+			rn2483Capabilities := rn2483.CapabilitiesOf(parseVersion(t, "RN2483 1.0.4 Oct 12 2017 14:59:25"))
+			rn2903Capabilities := rn2483.CapabilitiesOf(parseVersion(t, "RN2903 1.0.4 Oct 12 2017 14:59:25"))
+			Expect(t, rn2483Capabilities.Supports(rn2483.CapabilityClassC)).To(BeTrue())
+			Expect(t, rn2903Capabilities.Supports(rn2483.CapabilityClassC)).To(BeFalse())
+		})
+
+		o.Spec("unknown SKUs are assumed to have every capability", func(t *testing.T) {
+			capabilities := rn2483.CapabilitiesOf(parseVersion(t, "RN9999 0.0.1 Oct 12 2017 14:59:25"))
+			for _, capability := range rn2483.AllCapabilities {
+				Expect(t, capabilities.Supports(capability)).To(BeTrue())
+			}
+		})
+	})
+
+	o.Group("commands are gated on capabilities", func() {
+		o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+			ctx := prepareTestContext(t)
+			ctx.fake.Update(func(d *fake.Device) {
+				d.Sys.FirmwareVersion = "RN2483 1.0.1 Dec 15 2015 09:38:09"
+			})
+			return t, ctx
+		})
+
+		o.Spec("the device reports its capabilities", func(t *testing.T, ctx *testContext) {
+			capabilities, err := ctx.device.Capabilities()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, capabilities.Supports(rn2483.CapabilityGPIOInput)).To(BeFalse())
+		})
+
+		o.Spec("unsupported commands fail without being sent", func(t *testing.T, ctx *testContext) {
+			_, err := ctx.device.GetAnalogGPIO(rn2483.PinGPIO00)
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrUnsupported))
+
+			err = ctx.device.SetPinMode(rn2483.PinGPIO00, rn2483.PinModeDigitalInput)
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrUnsupported))
+
+			_, err = ctx.device.GetRadioRSSI()
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrUnsupported))
+		})
+
+		o.Spec("the fake rejects commands its firmware does not support", func(t *testing.T, ctx *testContext) {
+			_, err := ctx.device.ExecuteCommandChecked("sys get pinana GPIO00")
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		})
+
+		o.Spec("capabilities are refreshed when the device reports a new version", func(t *testing.T, ctx *testContext) {
+			_, err := ctx.device.GetRadioRSSI()
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrUnsupported))
+
+			ctx.fake.Update(func(d *fake.Device) {
+				d.Sys.FirmwareVersion = "RN2483 1.0.5 Oct 31 2018 15:06:52"
+			})
+			_, err = ctx.device.Reset()
+			Expect(t, err).To(Not(HaveOccurred()))
+
+			rssi, err := ctx.device.GetRadioRSSI()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, rssi).To(Equal(-110))
+
+			rssi, err = ctx.device.GetRadioPacketRSSI()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, rssi).To(Equal(-128))
+		})
+	})
+}
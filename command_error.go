@@ -0,0 +1,62 @@
+package rn2483
+
+import (
+	"fmt"
+	"time"
+)
+
+// CommandStage identifies the part of a command's exchange with the device that failed
+type CommandStage int
+
+const (
+	// StageImmediate is the response the device sends as soon as it receives a command
+	StageImmediate CommandStage = iota
+	// StageDeferred is the result the device reports some time after accepting a command, such as that of radio tx
+	StageDeferred
+)
+
+func (s CommandStage) String() string {
+	switch s {
+	case StageImmediate:
+		return "immediate"
+	case StageDeferred:
+		return "deferred"
+	default:
+		return fmt.Sprintf("CommandStage(%d)", int(s))
+	}
+}
+
+// CommandError describes a command that failed, wrapping the error describing why (such as ErrInvalidParam) so that
+// it can still be identified using errors.Is
+type CommandError struct {
+	Command string
+	// Response is the raw response from the device, empty if none was received
+	Response string
+	Stage    CommandStage
+	// Elapsed is the time from the command first being sent until it failed, including any retries
+	Elapsed time.Duration
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	if e.Stage == StageDeferred {
+		return fmt.Sprintf("command %q failed after %s: %v", e.Command, e.Elapsed, e.Err)
+	}
+
+	return fmt.Sprintf("command %q failed: %v", e.Command, e.Err)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// responseError describes the most recently sent command failing, given the response it failed with
+func (d *Device) responseError(stage CommandStage, response string, err error) error {
+	return &CommandError{
+		Command:  d.lastCommand,
+		Response: response,
+		Stage:    stage,
+		Elapsed:  d.clock.Since(d.lastCommandSent),
+		Err:      err,
+	}
+}
@@ -0,0 +1,98 @@
+package rn2483_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+func TestCommandError(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	asCommandError := func(t *testing.T, err error) *rn2483.CommandError {
+		var commandErr *rn2483.CommandError
+		Expect(t, errors.As(err, &commandErr)).To(BeTrue())
+		return commandErr
+	}
+
+	o.Spec("describes rejected commands", func(t *testing.T) {
+		_, d := faultyDevice(t, rn2483.Config{}, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio set pwr"),
+			Fault:   fake.Fault{Kind: fake.FaultInvalidParam},
+		})
+
+		err := d.SetRadioPower(5)
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		Expect(t, err.Error()).To(Equal(`command "radio set pwr 5" failed: invalid parameter`))
+
+		commandErr := asCommandError(t, err)
+		Expect(t, commandErr.Command).To(Equal("radio set pwr 5"))
+		Expect(t, commandErr.Response).To(Equal("invalid_param"))
+		Expect(t, commandErr.Stage).To(Equal(rn2483.StageImmediate))
+	})
+
+	o.Spec("describes unrecognised responses", func(t *testing.T) {
+		_, d := faultyDevice(t, rn2483.Config{}, fake.FaultRule{
+			Pattern: regexp.MustCompile("^sys set nvm"),
+			Fault:   fake.Fault{Kind: fake.FaultGarbage, Garbage: []byte("foo")},
+		})
+
+		err := d.ExecuteCommandCheckedStrict("sys set nvm 300 AB")
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrUnknown))
+		Expect(t, err.Error()).To(Equal(`command "sys set nvm 300 AB" failed: unknown error: foo`))
+		Expect(t, asCommandError(t, err).Response).To(Equal("foo"))
+	})
+
+	o.Spec("describes unparseable analog values", func(t *testing.T) {
+		_, d := faultyDevice(t, rn2483.Config{}, fake.FaultRule{
+			Pattern: regexp.MustCompile("^sys get pinana"),
+			Fault:   fake.Fault{Kind: fake.FaultGarbage, Garbage: []byte("foo")},
+		})
+
+		_, err := d.GetAnalogGPIO(rn2483.PinGPIO00)
+		Expect(t, err).To(HaveOccurred())
+
+		commandErr := asCommandError(t, err)
+		Expect(t, commandErr.Command).To(Equal("sys get pinana GPIO00"))
+		Expect(t, commandErr.Response).To(Equal("foo"))
+		Expect(t, commandErr.Stage).To(Equal(rn2483.StageImmediate))
+	})
+
+	o.Spec("describes deferred failures", func(t *testing.T) {
+		_, d := faultyDevice(t, rn2483.Config{}, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio tx"),
+			Fault:   fake.Fault{Kind: fake.FaultRadioErr},
+		})
+
+		err := d.RadioTx([]byte("hello"))
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrTransmitTimeout))
+
+		commandErr := asCommandError(t, err)
+		Expect(t, commandErr.Command).To(Equal("radio tx 68656c6c6f"))
+		Expect(t, commandErr.Response).To(Equal("radio_err"))
+		Expect(t, commandErr.Stage).To(Equal(rn2483.StageDeferred))
+	})
+
+	o.Spec("records how long the command took", func(t *testing.T) {
+		_, d := unresponsiveTo(t, "^sys get vdd$", rn2483.Config{
+			ResponseTimeout: 50 * time.Millisecond,
+		})
+
+		_, err := d.GetVDD()
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrResponseTimeout))
+
+		commandErr := asCommandError(t, err)
+		Expect(t, commandErr.Response).To(Equal(""))
+		Expect(t, commandErr.Elapsed >= 50*time.Millisecond).To(BeTrue())
+	})
+}
@@ -0,0 +1,242 @@
+// Package conformance provides a suite of tests exercising every command implemented by this library, which can be
+// run against either a fake.Device or real hardware in order to detect divergence between the fake and the firmware of
+// actual RN2483/RN2903 modules
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+// Target describes the device the conformance suite is run against
+type Target struct {
+	// Open provides a freshly opened device for each test, the suite closes the device once the test completes
+	Open func(t *testing.T) *rn2483.Device
+
+	// OutputPins lists the GPIO pins that are safe to drive as outputs, pins not listed are never written to
+	OutputPins []rn2483.PinName
+	// AllowTransmit permits tests that transmit using the radio
+	AllowTransmit bool
+}
+
+var hweuiRegex = regexp.MustCompile("^[0-9A-Fa-f]{16}$")
+
+// Run runs the conformance suite against the target
+func Run(t *testing.T, target Target) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *rn2483.Device) {
+		d := target.Open(t)
+		t.Cleanup(func() {
+			if err := d.Close(); err != nil {
+				t.Logf("error closing device: %v", err)
+			}
+		})
+		return t, d
+	})
+
+	o.Group("sys", func() {
+		o.Spec("get ver reports a known SKU", func(t *testing.T, d *rn2483.Device) {
+			version, err := d.GetVersion()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, version.IsKnownSKU()).To(BeTrue())
+			Expect(t, version.Major).To(Equal(1))
+		})
+
+		o.Spec("reset reports the firmware version", func(t *testing.T, d *rn2483.Device) {
+			version, err := d.Reset()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, version.IsKnownSKU()).To(BeTrue())
+		})
+
+		o.Spec("get hweui reports a 64 bit hex EUI", func(t *testing.T, d *rn2483.Device) {
+			hweui, err := d.GetHWEUI()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, hweuiRegex.MatchString(hweui)).To(BeTrue())
+		})
+
+		o.Spec("get vdd reports a plausible supply voltage", func(t *testing.T, d *rn2483.Device) {
+			vdd, err := d.GetVDD()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, float64(vdd.Millivolts())).To(And(BeAbove(1800), BeBelow(3700)))
+		})
+
+		o.Spec("nvm can be read across all of user NVM", func(t *testing.T, d *rn2483.Device) {
+			data, err := rn2483.ReadNVM(d, rn2483.UserNVMStart, rn2483.UserNVMLength)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, data).To(HaveLen(int(rn2483.UserNVMLength)))
+		})
+
+		o.Spec("nvm writes can be read back", func(t *testing.T, d *rn2483.Device) {
+			address := rn2483.UserNVMEnd
+			original, err := d.ReadNVM(address)
+			Expect(t, err).To(Not(HaveOccurred()))
+			defer func() {
+				Expect(t, d.WriteNVM(address, original)).To(Not(HaveOccurred()))
+			}()
+
+			for _, value := range []byte{^original, 0x00, 0x0F} {
+				Expect(t, d.WriteNVM(address, value)).To(Not(HaveOccurred()))
+
+				readBack, err := d.ReadNVM(address)
+				Expect(t, err).To(Not(HaveOccurred()))
+				Expect(t, readBack).To(Equal(value))
+			}
+		})
+
+		for _, address := range []uint16{0x000, rn2483.UserNVMStart - 1, rn2483.UserNVMEnd + 1} {
+			address := address
+			o.Spec(fmt.Sprintf("nvm access out of bounds at 0x%03X is rejected", address), func(t *testing.T, d *rn2483.Device) {
+				_, err := d.ReadNVM(address)
+				Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+			})
+		}
+
+		o.Spec("sleep wakes after the duration", func(t *testing.T, d *rn2483.Device) {
+			Expect(t, d.Sleep(100*time.Millisecond)).To(Not(HaveOccurred()))
+
+			_, err := d.GetVersion()
+			Expect(t, err).To(Not(HaveOccurred()))
+		})
+
+		o.Spec("pindig sets output pins", func(t *testing.T, d *rn2483.Device) {
+			if len(target.OutputPins) < 1 {
+				t.Skip("no output pins are safe to drive")
+			}
+
+			for _, pin := range target.OutputPins {
+				Expect(t, d.SetPinMode(pin, rn2483.PinModeDigitalOutput)).To(Not(HaveOccurred()))
+
+				for _, level := range []bool{true, false} {
+					Expect(t, d.SetDigitalGPIO(pin, level)).To(Not(HaveOccurred()))
+
+					readBack, err := d.GetDigitalGPIO(pin)
+					Expect(t, err).To(Not(HaveOccurred()))
+					Expect(t, readBack).To(Equal(level))
+				}
+			}
+		})
+
+		o.Spec("pindig rejects unknown pins", func(t *testing.T, d *rn2483.Device) {
+			err := d.SetDigitalGPIO("GPIO99", false)
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+
+			_, err = d.GetDigitalGPIO("GPIO99")
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		})
+
+		o.Spec("pinmode rejects unknown modes", func(t *testing.T, d *rn2483.Device) {
+			err := d.SetPinMode(rn2483.PinGPIO00, "nonsense")
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		})
+	})
+
+	o.Group("mac", func() {
+		o.Spec("pause reports a pause duration", func(t *testing.T, d *rn2483.Device) {
+			duration, err := d.PauseMAC()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, float64(duration)).To(BeAbove(0))
+		})
+	})
+
+	o.Group("radio", func() {
+		pauseMAC := func(t *testing.T, d *rn2483.Device) {
+			_, err := d.PauseMAC()
+			Expect(t, err).To(Not(HaveOccurred()))
+		}
+
+		for _, param := range rn2483.KnownRadioParameters {
+			param := param
+			o.Spec(fmt.Sprintf("get %s reports a value", param), func(t *testing.T, d *rn2483.Device) {
+				pauseMAC(t, d)
+
+				value, err := d.GetRadioParameter(param)
+				Expect(t, err).To(Not(HaveOccurred()))
+				Expect(t, value).To(Not(Equal("")))
+			})
+		}
+
+		o.Spec("rssi is available when the firmware supports it", func(t *testing.T, d *rn2483.Device) {
+			pauseMAC(t, d)
+
+			capabilities, err := d.Capabilities()
+			Expect(t, err).To(Not(HaveOccurred()))
+
+			_, err = d.GetRadioRSSI()
+			if capabilities.Supports(rn2483.CapabilityRadioRSSI) {
+				Expect(t, err).To(Not(HaveOccurred()))
+			} else {
+				Expect(t, err).To(testutils.MatchError(rn2483.ErrUnsupported))
+			}
+		})
+
+		o.Spec("get rejects unknown parameters", func(t *testing.T, d *rn2483.Device) {
+			pauseMAC(t, d)
+
+			_, err := d.GetRadioParameter("nonsense")
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		})
+
+		o.Spec("set pwr can be read back", func(t *testing.T, d *rn2483.Device) {
+			pauseMAC(t, d)
+
+			original, err := d.GetRadioPower()
+			Expect(t, err).To(Not(HaveOccurred()))
+			defer func() {
+				Expect(t, d.SetRadioPower(original)).To(Not(HaveOccurred()))
+			}()
+
+			Expect(t, d.SetRadioPower(5)).To(Not(HaveOccurred()))
+			power, err := d.GetRadioPower()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, power).To(Equal(5))
+		})
+
+		o.Spec("set pwr rejects out of range values", func(t *testing.T, d *rn2483.Device) {
+			pauseMAC(t, d)
+
+			Expect(t, d.SetRadioPower(99)).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		})
+
+		o.Spec("set rejects invalid values", func(t *testing.T, d *rn2483.Device) {
+			pauseMAC(t, d)
+
+			Expect(t, d.SetRadioParameter("sf", "sf99")).To(testutils.MatchError(rn2483.ErrInvalidParam))
+			Expect(t, d.SetRadioParameter("crc", "maybe")).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		})
+
+		o.Spec("tx reports transmission success", func(t *testing.T, d *rn2483.Device) {
+			if !target.AllowTransmit {
+				t.Skip("transmitting is not permitted")
+			}
+			pauseMAC(t, d)
+
+			Expect(t, d.RadioTx([]byte("conformance"))).To(Not(HaveOccurred()))
+		})
+
+		o.Spec("rx with a short window completes", func(t *testing.T, d *rn2483.Device) {
+			pauseMAC(t, d)
+
+			_, err := d.RadioRx(10)
+			if err != nil && !errors.Is(err, rn2483.ErrReceiveTimeout) {
+				t.Fatalf("unexpected receive error: %v", err)
+			}
+		})
+	})
+
+	o.Spec("unknown commands are rejected", func(t *testing.T, d *rn2483.Device) {
+		err := d.ExecuteCommandCheckedStrict("sys frobnicate")
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+	})
+}
@@ -0,0 +1,23 @@
+package conformance_test
+
+import (
+	"testing"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/conformance"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+func TestFakeConformance(t *testing.T) {
+	conformance.Run(t, conformance.Target{
+		Open: func(t *testing.T) *rn2483.Device {
+			_, d := fake.NewFakeDevice(fake.Config{
+				Logger: testutils.CreateTestLogger(t).WithName("fake-device"),
+			})
+			return d
+		},
+		OutputPins:    rn2483.AllPins,
+		AllowTransmit: true,
+	})
+}
@@ -0,0 +1,80 @@
+//go:build linux
+// +build linux
+
+package conformance_test
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/conformance"
+	"github.com/omaskery/rn2483/internal/termios"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+// TestHardwareConformance runs the conformance suite against real hardware when RN2483_CONFORMANCE_PORT names a
+// serial port. Optionally:
+// - RN2483_CONFORMANCE_BAUDRATE sets the baud rate (default 57600)
+// - RN2483_CONFORMANCE_PINS lists GPIO pins that are safe to drive as outputs, comma separated (e.g. GPIO10,GPIO11)
+// - RN2483_CONFORMANCE_TX=1 permits transmitting with the radio
+func TestHardwareConformance(t *testing.T) {
+	port := os.Getenv("RN2483_CONFORMANCE_PORT")
+	if port == "" {
+		t.Skip("RN2483_CONFORMANCE_PORT not set")
+	}
+
+	baudRate := uint64(57600)
+	if s := os.Getenv("RN2483_CONFORMANCE_BAUDRATE"); s != "" {
+		var err error
+		if baudRate, err = strconv.ParseUint(s, 10, 32); err != nil {
+			t.Fatalf("invalid RN2483_CONFORMANCE_BAUDRATE: %v", err)
+		}
+	}
+
+	var pins []rn2483.PinName
+	for _, pin := range strings.Split(os.Getenv("RN2483_CONFORMANCE_PINS"), ",") {
+		if pin = strings.TrimSpace(pin); pin != "" {
+			pins = append(pins, rn2483.PinName(pin))
+		}
+	}
+
+	// the suite runs tests in parallel, but there is only one device to go around
+	var portLock sync.Mutex
+
+	conformance.Run(t, conformance.Target{
+		Open: func(t *testing.T) *rn2483.Device {
+			portLock.Lock()
+			t.Cleanup(portLock.Unlock)
+
+			f, err := os.OpenFile(port, os.O_RDWR|unix.O_NOCTTY, 0)
+			if err != nil {
+				t.Fatalf("error opening serial port: %v", err)
+			}
+			if err := termios.MakeRaw(f); err != nil {
+				t.Fatalf("error configuring serial port: %v", err)
+			}
+			if err := termios.SetBaudRate(f, uint(baudRate)); err != nil {
+				t.Fatalf("error configuring serial port: %v", err)
+			}
+			if err := termios.FlushInput(f); err != nil {
+				t.Fatalf("error flushing serial port: %v", err)
+			}
+
+			return rn2483.New(rn2483.Config{
+				Serial: &rn2483.DebugSerial{
+					Serial:     f,
+					Logger:     testutils.CreateTestLogger(t).WithName("serial"),
+					AssumeText: true,
+				},
+			})
+		},
+		OutputPins:    pins,
+		AllowTransmit: os.Getenv("RN2483_CONFORMANCE_TX") == "1",
+	})
+}
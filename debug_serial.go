@@ -2,6 +2,7 @@ package rn2483
 
 import (
 	"io"
+	"time"
 
 	"github.com/go-logr/logr"
 )
@@ -37,7 +38,36 @@ func (d *DebugSerial) Close() error {
 	return d.Serial.Close()
 }
 
+// SendBreak implements the BreakSender interface if the underlying Serial implementation does (see AdaptTransport),
+// logging the break
+func (d *DebugSerial) SendBreak(duration time.Duration) error {
+	d.Logger.Info("break", "duration", duration)
+	return AdaptTransport(d.Serial).SendBreak(duration)
+}
+
+// Flush implements the Flusher interface if the underlying Serial implementation does (see AdaptTransport), logging
+// the flush
+func (d *DebugSerial) Flush() error {
+	d.Logger.Info("flush")
+	return AdaptTransport(d.Serial).Flush()
+}
+
+// SetReadDeadline implements the ReadDeadliner interface if the underlying Serial implementation does (see
+// AdaptTransport)
+func (d *DebugSerial) SetReadDeadline(deadline time.Time) error {
+	return AdaptTransport(d.Serial).SetReadDeadline(deadline)
+}
+
+// SetBaudRate implements the BaudRateSetter interface if the underlying Serial implementation does (see
+// AdaptTransport), logging the change
+func (d *DebugSerial) SetBaudRate(baud uint) error {
+	d.Logger.Info("baud rate", "baud", baud)
+	return AdaptTransport(d.Serial).SetBaudRate(baud)
+}
+
 var _ io.ReadWriteCloser = (*DebugSerial)(nil)
+var _ BreakSender = (*DebugSerial)(nil)
+var _ Transport = (*DebugSerial)(nil)
 
 func (d *DebugSerial) prepareData(data []byte) interface{} {
 	if d.AssumeText {
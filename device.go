@@ -1,36 +1,110 @@
 package rn2483
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"io"
-	"strings"
+	"os"
+	"time"
+
+	"github.com/jonboulle/clockwork"
 )
 
 var (
 	ErrInvalidParam    = errors.New("invalid parameter")
 	ErrUnknown         = errors.New("unknown error")
 	ErrTransceiverBusy = errors.New("the transceiver is currently busy")
+	ErrResponseTimeout = errors.New("timed out waiting for response")
+	// ErrUnexpectedReset is returned when the device prints the version banner it prints on starting, in place of a
+	// response, showing that it has spontaneously reset (e.g. due to a brownout) and lost its configuration
+	ErrUnexpectedReset = errors.New("device reset unexpectedly")
 )
 
 // Config allows for configuring a new Device
 type Config struct {
+	// Serial connects to the device, which is adapted to a Transport (see AdaptTransport) to expose its capabilities
 	Serial io.ReadWriteCloser
+
+	// AutoBaudOnGarbage causes the device to perform auto-baud (see Device.AutoBaud) and then retry the command once,
+	// whenever a command's response looks garbled. The serial device must implement BreakSender.
+	AutoBaudOnGarbage bool
+
+	// RequiredFirmware, when set, is the constraint the device's firmware version must satisfy, such as
+	// MustParseVersionConstraint(">=1.0.4"). It is checked by Device.Init and Device.VerifyFirmware, and before the
+	// first command executed otherwise, after which commands fail with ErrUnsupportedFirmware if the constraint is not
+	// satisfied. Commands reporting the firmware version (sys get ver, sys reset and sys factoryRESET) are not refused.
+	// Sending commands with Device.Sendf bypasses the check.
+	RequiredFirmware *VersionConstraint
+
+	// ResponseTimeout, when set, is how long to wait for the response to each command before failing with
+	// ErrResponseTimeout. It does not apply to results reported later, such as those of radio tx or radio rx.
+	ResponseTimeout time.Duration
+	// Clock is used for response timeouts and retry backoff, defaulting to the real clock. Response timeouts use the
+	// real clock regardless when the transport supports read deadlines.
+	Clock clockwork.Clock
+
+	// RetryPolicy, when set, retries commands that fail transiently (see RetryPolicy and Device.WithRetryPolicy)
+	RetryPolicy *RetryPolicy
+
+	// Metrics, when set, receives measurements of the device's operation
+	Metrics Metrics
+
+	// Interceptors are called around every exchange with the device, the first being outermost (see Interceptor)
+	Interceptors []Interceptor
 }
 
 // Device represents a single RN2483 (or 2903) device, providing methods for configuring and querying its state and
-// invoking the various features of the device (primarily transmitting & receiving packets)
+// invoking the various features of the device (primarily transmitting & receiving packets).
+// A Device is not safe for concurrent use, as each command's response must be read before the next command is sent.
 type Device struct {
-	serial io.ReadWriteCloser
-	reader *bufio.Reader
+	serial Transport
+	lines  *lineFramer
+	clock  clockwork.Clock
+
+	autoBaudOnGarbage bool
+	requiredFirmware  *VersionConstraint
+	responseTimeout   time.Duration
+	retryPolicy       *RetryPolicy
+	metrics           Metrics
+	interceptors      []Interceptor
+
+	// pendingLine receives the result of a read that was still in progress when a response timed out, which is
+	// collected before reading again so that two reads are never in progress at once
+	pendingLine chan lineResult
+
+	// firmware is the version most recently reported by the device, used to determine its capabilities
+	firmware *FirmwareVersion
+
+	// lastCommand and lastCommandSent describe the command most recently executed, for describing its failure
+	lastCommand     string
+	lastCommandSent time.Time
 }
 
 // New creates a new Device
 func New(cfg Config) *Device {
+	clock := cfg.Clock
+	if clock == nil {
+		clock = clockwork.NewRealClock()
+	}
+
+	var metrics Metrics = nopMetrics{}
+	if cfg.Metrics != nil {
+		metrics = cfg.Metrics
+	}
+
+	serial := AdaptTransport(cfg.Serial)
+
 	return &Device{
-		serial: cfg.Serial,
-		reader: bufio.NewReader(cfg.Serial),
+		serial: serial,
+		lines:  newLineFramer(serial),
+		clock:  clock,
+
+		autoBaudOnGarbage: cfg.AutoBaudOnGarbage,
+		requiredFirmware:  cfg.RequiredFirmware,
+		responseTimeout:   cfg.ResponseTimeout,
+		retryPolicy:       cfg.RetryPolicy,
+		metrics:           metrics,
+		interceptors:      cfg.Interceptors,
 	}
 }
 
@@ -64,21 +138,160 @@ func (d *Device) Sendf(format string, a ...interface{}) error {
 	return nil
 }
 
-// ReadResponse allows for easily reading a line of text from the device in response to a command
+// ReadResponse allows for easily reading a line of text from the device in response to a command, failing with
+// ErrResponseTimeout if Config.ResponseTimeout is set and no response arrives in time
 func (d *Device) ReadResponse() (string, error) {
-	line, err := d.reader.ReadString('\n')
+	return d.readResponse(d.responseTimeout)
+}
+
+// readDeferredResponse reads a line of text reported some time after a command was accepted (such as the result of a
+// transmission), for which no timeout applies
+func (d *Device) readDeferredResponse() (string, error) {
+	return d.readDeferredResponseUntil(nil)
+}
+
+// readDeferredResponseUntil reads a deferred response as readDeferredResponse does, but abandons the read when abandon
+// is closed (see readResponseUntil)
+func (d *Device) readDeferredResponseUntil(abandon <-chan struct{}) (string, error) {
+	call := &Call{
+		Command: d.lastCommand,
+		Stage:   StageDeferred,
+		Attempt: 1,
+	}
+
+	line, err := d.intercept(call, func(call *Call) (string, error) {
+		line, err := d.readResponseUntil(0, abandon)
+		if err != nil {
+			return "", err
+		}
+
+		return line, d.checkUnexpectedReset(line)
+	})
 	if err != nil {
-		return "", fmt.Errorf("error reading from serial device: %w", err)
+		return "", d.responseError(StageDeferred, line, err)
+	}
+
+	return line, nil
+}
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+// errReadAbandoned is returned by reads abandoned before a line was read
+var errReadAbandoned = errors.New("read abandoned")
+
+// readResponse reads a line of text, waiting no longer than timeout unless it is zero. Unless the transport supports
+// read deadlines, a read that times out is left in progress, and the line it eventually reads is returned by the next
+// call.
+func (d *Device) readResponse(timeout time.Duration) (string, error) {
+	return d.readResponseUntil(timeout, nil)
+}
+
+// readResponseUntil reads a line of text as readResponse does, but also gives up with errReadAbandoned when abandon is
+// closed, leaving the read in progress as a read that times out is
+func (d *Device) readResponseUntil(timeout time.Duration, abandon <-chan struct{}) (string, error) {
+	if d.pendingLine == nil && timeout != 0 {
+		if line, ok, err := d.readWithDeadline(timeout); ok {
+			return line, err
+		}
 	}
 
-	line = strings.TrimSpace(line)
+	if d.pendingLine == nil {
+		if timeout == 0 && abandon == nil {
+			return d.checkRead(d.lines.ReadLine())
+		}
+
+		pending := make(chan lineResult, 1)
+		go func() {
+			line, err := d.lines.ReadLine()
+			pending <- lineResult{line: line, err: err}
+		}()
+		d.pendingLine = pending
+	}
+
+	var expired <-chan time.Time
+	if timeout != 0 {
+		expired = d.clock.After(timeout)
+	}
+
+	select {
+	case result := <-d.pendingLine:
+		d.pendingLine = nil
+		return d.checkRead(result.line, result.err)
+	case <-expired:
+		return "", fmt.Errorf("%w: no response within %s", ErrResponseTimeout, timeout)
+	case <-abandon:
+		return "", errReadAbandoned
+	}
+}
+
+// readWithDeadline reads a line of text using a read deadline, so that no read is left in progress if it times out,
+// reporting false if the transport does not support read deadlines
+func (d *Device) readWithDeadline(timeout time.Duration) (string, bool, error) {
+	if err := d.serial.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", false, nil
+	}
+	defer func() {
+		_ = d.serial.SetReadDeadline(time.Time{})
+	}()
+
+	line, err := d.lines.ReadLine()
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return "", true, fmt.Errorf("%w: no response within %s", ErrResponseTimeout, timeout)
+	}
+
+	line, err = d.checkRead(line, err)
+	return line, true, err
+}
+
+func (d *Device) checkRead(line string, err error) (string, error) {
+	if err != nil {
+		return "", fmt.Errorf("error reading from serial device: %w", err)
+	}
 
 	return line, nil
 }
 
-// ExecuteCommand sends the provided command, then reads and returns the response
+// discardBuffered discards any input that has been received but not yet read, unless a read is in progress
+func (d *Device) discardBuffered() error {
+	if d.pendingLine != nil {
+		return nil
+	}
+
+	d.lines.Discard()
+
+	if err := d.serial.Flush(); err != nil && !errors.Is(err, ErrUnsupportedByTransport) {
+		return fmt.Errorf("error flushing transport: %w", err)
+	}
+
+	return nil
+}
+
+// ExecuteCommand sends the provided command, then reads and returns the response, retrying transient failures
+// according to the retry policy (see Config.RetryPolicy)
 func (d *Device) ExecuteCommand(format string, a ...interface{}) (string, error) {
-	if err := d.Sendf(format, a...); err != nil {
+	return d.executeWithRetry(fmt.Sprintf(format, a...), nil)
+}
+
+// exchange sends the command and reads its response, performing auto-baud and trying again once if the response is
+// garbled and Config.AutoBaudOnGarbage is set. Any response is returned even on failure, to describe the failure.
+func (d *Device) exchange(command string) (string, error) {
+	line, err := d.executeCommand(command)
+	if err != nil || !d.autoBaudOnGarbage || !isGarbled(line) {
+		return line, err
+	}
+
+	if _, err := d.AutoBaud(); err != nil {
+		return "", fmt.Errorf("error performing auto-baud after garbled response %q: %w", line, err)
+	}
+
+	return d.executeCommand(command)
+}
+
+func (d *Device) executeCommand(command string) (string, error) {
+	if err := d.Sendf("%s", command); err != nil {
 		return "", err
 	}
 
@@ -87,37 +300,49 @@ func (d *Device) ExecuteCommand(format string, a ...interface{}) (string, error)
 		return "", err
 	}
 
+	if !versionCommands[command] {
+		if err := d.checkUnexpectedReset(line); err != nil {
+			return line, err
+		}
+	}
+
 	return line, nil
 }
 
-// ExecuteCommandChecked sends the provided command, reads the response, checks it for common error codes, then
-// returns the response
-func (d *Device) ExecuteCommandChecked(format string, a ...interface{}) (string, error) {
-	line, err := d.ExecuteCommand(format, a...)
+// versionCommands respond with the version banner, which the device otherwise only prints as it starts
+var versionCommands = map[string]bool{
+	"sys reset":        true,
+	"sys factoryRESET": true,
+	"sys get ver":      true,
+}
+
+// checkUnexpectedReset fails with ErrUnexpectedReset if the line is the version banner printed by the device as it
+// starts
+func (d *Device) checkUnexpectedReset(line string) error {
+	version, err := ParseFirmwareVersion(line)
 	if err != nil {
-		return "", err
+		return nil
 	}
 
-	if err := CheckCommandResponse(line, true); err != nil {
-		return "", err
-	}
+	d.firmware = version
+	return fmt.Errorf("%w: %s", ErrUnexpectedReset, line)
+}
 
-	return line, nil
+// ExecuteCommandChecked sends the provided command, reads the response, checks it for common error codes, then
+// returns the response
+func (d *Device) ExecuteCommandChecked(format string, a ...interface{}) (string, error) {
+	return d.executeWithRetry(fmt.Sprintf(format, a...), func(line string) error {
+		return CheckCommandResponse(line, true)
+	})
 }
 
 // ExecuteCommandCheckedStrict sends the provided command, reads the response and then checks it is one of a set of
 // known command responses, failing any unrecognised responses
 func (d *Device) ExecuteCommandCheckedStrict(format string, a ...interface{}) error {
-	line, err := d.ExecuteCommand(format, a...)
-	if err != nil {
-		return err
-	}
-
-	if err := CheckCommandResponse(line, false); err != nil {
-		return err
-	}
-
-	return nil
+	_, err := d.executeWithRetry(fmt.Sprintf(format, a...), func(line string) error {
+		return CheckCommandResponse(line, false)
+	})
+	return err
 }
 
 // CheckCommandResponse validates a command response against known error codes, optionally failing unknown responses
@@ -57,9 +57,13 @@ func errMain(logger logr.Logger) error {
 		AssumeText: true,
 	}
 
-	device := rn2483.New(rn2483.Config{
+	device, info, err := rn2483.Open(rn2483.Config{
 		Serial: dbg,
-	})
+	}, rn2483.InitOptions{})
+	if err != nil {
+		return fmt.Errorf("error initialising device: %w", err)
+	}
+	logger.Info("device ready", "sku", info.Firmware.SKU, "version", info.Firmware.VersionString(), "hweui", info.HWEUI)
 	defer func() {
 		if err := device.Close(); err != nil {
 			logger.Error(err, "error closing device")
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alecthomas/kong"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/stdr"
+	"github.com/jacobsa/go-serial/serial"
+
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/netserial"
+)
+
+var CLI struct {
+	Port      string `kong:"help='serial device port to expose',env='PORT'"`
+	Verbosity int    `kong:"short='v',type='counter',help='increases the logging verbosity',env='VERBOSITY'"`
+	BaudRate  uint   `kong:"default='57600',help='baud rate for serial port',env='BAUDRATE'"`
+
+	Fake   bool   `kong:"help='expose a fake device instead of a serial port',env='FAKE'"`
+	Listen string `kong:"default=':7000',help='TCP address to listen on',env='LISTEN'"`
+	Mode   string `kong:"default='raw',enum='raw,rfc2217',help='protocol spoken to clients',env='MODE'"`
+}
+
+func main() {
+	kong.Parse(
+		&CLI,
+		kong.Description("exposes a serial device (or a fake device) to clients over TCP"),
+		kong.UsageOnError(),
+	)
+
+	logger := stdr.New(log.Default())
+	stdr.SetVerbosity(CLI.Verbosity)
+
+	if err := errMain(logger); err != nil {
+		logger.Error(err, "program exiting with error")
+		os.Exit(1)
+	}
+}
+
+func openDevice(logger logr.Logger) (io.ReadWriteCloser, error) {
+	if CLI.Fake {
+		return fake.New(fake.Config{
+			Logger: logger.WithName("fake-device"),
+		}), nil
+	}
+
+	if CLI.Port == "" {
+		return nil, errors.New("either --port or --fake must be specified")
+	}
+
+	s, err := serial.Open(serial.OpenOptions{
+		PortName:        CLI.Port,
+		BaudRate:        CLI.BaudRate,
+		DataBits:        8,
+		StopBits:        1,
+		MinimumReadSize: 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error opening serial port: %v", err)
+	}
+
+	return s, nil
+}
+
+func errMain(logger logr.Logger) error {
+	device, err := openDevice(logger)
+	if err != nil {
+		return err
+	}
+
+	bridge, err := netserial.NewBridge(netserial.BridgeConfig{
+		Logger:   logger.WithName("bridge"),
+		Mode:     netserial.Mode(CLI.Mode),
+		Device:   device,
+		BaudRate: CLI.BaudRate,
+	})
+	if err != nil {
+		_ = device.Close()
+		return fmt.Errorf("error creating bridge: %w", err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- bridge.ListenAndServe(CLI.Listen)
+	}()
+
+	select {
+	case err = <-serveErr:
+	case <-stop:
+	}
+
+	if closeErr := bridge.Close(); closeErr != nil {
+		logger.Error(closeErr, "error closing bridge")
+	}
+
+	return err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alecthomas/kong"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/stdr"
+
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/fake/pty"
+)
+
+var CLI struct {
+	Verbosity int `kong:"short='v',type='counter',help='increases the logging verbosity',env='VERBOSITY'"`
+
+	Link            string `kong:"help='optionally create a symlink at this path pointing to the pseudo-terminal',env='LINK'"`
+	FirmwareVersion string `kong:"help='overrides the version string reported by the fake device',env='FIRMWARE_VERSION'"`
+}
+
+func main() {
+	kong.Parse(
+		&CLI,
+		kong.Description("serves a fake device on a pseudo-terminal, for use in place of a real serial port"),
+		kong.UsageOnError(),
+	)
+
+	logger := stdr.New(log.Default())
+	stdr.SetVerbosity(CLI.Verbosity)
+
+	if err := errMain(logger); err != nil {
+		logger.Error(err, "program exiting with error")
+		os.Exit(1)
+	}
+}
+
+func errMain(logger logr.Logger) error {
+	device := fake.New(fake.Config{
+		Logger: logger.WithName("fake-device"),
+	})
+	if CLI.FirmwareVersion != "" {
+		device.Sys.FirmwareVersion = CLI.FirmwareVersion
+	}
+
+	server, err := pty.Serve(pty.Config{
+		Logger: logger.WithName("pty"),
+		Device: device,
+	})
+	if err != nil {
+		return fmt.Errorf("error serving fake device: %w", err)
+	}
+	defer func() {
+		if err := server.Close(); err != nil {
+			logger.Error(err, "error closing pseudo-terminal")
+		}
+	}()
+
+	if CLI.Link != "" {
+		if err := os.Symlink(server.Path(), CLI.Link); err != nil {
+			return fmt.Errorf("error creating symlink to pseudo-terminal: %w", err)
+		}
+		defer func() {
+			if err := os.Remove(CLI.Link); err != nil {
+				logger.Error(err, "error removing symlink to pseudo-terminal")
+			}
+		}()
+	}
+
+	fmt.Println(server.Path())
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	return nil
+}
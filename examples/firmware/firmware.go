@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/alecthomas/kong"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/stdr"
+	"github.com/jacobsa/go-serial/serial"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/bootloader"
+	"github.com/omaskery/rn2483/intelhex"
+)
+
+var CLI struct {
+	Port      string `kong:"flag,required,help='serial device port to open',env='PORT'"`
+	Verbosity int    `kong:"short='v',type='counter',help='increases the logging verbosity',env='VERBOSITY'"`
+	BaudRate  uint   `kong:"default='57600',help='baud rate for serial port',env='BAUDRATE'"`
+
+	Erase  cmdErase  `kong:"cmd,help='erase the device firmware and enter the bootloader, the device is unusable until reflashed'"`
+	Detect cmdDetect `kong:"cmd,help='check whether the bootloader is running'"`
+	Update cmdUpdate `kong:"cmd,help='write firmware from an Intel HEX file using the bootloader'"`
+	Verify cmdVerify `kong:"cmd,help='check the device flash matches an Intel HEX file'"`
+	Reset  cmdReset  `kong:"cmd,help='restart the device, running its firmware if any has been written'"`
+}
+
+type cmdContext struct {
+	Logger     logr.Logger
+	Device     *rn2483.Device
+	Bootloader bootloader.Config
+}
+
+func main() {
+	cmd := kong.Parse(
+		&CLI,
+		kong.Description("erases and updates device firmware using the bootloader"),
+		kong.UsageOnError(),
+	)
+
+	logger := stdr.New(log.Default())
+	stdr.SetVerbosity(CLI.Verbosity)
+
+	s, err := serial.Open(serial.OpenOptions{
+		PortName:        CLI.Port,
+		BaudRate:        CLI.BaudRate,
+		DataBits:        8,
+		StopBits:        1,
+		MinimumReadSize: 1,
+	})
+	if err != nil {
+		logger.Error(err, "error opening serial port")
+		os.Exit(1)
+	}
+
+	device := rn2483.New(rn2483.Config{
+		Serial: &rn2483.DebugSerial{
+			Serial:     s,
+			Logger:     logger.WithName("serial").V(1),
+			AssumeText: true,
+		},
+	})
+	defer func() {
+		if err := device.Close(); err != nil {
+			logger.Error(err, "error closing device")
+		}
+	}()
+
+	ctx := cmdContext{
+		Logger: logger,
+		Device: device,
+		Bootloader: bootloader.Config{
+			Logger: logger.WithName("bootloader"),
+			Serial: &rn2483.DebugSerial{
+				Serial: s,
+				Logger: logger.WithName("serial").V(1),
+			},
+		},
+	}
+
+	if err := cmd.Run(ctx); err != nil {
+		logger.Error(err, "program exiting with error")
+		os.Exit(1)
+	}
+}
+
+type cmdErase struct {
+	SKU     rn2483.DeviceSKU `kong:"required,help='SKU of the device, which must match the device for the erase to proceed'"`
+	Confirm string           `kong:"required,help='must be the confirmation phrase given by the error when it is missing'"`
+}
+
+func (cmd *cmdErase) Run(ctx cmdContext) error {
+	_, info, err := bootloader.Enter(ctx.Device, rn2483.EraseFirmwareOptions{
+		Confirmation: cmd.Confirm,
+		SKU:          cmd.SKU,
+	}, ctx.Bootloader)
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger.Info("firmware erased, bootloader running", "version", info.VersionString(), "device-id", info.DeviceID)
+	return nil
+}
+
+type cmdDetect struct{}
+
+func (cmd *cmdDetect) Run(ctx cmdContext) error {
+	info, err := bootloader.New(ctx.Bootloader).Detect()
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger.Info("bootloader running", "version", info.VersionString(), "device-id", info.DeviceID,
+		"max-packet-size", info.MaxPacketSize, "erase-row-size", info.EraseRowSize)
+	return nil
+}
+
+func loadFirmware(filename string) ([]intelhex.Segment, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening firmware file: %w", err)
+	}
+	defer f.Close()
+
+	return intelhex.Decode(f)
+}
+
+type cmdUpdate struct {
+	Input            string `kong:"arg,type='existingfile',help='Intel HEX file containing the firmware'"`
+	Resume           bool   `kong:"help='skip rows already written, to continue an interrupted update'"`
+	ApplicationStart uint32 `kong:"default='2048',help='address of the application firmware, which nothing may be written before'"`
+	Reset            bool   `kong:"help='restart the device into the new firmware once written'"`
+}
+
+func (cmd *cmdUpdate) Run(ctx cmdContext) error {
+	firmware, err := loadFirmware(cmd.Input)
+	if err != nil {
+		return err
+	}
+
+	client := bootloader.New(ctx.Bootloader)
+	if _, err := client.Detect(); err != nil {
+		return err
+	}
+
+	_, err = client.Update(firmware, bootloader.UpdateOptions{
+		ApplicationStart: cmd.ApplicationStart,
+		Resume:           cmd.Resume,
+		Progress: func(p bootloader.Progress) {
+			ctx.Logger.Info("progress", "row", p.Row, "rows", p.Rows, "address", fmt.Sprintf("%08X", p.Address),
+				"skipped", p.Skipped)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := client.Verify(firmware); err != nil {
+		return err
+	}
+	ctx.Logger.Info("firmware written and verified")
+
+	if cmd.Reset {
+		return client.Reset()
+	}
+	return nil
+}
+
+type cmdVerify struct {
+	Input string `kong:"arg,type='existingfile',help='Intel HEX file containing the firmware'"`
+}
+
+func (cmd *cmdVerify) Run(ctx cmdContext) error {
+	firmware, err := loadFirmware(cmd.Input)
+	if err != nil {
+		return err
+	}
+
+	client := bootloader.New(ctx.Bootloader)
+	if _, err := client.Detect(); err != nil {
+		return err
+	}
+
+	if err := client.Verify(firmware); err != nil {
+		return err
+	}
+
+	ctx.Logger.Info("flash matches firmware")
+	return nil
+}
+
+type cmdReset struct{}
+
+func (cmd *cmdReset) Run(ctx cmdContext) error {
+	return bootloader.New(ctx.Bootloader).Reset()
+}
@@ -17,6 +17,11 @@ var CLI struct {
 	Port      string `kong:"arg,help='serial device port to open'"`
 	Verbosity int    `kong:"short='v',type='counter',help='increases the logging verbosity',env='VERBOSITY'"`
 	BaudRate  uint   `kong:"default='57600',help='baud rate for serial port',env='BAUDRATE'"`
+	Require   string `kong:"help='firmware version constraint the device must satisfy, e.g. >=1.0.4',env='REQUIRE'"`
+
+	Reset           bool `kong:"help='reset the device before querying it',env='RESET'"`
+	AutoBaud        bool `kong:"help='perform auto-baud if the device does not respond',env='AUTO_BAUD'"`
+	AllowUnknownSKU bool `kong:"help='allow devices reporting an unrecognised SKU',env='ALLOW_UNKNOWN_SKU'"`
 }
 
 func main() {
@@ -53,32 +58,39 @@ func errMain(logger logr.Logger) error {
 		AssumeText: true,
 	}
 
-	device := rn2483.New(rn2483.Config{
-		Serial: dbg,
+	var required *rn2483.VersionConstraint
+	if CLI.Require != "" {
+		if required, err = rn2483.ParseVersionConstraint(CLI.Require); err != nil {
+			return err
+		}
+	}
+
+	device, info, err := rn2483.Open(rn2483.Config{
+		Serial:           dbg,
+		RequiredFirmware: required,
+	}, rn2483.InitOptions{
+		Reset:                  CLI.Reset,
+		AutoBaudIfUnresponsive: CLI.AutoBaud,
+		AllowUnknownSKU:        CLI.AllowUnknownSKU,
 	})
+	if err != nil {
+		return fmt.Errorf("error initialising device: %w", err)
+	}
 	defer func() {
 		if err := device.Close(); err != nil {
 			logger.Error(err, "error closing device")
 		}
 	}()
 
-	v, err := device.GetVersion()
-	if err != nil {
-		return fmt.Errorf("error getting device version: %w", err)
-	}
+	v := info.Firmware
 	logger.Info("device version", "SKU", v.SKU, "version", v.VersionString(), "release-time", v.ReleaseTime, "is-known-sku", v.IsKnownSKU())
 
-	vdd, err := device.GetVDD()
-	if err != nil {
-		return fmt.Errorf("error getting device VDD: %w", err)
+	for _, capability := range rn2483.AllCapabilities {
+		logger.Info("firmware capability", "capability", capability, "supported", info.Capabilities.Supports(capability))
 	}
-	logger.Info("device VDD", "millivolts", vdd.Millivolts(), "volts", vdd.Volts())
 
-	hweui, err := device.GetHWEUI()
-	if err != nil {
-		return fmt.Errorf("error getting device HWEUI: %w", err)
-	}
-	logger.Info("device HWEUI", "hweui", hweui)
+	logger.Info("device VDD", "millivolts", info.VDD.Millivolts(), "volts", info.VDD.Volts())
+	logger.Info("device HWEUI", "hweui", info.HWEUI)
 
 	for _, param := range rn2483.KnownRadioParameters {
 		value, err := device.GetRadioParameter(param)
@@ -13,6 +13,7 @@ import (
 	"github.com/jacobsa/go-serial/serial"
 
 	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/nvmimage"
 )
 
 var CLI struct {
@@ -20,8 +21,11 @@ var CLI struct {
 	Verbosity int    `kong:"short='v',type='counter',help='increases the logging verbosity',env='VERBOSITY'"`
 	BaudRate  uint   `kong:"default='57600',help='baud rate for serial port',env='BAUDRATE'"`
 
-	Read  cmdRead  `kong:"cmd,help='read data from NVM'"`
-	Write cmdWrite `kong:"cmd,help='write data to NVM'"`
+	Read    cmdRead    `kong:"cmd,help='read data from NVM'"`
+	Write   cmdWrite   `kong:"cmd,help='write data to NVM'"`
+	Backup  cmdBackup  `kong:"cmd,help='save an image of all NVM data to a file'"`
+	Restore cmdRestore `kong:"cmd,help='restore NVM data from an image file'"`
+	Verify  cmdVerify  `kong:"cmd,help='check NVM data matches an image file'"`
 }
 
 type cmdContext struct {
@@ -161,3 +165,101 @@ func (cmd *cmdWrite) Run(ctx cmdContext) error {
 
 	return nil
 }
+
+func imageFormat(filename string, format nvmimage.Format) (nvmimage.Format, error) {
+	if format != "" {
+		return format, nil
+	}
+
+	return nvmimage.FormatForFilename(filename)
+}
+
+func loadImage(filename string, format nvmimage.Format) (*nvmimage.Image, error) {
+	format, err := imageFormat(filename, format)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening image file: %w", err)
+	}
+	defer f.Close()
+
+	return nvmimage.Decode(f, format)
+}
+
+type cmdBackup struct {
+	Output string          `kong:"arg,help='file to write the image to, the format is chosen by file extension (.hex, .bin or .json) unless specified'"`
+	Format nvmimage.Format `kong:"enum='hex,bin,json,',default='',help='image format, raw binary images do not record which device they were taken from',env='FORMAT'"`
+}
+
+func (cmd *cmdBackup) Run(ctx cmdContext) error {
+	format, err := imageFormat(cmd.Output, cmd.Format)
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger.Info("reading NVM")
+	image, err := nvmimage.Backup(ctx.Device)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(cmd.Output)
+	if err != nil {
+		return fmt.Errorf("error creating image file: %w", err)
+	}
+	if err := nvmimage.Encode(f, image, format); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing image file: %w", err)
+	}
+
+	ctx.Logger.Info("backup complete", "hweui", image.HWEUI, "firmware", image.FirmwareVersion, "file", cmd.Output)
+	return nil
+}
+
+type cmdRestore struct {
+	Input  string          `kong:"arg,type='existingfile',help='image file to restore'"`
+	Format nvmimage.Format `kong:"enum='hex,bin,json,',default='',help='image format, chosen by file extension if not specified',env='FORMAT'"`
+	Force  bool            `kong:"help='restore the image even if it was taken from a different or unknown device SKU'"`
+}
+
+func (cmd *cmdRestore) Run(ctx cmdContext) error {
+	image, err := loadImage(cmd.Input, cmd.Format)
+	if err != nil {
+		return err
+	}
+
+	stats, err := nvmimage.Restore(ctx.Device, image, nvmimage.RestoreOptions{
+		Force: cmd.Force,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger.Info("restore complete", "bytes-written", stats.Written, "bytes-unchanged", stats.Skipped)
+	return nil
+}
+
+type cmdVerify struct {
+	Input  string          `kong:"arg,type='existingfile',help='image file to compare against'"`
+	Format nvmimage.Format `kong:"enum='hex,bin,json,',default='',help='image format, chosen by file extension if not specified',env='FORMAT'"`
+}
+
+func (cmd *cmdVerify) Run(ctx cmdContext) error {
+	image, err := loadImage(cmd.Input, cmd.Format)
+	if err != nil {
+		return err
+	}
+
+	if err := nvmimage.Verify(ctx.Device, image); err != nil {
+		return err
+	}
+
+	ctx.Logger.Info("NVM matches image")
+	return nil
+}
@@ -0,0 +1,214 @@
+package fake
+
+import (
+	"fmt"
+
+	"github.com/omaskery/rn2483/bootloader"
+)
+
+const (
+	// flashSize is the size of the device's program memory
+	flashSize = 64 * 1024
+	// applicationStart is the address of the first byte of program memory after the bootloader
+	applicationStart = 0x0800
+	erasedFlash      = 0xFF
+)
+
+// BootloaderState holds the state of the fake device's bootloader, which runs in place of the firmware after it is
+// erased (sys eraseFW)
+type BootloaderState struct {
+	// Active is set while the bootloader is running, during which all input is treated as bootloader commands
+	Active bool
+	// Info is reported in response to requests for the bootloader's version
+	Info bootloader.Info
+	// Flash holds the device's program memory, containing the bootloader followed by the application firmware
+	Flash []byte
+	// ApplicationStart is the address of the application firmware, the bootloader refuses to modify anything before it
+	ApplicationStart uint32
+
+	// input holds bytes received that do not yet form a complete command
+	input []byte
+}
+
+func (s *BootloaderState) ensureDefaults() {
+	if s.Info == (bootloader.Info{}) {
+		s.Info = bootloader.Info{
+			Version:        0x0100,
+			MaxPacketSize:  128,
+			DeviceID:       0x5400,
+			EraseRowSize:   64,
+			WriteLatchSize: 64,
+		}
+	}
+
+	if s.ApplicationStart == 0 {
+		s.ApplicationStart = applicationStart
+	}
+
+	if s.Flash == nil {
+		// stand in for the bootloader and firmware that would be present on a real device
+		s.Flash = make([]byte, flashSize)
+		for i := range s.Flash {
+			s.Flash[i] = byte(i)
+		}
+	}
+}
+
+// enter erases the application firmware and starts the bootloader
+func (s *BootloaderState) enter() {
+	for i := s.ApplicationStart; i < uint32(len(s.Flash)); i++ {
+		s.Flash[i] = erasedFlash
+	}
+	s.input = nil
+	s.Active = true
+}
+
+// ApplicationPresent determines whether the start of the application firmware has been written, in which case the
+// device runs it in preference to the bootloader when reset
+func (s *BootloaderState) ApplicationPresent() bool {
+	start := s.Flash[s.ApplicationStart : s.ApplicationStart+uint32(s.Info.WriteLatchSize)]
+	for _, b := range start {
+		if b != erasedFlash {
+			return true
+		}
+	}
+	return false
+}
+
+// processBootloaderInput buffers input until it forms complete bootloader commands, and processes each of them
+func (d *Device) processBootloaderInput(ctx *commandContext, data []byte) error {
+	s := &d.Bootloader
+	s.input = append(s.input, data...)
+
+	for {
+		// each command is preceded by a sync byte, to which the bootloader does not respond
+		for len(s.input) > 0 && s.input[0] == bootloader.SyncByte {
+			s.input = s.input[1:]
+		}
+
+		if len(s.input) < bootloader.HeaderLength {
+			return nil
+		}
+
+		header, err := bootloader.DecodeHeader(s.input)
+		if err != nil {
+			return err
+		}
+
+		commandLength := bootloader.HeaderLength
+		if header.Command == bootloader.CommandWriteFlash {
+			commandLength += int(header.Length)
+		}
+		if len(s.input) < commandLength {
+			return nil
+		}
+
+		payload := s.input[bootloader.HeaderLength:commandLength]
+		s.input = s.input[commandLength:]
+
+		ctx.logger.Info("bootloader command received", "command", header.Command, "address", header.Address,
+			"length", header.Length)
+		if err := d.processBootloaderCommand(ctx, header, payload); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *Device) processBootloaderCommand(ctx *commandContext, header bootloader.Header, payload []byte) error {
+	s := &d.Bootloader
+
+	switch header.Command {
+	case bootloader.CommandReadVersion:
+		return writeBootloaderResponse(ctx, header, s.Info.Encode())
+	case bootloader.CommandReadFlash:
+		// there is no way to report a failed read, so the status is written in place of the data, which leaves the
+		// host waiting for the rest of the response
+		if status := s.checkAccess(header, false); status != bootloader.StatusSuccess {
+			return writeBootloaderStatus(ctx, header, status)
+		}
+		return writeBootloaderResponse(ctx, header, s.Flash[header.Address:header.Address+uint32(header.Length)])
+	case bootloader.CommandWriteFlash:
+		status := s.checkAccess(header, true)
+		if status == bootloader.StatusSuccess && (header.Address%uint32(s.Info.WriteLatchSize) != 0 ||
+			header.Length%uint16(s.Info.WriteLatchSize) != 0) {
+			status = bootloader.StatusAddressError
+		}
+		if status == bootloader.StatusSuccess {
+			// as with real flash, writing can only clear bits, so rows must be erased before they are written
+			for i, b := range payload {
+				s.Flash[header.Address+uint32(i)] &= b
+			}
+		}
+		return writeBootloaderStatus(ctx, header, status)
+	case bootloader.CommandEraseFlash:
+		rowSize := uint32(s.Info.EraseRowSize)
+		erase := header
+		erase.Length = 0
+		status := s.checkAccess(erase, true)
+		end := header.Address + uint32(header.Length)*rowSize
+		if status == bootloader.StatusSuccess && (header.Address%rowSize != 0 || end > uint32(len(s.Flash))) {
+			status = bootloader.StatusAddressError
+		}
+		if status == bootloader.StatusSuccess {
+			for i := header.Address; i < end; i++ {
+				s.Flash[i] = erasedFlash
+			}
+		}
+		return writeBootloaderStatus(ctx, header, status)
+	case bootloader.CommandCalculateChecksum:
+		if header.Address+uint32(header.Length) > uint32(len(s.Flash)) {
+			return writeBootloaderStatus(ctx, header, bootloader.StatusAddressError)
+		}
+		checksum := bootloader.Checksum(s.Flash[header.Address : header.Address+uint32(header.Length)])
+		return writeBootloaderResponse(ctx, header, []byte{byte(checksum), byte(checksum >> 8)})
+	case bootloader.CommandReset:
+		if err := writeBootloaderStatus(ctx, header, bootloader.StatusSuccess); err != nil {
+			return err
+		}
+		if !s.ApplicationPresent() {
+			ctx.logger.Info("no application firmware, remaining in bootloader")
+			return nil
+		}
+		s.Active = false
+		d.reset()
+		// discard any break signalled by the binary commands, so that it is not mistaken for one sent later
+		select {
+		case <-d.breaks:
+		default:
+		}
+		return ctx.writeResponse(d.Sys.FirmwareVersion)
+	default:
+		return writeBootloaderStatus(ctx, header, bootloader.StatusUnsupported)
+	}
+}
+
+// checkAccess validates the region of flash accessed by a command, which must fit within a single packet and within
+// flash, and if it modifies flash, must be unlocked and must not overwrite the bootloader
+func (s *BootloaderState) checkAccess(header bootloader.Header, modifies bool) bootloader.Status {
+	switch {
+	case modifies && !header.Unlocked:
+		return bootloader.StatusLocked
+	case header.Length > s.Info.MaxPacketSize:
+		return bootloader.StatusLengthError
+	case header.Address+uint32(header.Length) > uint32(len(s.Flash)):
+		return bootloader.StatusAddressError
+	case modifies && header.Address < s.ApplicationStart:
+		return bootloader.StatusAddressError
+	default:
+		return bootloader.StatusSuccess
+	}
+}
+
+// writeBootloaderResponse writes the response to a bootloader command, which begins with the command's header
+func writeBootloaderResponse(ctx *commandContext, header bootloader.Header, data []byte) error {
+	response := append(header.Encode(), data...)
+	ctx.logger.Info("writing bootloader response", "length", len(response))
+	if _, err := ctx.responseWriter.Write(response); err != nil {
+		return fmt.Errorf("error writing bootloader response: %w", err)
+	}
+	return nil
+}
+
+func writeBootloaderStatus(ctx *commandContext, header bootloader.Header, status bootloader.Status) error {
+	return writeBootloaderResponse(ctx, header, []byte{byte(status)})
+}
@@ -1,12 +1,13 @@
 package fake
 
 import (
-	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"strings"
 
 	"github.com/go-logr/logr"
+	"github.com/jonboulle/clockwork"
 	"go.uber.org/multierr"
 
 	"github.com/omaskery/rn2483"
@@ -15,9 +16,15 @@ import (
 // Device is a fake RN2483, satisfying the io.ReadWriteCloser interface expected by rn2483.Device for its serial device
 type Device struct {
 	logger  logr.Logger
+	clock   clockwork.Clock
 	writer  *io.PipeWriter
 	reader  *io.PipeReader
 	stopped chan error
+	faults  FaultInjector
+	breaks  chan struct{}
+
+	updates  chan func()
+	finished chan struct{}
 
 	// Sys is state of the device as relevent to sys commands
 	Sys SysState
@@ -25,16 +32,24 @@ type Device struct {
 	Mac MacState
 	// Radio is state of the device as relevent to radio commands
 	Radio RadioState
+	// Bootloader is the state of the bootloader, which runs in place of the firmware once it is erased
+	Bootloader BootloaderState
 }
 
 type commandContext struct {
 	logger         logr.Logger
 	command        string
 	responseWriter *io.PipeWriter
+
+	// truncate causes only the first half of each response line to be written
+	truncate bool
 }
 
 func (c *commandContext) writeResponse(format string, a ...interface{}) error {
 	response := fmt.Sprintf(format, a...)
+	if c.truncate {
+		response = response[:len(response)/2]
+	}
 	c.logger.Info("writing response", "response", response)
 	if _, err := fmt.Fprintf(c.responseWriter, "%s\r\n", response); err != nil {
 		return fmt.Errorf("error writing command response: %w", err)
@@ -43,27 +58,98 @@ func (c *commandContext) writeResponse(format string, a ...interface{}) error {
 }
 
 func (d *Device) run(commandReader *io.PipeReader, responseWriter *io.PipeWriter) error {
-	scanner := bufio.NewScanner(commandReader)
+	input := make(chan uartToken, inputBufferSize)
+	done := make(chan struct{})
+	defer close(done)
+	go d.receive(commandReader, input, done)
 
 	ctx := commandContext{
 		logger:         d.logger.V(1),
 		responseWriter: responseWriter,
 	}
 
-	for scanner.Scan() {
-		ctx.command = scanner.Text()
+	awaitingSync := false
+	var partialLine []byte
+	for {
+		var token uartToken
+		select {
+		case update := <-d.updates:
+			update()
+			continue
+		case received, ok := <-input:
+			if !ok {
+				return nil
+			}
+			token = received
+		}
+
+		if d.Bootloader.Active {
+			partialLine = nil
+			if err := d.processBootloaderInput(&ctx, token.raw); err != nil {
+				return fmt.Errorf("error processing bootloader input: %w", err)
+			}
+			continue
+		}
+
+		if token.partial {
+			partialLine = append(partialLine, token.raw...)
+			continue
+		}
+		if len(partialLine) > 0 && !token.isBreak {
+			token.line = string(bytes.TrimRight(append(partialLine, token.raw...), "\r\n"))
+		}
+		partialLine = nil
+
+		if token.isBreak {
+			ctx.logger.Info("break received")
+			awaitingSync = true
+			continue
+		}
+
+		ctx.command = token.line
+		ctx.truncate = false
+
+		if awaitingSync {
+			awaitingSync = false
+			if len(ctx.command) > 0 && ctx.command[0] == syncCharacter {
+				ctx.logger.Info("auto-baud completed")
+				d.Sys.BaudMismatch = false
+				ctx.command = strings.TrimLeft(ctx.command, string(rune(syncCharacter)))
+				if ctx.command == "" {
+					continue
+				}
+			}
+		}
+
+		if d.Sys.BaudMismatch {
+			if err := ctx.writeResponse("%s", garbledResponse); err != nil {
+				return err
+			}
+			continue
+		}
 
 		if err := d.processCommand(&ctx); err != nil {
 			return fmt.Errorf("error processing command '%s': %w", ctx.command, err)
 		}
 	}
-
-	return nil
 }
 
 func (d *Device) processCommand(ctx *commandContext) error {
 	ctx.logger.Info("command received", "command", ctx.command)
 
+	if d.faults != nil {
+		if fault := d.faults(ctx.command); fault != nil {
+			if handled, err := d.applyFault(ctx, fault); handled || err != nil {
+				return err
+			}
+		}
+	}
+
+	if !d.supports(ctx.command) {
+		ctx.logger.Info("command not supported by firmware version", "version", d.Sys.FirmwareVersion)
+		return invalidParam(ctx)
+	}
+
 	tokens := strings.Split(ctx.command, " ")
 	if len(tokens) < 1 {
 		return invalidParam(ctx)
@@ -81,9 +167,40 @@ func (d *Device) processCommand(ctx *commandContext) error {
 	}
 }
 
+// commandCapabilities maps commands to the capability a device's firmware must have to support them
+var commandCapabilities = map[string]rn2483.Capability{
+	"sys set pinmode":   rn2483.CapabilityGPIOInput,
+	"sys get pindig":    rn2483.CapabilityGPIOInput,
+	"sys get pinana":    rn2483.CapabilityGPIOInput,
+	"radio get rssi":    rn2483.CapabilityRadioRSSI,
+	"radio get pktrssi": rn2483.CapabilityPacketRSSI,
+	"mac set class c":   rn2483.CapabilityClassC,
+}
+
+// supports determines whether the command is supported by the fake device's firmware version
+func (d *Device) supports(command string) bool {
+	version, err := rn2483.ParseFirmwareVersion(d.Sys.FirmwareVersion)
+	if err != nil {
+		return true
+	}
+
+	for prefix, capability := range commandCapabilities {
+		if command == prefix || strings.HasPrefix(command, prefix+" ") {
+			return rn2483.CapabilitiesOf(version).Supports(capability)
+		}
+	}
+
+	return true
+}
+
 // Config allows for configuring the fake Device's behaviour
 type Config struct {
 	Logger logr.Logger
+	// Clock is used for all timing within the fake device (MAC pauses, receive windows, watchdog timeouts, etc.),
+	// defaulting to the real clock. Providing a clockwork.FakeClock allows tests to advance time deterministically.
+	Clock clockwork.Clock
+	// Faults is consulted for every command received, allowing misbehaviour to be injected for testing error handling
+	Faults FaultInjector
 }
 
 // New creates a new fake RN2483 device
@@ -93,22 +210,37 @@ func New(cfg Config) *Device {
 		logger = cfg.Logger
 	}
 
+	clock := cfg.Clock
+	if clock == nil {
+		clock = clockwork.NewRealClock()
+	}
+
 	commandReader, commandWriter := io.Pipe()
 	responseReader, responseWriter := io.Pipe()
 
 	d := &Device{
 		logger:  logger,
+		clock:   clock,
+		faults:  cfg.Faults,
+		breaks:  make(chan struct{}, 1),
 		writer:  commandWriter,
 		reader:  responseReader,
 		stopped: make(chan error),
+
+		updates:  make(chan func()),
+		finished: make(chan struct{}),
 	}
 
+	d.Mac.clock = clock
+
 	d.Sys.ensureDefaults()
 	d.Mac.ensureDefaults()
 	d.Radio.ensureDefaults()
+	d.Bootloader.ensureDefaults()
 
 	go func() {
 		err := d.run(commandReader, responseWriter)
+		close(d.finished)
 		if closeErr := responseWriter.Close(); closeErr != nil {
 			err = multierr.Combine(err, closeErr)
 		}
@@ -130,6 +262,34 @@ func NewFakeDevice(cfg Config) (*Device, *rn2483.Device) {
 	return fake, device
 }
 
+// Update runs f on the fake device's goroutine between commands, allowing its state to be safely modified while the
+// device is in use by another goroutine (e.g. changing the level of a digital input while it is being polled)
+func (d *Device) Update(f func(d *Device)) {
+	done := make(chan struct{})
+	update := func() {
+		defer close(done)
+		f(d)
+	}
+
+	select {
+	case d.updates <- update:
+		<-done
+	case <-d.finished:
+		f(d)
+	}
+}
+
+// reset reverts all non-persisted state, as happens when the device is reset
+func (d *Device) reset() {
+	d.Mac.ensureDefaults()
+	d.Radio.ensureDefaults()
+}
+
+// Clock returns the clock used for all timing within the fake device
+func (d *Device) Clock() clockwork.Clock {
+	return d.clock
+}
+
 var _ io.ReadWriteCloser = (*Device)(nil)
 
 // Read implements the io.ReadWriteCloser interface
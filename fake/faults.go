@@ -0,0 +1,147 @@
+package fake
+
+import (
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// FaultKind identifies a kind of misbehaviour that can be injected into the fake device
+type FaultKind int
+
+const (
+	// FaultBusy responds with "busy" instead of processing the command
+	FaultBusy FaultKind = iota + 1
+	// FaultInvalidParam responds with "invalid_param" instead of processing the command
+	FaultInvalidParam
+	// FaultGarbage responds with a line of garbage instead of processing the command
+	FaultGarbage
+	// FaultTruncated processes the command normally, but only the first half of each response line is sent
+	FaultTruncated
+	// FaultDelay waits for Fault.Delay before processing the command normally
+	FaultDelay
+	// FaultNoResponse silently discards the command, never responding
+	FaultNoResponse
+	// FaultResetBanner simulates a spontaneous reset (e.g. a brownout): the command is discarded, non-persisted state
+	// is reverted and the firmware version banner is printed
+	FaultResetBanner
+	// FaultRadioErr accepts the command with "ok" and then immediately reports "radio_err", intended for use with
+	// commands that produce a deferred response such as radio tx and radio rx
+	FaultRadioErr
+	// FaultResetBeforeCommand simulates a spontaneous reset while the device was idle: non-persisted state is reverted
+	// and the firmware version banner is printed, then the command is processed normally
+	FaultResetBeforeCommand
+)
+
+// Fault describes misbehaviour to inject in place of the normal processing of a command
+type Fault struct {
+	Kind FaultKind
+
+	// Delay is how long to wait before processing the command, used by FaultDelay
+	Delay time.Duration
+	// Garbage is the data sent instead of a response, used by FaultGarbage. Random data is sent if left empty.
+	Garbage []byte
+}
+
+// A FaultInjector is consulted for every command received by the fake device, returning the Fault to inject or nil
+// to process the command normally
+type FaultInjector func(command string) *Fault
+
+// FaultRule describes when to inject a Fault, for use with InjectFaults
+type FaultRule struct {
+	// Pattern selects the commands this rule applies to, nil matches all commands
+	Pattern *regexp.Regexp
+	// Fault is the fault to inject when this rule applies
+	Fault Fault
+	// Probability is the chance (between 0 and 1) of this rule applying to a matching command, zero is treated as the
+	// rule always applying
+	Probability float64
+	// Limit is the maximum number of times this rule will apply, zero is treated as no limit
+	Limit int
+}
+
+// InjectFaults creates a FaultInjector from a list of rules, applying the first rule that matches each command.
+// Random decisions (probabilistic rules and generated garbage) are made using the given seed, so that a sequence of
+// commands always results in the same sequence of faults.
+func InjectFaults(seed int64, rules ...FaultRule) FaultInjector {
+	var lock sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	applied := make([]int, len(rules))
+
+	return func(command string) *Fault {
+		lock.Lock()
+		defer lock.Unlock()
+
+		for i, rule := range rules {
+			if rule.Pattern != nil && !rule.Pattern.MatchString(command) {
+				continue
+			}
+			if rule.Limit > 0 && applied[i] >= rule.Limit {
+				continue
+			}
+			if rule.Probability > 0 && rng.Float64() >= rule.Probability {
+				continue
+			}
+
+			applied[i]++
+
+			fault := rule.Fault
+			if fault.Kind == FaultGarbage && len(fault.Garbage) < 1 {
+				fault.Garbage = randomGarbage(rng)
+			}
+
+			return &fault
+		}
+
+		return nil
+	}
+}
+
+// randomGarbage produces data resembling a response received at the wrong baud rate, avoiding line terminators
+func randomGarbage(rng *rand.Rand) []byte {
+	garbage := make([]byte, 4+rng.Intn(12))
+	for i := range garbage {
+		garbage[i] = byte(0x80 + rng.Intn(0x7F))
+	}
+	return garbage
+}
+
+// applyFault injects the given fault, returning true if the command has been fully handled
+func (d *Device) applyFault(ctx *commandContext, fault *Fault) (bool, error) {
+	ctx.logger.Info("injecting fault", "command", ctx.command, "kind", fault.Kind)
+
+	switch fault.Kind {
+	case FaultBusy:
+		return true, ctx.writeResponse("busy")
+	case FaultInvalidParam:
+		return true, invalidParam(ctx)
+	case FaultGarbage:
+		garbage := fault.Garbage
+		if len(garbage) < 1 {
+			garbage = randomGarbage(rand.New(rand.NewSource(rand.Int63())))
+		}
+		return true, ctx.writeResponse("%s", garbage)
+	case FaultTruncated:
+		ctx.truncate = true
+		return false, nil
+	case FaultDelay:
+		d.clock.Sleep(fault.Delay)
+		return false, nil
+	case FaultNoResponse:
+		return true, nil
+	case FaultResetBanner:
+		d.reset()
+		return true, ctx.writeResponse(d.Sys.FirmwareVersion)
+	case FaultRadioErr:
+		if err := ok(ctx); err != nil {
+			return true, err
+		}
+		return true, ctx.writeResponse("radio_err")
+	case FaultResetBeforeCommand:
+		d.reset()
+		return false, ctx.writeResponse(d.Sys.FirmwareVersion)
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,176 @@
+package fake_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jonboulle/clockwork"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+type testContext struct {
+	logger logr.Logger
+	clock  clockwork.FakeClock
+}
+
+func (c *testContext) newDevice(t *testing.T, rules ...fake.FaultRule) (*fake.Device, *rn2483.Device) {
+	f, d := fake.NewFakeDevice(fake.Config{
+		Logger: c.logger.WithName("fake-device"),
+		Clock:  c.clock,
+		Faults: fake.InjectFaults(1, rules...),
+	})
+	t.Cleanup(func() {
+		_ = d.Close()
+	})
+	return f, d
+}
+
+func TestFaults(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		return t, &testContext{
+			logger: testutils.CreateTestLogger(t),
+			clock:  clockwork.NewFakeClock(),
+		}
+	})
+
+	o.Spec("busy is reported for matching commands until the limit is reached", func(t *testing.T, ctx *testContext) {
+		_, d := ctx.newDevice(t, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio set pwr"),
+			Fault:   fake.Fault{Kind: fake.FaultBusy},
+			Limit:   1,
+		})
+
+		Expect(t, d.SetRadioPower(5)).To(testutils.MatchError(rn2483.ErrTransceiverBusy))
+		Expect(t, d.SetRadioPower(5)).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("non-matching commands are processed normally", func(t *testing.T, ctx *testContext) {
+		_, d := ctx.newDevice(t, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio set pwr"),
+			Fault:   fake.Fault{Kind: fake.FaultInvalidParam},
+		})
+
+		_, err := d.GetVersion()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, d.SetRadioPower(5)).To(testutils.MatchError(rn2483.ErrInvalidParam))
+	})
+
+	o.Spec("garbage responses are reported as unknown", func(t *testing.T, ctx *testContext) {
+		_, d := ctx.newDevice(t, fake.FaultRule{
+			Fault: fake.Fault{Kind: fake.FaultGarbage, Garbage: []byte("\xf0\xf8\xfe")},
+		})
+
+		Expect(t, d.SetRadioPower(5)).To(testutils.MatchError(rn2483.ErrUnknown))
+	})
+
+	o.Spec("truncated responses fail to parse", func(t *testing.T, ctx *testContext) {
+		_, d := ctx.newDevice(t, fake.FaultRule{
+			Fault: fake.Fault{Kind: fake.FaultTruncated},
+		})
+
+		_, err := d.GetVersion()
+		Expect(t, err).To(HaveOccurred())
+	})
+
+	o.Spec("delayed responses arrive once the delay elapses", func(t *testing.T, ctx *testContext) {
+		_, d := ctx.newDevice(t, fake.FaultRule{
+			Fault: fake.Fault{Kind: fake.FaultDelay, Delay: time.Second},
+		})
+
+		errChan := make(chan error)
+		go func() {
+			_, err := d.GetVersion()
+			errChan <- err
+		}()
+
+		ctx.clock.BlockUntil(1)
+		select {
+		case <-errChan:
+			t.Fatalf("response arrived before the delay elapsed")
+		default:
+		}
+
+		ctx.clock.Advance(time.Second)
+		Expect(t, <-errChan).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("missing responses are never sent", func(t *testing.T, ctx *testContext) {
+		f, d := ctx.newDevice(t, fake.FaultRule{
+			Fault: fake.Fault{Kind: fake.FaultNoResponse},
+		})
+
+		errChan := make(chan error)
+		go func() {
+			_, err := d.GetVersion()
+			errChan <- err
+		}()
+
+		select {
+		case <-errChan:
+			t.Fatalf("response arrived unexpectedly")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		Expect(t, f.Close()).To(Not(HaveOccurred()))
+		Expect(t, <-errChan).To(HaveOccurred())
+	})
+
+	o.Spec("spurious resets print a banner and revert state", func(t *testing.T, ctx *testContext) {
+		f, d := ctx.newDevice(t, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio set pwr"),
+			Fault:   fake.Fault{Kind: fake.FaultResetBanner},
+		})
+
+		_, err := d.PauseMAC()
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		Expect(t, d.SetRadioPower(5)).To(testutils.MatchError(rn2483.ErrUnexpectedReset))
+		Expect(t, f.Mac.IsPaused()).To(BeFalse())
+	})
+
+	o.Spec("radio errors are reported by transmissions", func(t *testing.T, ctx *testContext) {
+		_, d := ctx.newDevice(t, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio tx"),
+			Fault:   fake.Fault{Kind: fake.FaultRadioErr},
+		})
+
+		Expect(t, d.RadioTx([]byte("hello"))).To(testutils.MatchError(rn2483.ErrTransmitTimeout))
+	})
+
+	o.Spec("probabilistic faults are deterministic for a given seed", func(t *testing.T, ctx *testContext) {
+		rule := fake.FaultRule{
+			Fault:       fake.Fault{Kind: fake.FaultGarbage},
+			Probability: 0.5,
+		}
+
+		sequence := func() (faults []*fake.Fault) {
+			injector := fake.InjectFaults(42, rule)
+			for i := 0; i < 32; i++ {
+				faults = append(faults, injector("sys get ver"))
+			}
+			return
+		}
+
+		first := sequence()
+		Expect(t, first).To(Equal(sequence()))
+
+		injected := 0
+		for _, f := range first {
+			if f != nil {
+				injected++
+			}
+		}
+		Expect(t, injected).To(And(BeAbove(0), BeBelow(32)))
+	})
+}
@@ -2,6 +2,8 @@ package fake
 
 import (
 	"time"
+
+	"github.com/jonboulle/clockwork"
 )
 
 var (
@@ -13,21 +15,30 @@ var (
 type MacState struct {
 	// PausedUntil represents when, if paused, the MAC layer will un-pause
 	PausedUntil *time.Time
+
+	clock clockwork.Clock
 }
 
 // IsPaused determines whether the MAC layer is currently paused
 func (m *MacState) IsPaused() bool {
-	return m.PausedUntil != nil && m.PausedUntil.After(time.Now())
+	return m.PausedUntil != nil && m.PausedUntil.After(m.now())
 }
 
 // Pause pauses the MAC layer, allowing for direct access to radio commands, returning the duration it will be paused for
 func (m *MacState) Pause() time.Duration {
 	pauseDuration := MaxPauseDuration
-	pausedUntil := time.Now().Add(MaxPauseDuration)
+	pausedUntil := m.now().Add(MaxPauseDuration)
 	m.PausedUntil = &pausedUntil
 	return pauseDuration
 }
 
+func (m *MacState) now() time.Time {
+	if m.clock == nil {
+		return time.Now()
+	}
+	return m.clock.Now()
+}
+
 func (m *MacState) ensureDefaults() {
 	m.PausedUntil = nil
 }
@@ -0,0 +1,135 @@
+//go:build linux
+// +build linux
+
+// Package pty serves a device (typically a fake.Device) on a pseudo-terminal, allowing programs that expect a serial
+// port to be pointed at it in place of real hardware
+package pty
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/multierr"
+	"golang.org/x/sys/unix"
+
+	"github.com/omaskery/rn2483/internal/termios"
+)
+
+// Config configures a Server
+type Config struct {
+	Logger logr.Logger
+	// Device is served on the pseudo-terminal, data written to the terminal is written to the device and vice versa
+	Device io.ReadWriteCloser
+}
+
+// Server serves a device on a pseudo-terminal
+type Server struct {
+	logger logr.Logger
+	device io.ReadWriteCloser
+	master *os.File
+	slave  *os.File
+	path   string
+
+	wg sync.WaitGroup
+}
+
+// Serve allocates a new pseudo-terminal and begins serving the configured device on it
+func Serve(cfg Config) (*Server, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = logr.Discard()
+	}
+
+	if cfg.Device == nil {
+		return nil, errors.New("no device provided to serve")
+	}
+
+	master, path, err := openMaster()
+	if err != nil {
+		return nil, err
+	}
+
+	// holding the slave open ourselves prevents reads of the master failing whenever the last client disconnects
+	slave, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, multierr.Combine(fmt.Errorf("error opening pseudo-terminal slave: %w", err), master.Close())
+	}
+
+	if err := termios.MakeRaw(slave); err != nil {
+		return nil, multierr.Combine(err, slave.Close(), master.Close())
+	}
+
+	s := &Server{
+		logger: cfg.Logger,
+		device: cfg.Device,
+		master: master,
+		slave:  slave,
+		path:   path,
+	}
+
+	s.wg.Add(2)
+	go s.pump("terminal->device", s.device, s.master)
+	go s.pump("device->terminal", s.master, s.device)
+
+	s.logger.Info("serving device on pseudo-terminal", "path", path)
+
+	return s, nil
+}
+
+func openMaster() (*os.File, string, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("error opening pseudo-terminal master: %w", err)
+	}
+
+	err = termios.Control(master, func(fd int) error {
+		return unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0)
+	})
+	if err != nil {
+		return nil, "", multierr.Combine(fmt.Errorf("error unlocking pseudo-terminal: %w", err), master.Close())
+	}
+
+	var number uint32
+	err = termios.Control(master, func(fd int) (err error) {
+		number, err = unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+		return
+	})
+	if err != nil {
+		return nil, "", multierr.Combine(fmt.Errorf("error getting pseudo-terminal number: %w", err), master.Close())
+	}
+
+	return master, fmt.Sprintf("/dev/pts/%d", number), nil
+}
+
+func (s *Server) pump(name string, dst io.Writer, src io.Reader) {
+	defer s.wg.Done()
+
+	n, err := io.Copy(dst, src)
+	if err != nil && !errors.Is(err, os.ErrClosed) && !errors.Is(err, io.ErrClosedPipe) {
+		s.logger.Error(err, "error copying data", "direction", name, "bytes", n)
+	} else {
+		s.logger.V(1).Info("finished copying data", "direction", name, "bytes", n)
+	}
+
+	// if the destination was closed first then keep draining the source, so the other side is never left blocked
+	_, _ = io.Copy(io.Discard, src)
+}
+
+// Path is the path of the pseudo-terminal device that clients should open, e.g. /dev/pts/3
+func (s *Server) Path() string {
+	return s.path
+}
+
+// Close stops serving the device, closing the device and the pseudo-terminal
+func (s *Server) Close() error {
+	err := multierr.Combine(
+		s.master.Close(),
+		s.device.Close(),
+	)
+	s.wg.Wait()
+
+	return multierr.Combine(err, s.slave.Close())
+}
@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+package pty_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/fake/pty"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+func TestPTY(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *pty.Server) {
+		logger := testutils.CreateTestLogger(t)
+
+		server, err := pty.Serve(pty.Config{
+			Logger: logger.WithName("pty"),
+			Device: fake.New(fake.Config{
+				Logger: logger.WithName("fake-device"),
+			}),
+		})
+		if err != nil {
+			t.Skipf("unable to allocate pseudo-terminal: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := server.Close(); err != nil {
+				logger.Error(err, "error closing pty server")
+			}
+		})
+
+		return t, server
+	})
+
+	o.Spec("can talk to the fake device through the pseudo-terminal", func(t *testing.T, server *pty.Server) {
+		terminal, err := os.OpenFile(server.Path(), os.O_RDWR|syscall.O_NOCTTY, 0)
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		d := rn2483.New(rn2483.Config{
+			Serial: terminal,
+		})
+		defer d.Close()
+
+		version, err := d.GetVersion()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, version.IsKnownSKU()).To(BeTrue())
+
+		Expect(t, d.SetRadioPower(3)).To(Not(HaveOccurred()))
+		power, err := d.GetRadioPower()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, power).To(Equal(3))
+	})
+}
@@ -3,6 +3,7 @@ package fake
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/omaskery/rn2483"
@@ -15,6 +16,8 @@ type RadioState struct {
 
 	// WatchDogTimer is how long a radio operation will last before timing out
 	WatchDogTimer time.Duration
+	// Parameters holds the raw values of all other radio parameters, as reported by radio get
+	Parameters map[string]string
 
 	// Tx is a callback invoked when the radio is asked to transmit a packet of data
 	Tx func(d *Device, packet []byte) error
@@ -27,6 +30,66 @@ type RadioState struct {
 func (r *RadioState) ensureDefaults() {
 	r.Power = 10
 	r.WatchDogTimer = 15 * time.Second
+	r.Parameters = map[string]string{
+		"bt":      "0.5",
+		"mod":     "lora",
+		"freq":    "868100000",
+		"sf":      "sf12",
+		"afcbw":   "41.7",
+		"rxbw":    "25",
+		"bitrate": "50000",
+		"fdev":    "25000",
+		"prlen":   "8",
+		"crc":     "on",
+		"iqi":     "off",
+		"cr":      "4/5",
+		"bw":      "125",
+		"snr":     "-128",
+		"rssi":    "-110",
+		"pktrssi": "-128",
+	}
+}
+
+func oneOf(options ...string) func(string) bool {
+	return func(value string) bool {
+		for _, option := range options {
+			if value == option {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func intInRange(min, max int64) func(string) bool {
+	return func(value string) bool {
+		v, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && v >= min && v <= max
+	}
+}
+
+var receiveBandwidths = []string{
+	"250", "125", "62.5", "31.3", "15.6", "7.8", "3.9", "200", "100", "50", "25", "12.5", "6.3", "3.1", "166.7",
+	"83.3", "41.7", "20.8", "10.4", "5.2", "2.6",
+}
+
+// radioParameterValidators determines which values are accepted by radio set for each settable parameter
+var radioParameterValidators = map[string]func(string) bool{
+	"bt":  oneOf("none", "1.0", "0.5", "0.3"),
+	"mod": oneOf("lora", "fsk"),
+	"freq": func(value string) bool {
+		return intInRange(433050000, 434790000)(value) || intInRange(863000000, 870000000)(value)
+	},
+	"sf":      oneOf("sf7", "sf8", "sf9", "sf10", "sf11", "sf12"),
+	"afcbw":   oneOf(receiveBandwidths...),
+	"rxbw":    oneOf(receiveBandwidths...),
+	"bitrate": intInRange(1, 300000),
+	"fdev":    intInRange(0, 200000),
+	"prlen":   intInRange(0, 65535),
+	"crc":     oneOf("on", "off"),
+	"iqi":     oneOf("on", "off"),
+	"cr":      oneOf("4/5", "4/6", "4/7", "4/8"),
+	"bw":      oneOf("125", "250", "500"),
 }
 
 func (d *Device) processRadioCommand(ctx *commandContext, params []string) error {
@@ -107,7 +170,7 @@ func (d *Device) processRadioRxCommand(ctx *commandContext, params []string) err
 	case 0:
 		timeoutChannel = nil
 	default:
-		timeoutChannel = time.After(timeoutDuration)
+		timeoutChannel = d.clock.After(timeoutDuration)
 	}
 
 	select {
@@ -126,8 +189,14 @@ func (d *Device) processRadioGetCommand(ctx *commandContext, params []string) er
 	switch params[0] {
 	case "pwr":
 		return ctx.writeResponse("%d", d.Radio.Power)
+	case "wdt":
+		return ctx.writeResponse("%d", d.Radio.WatchDogTimer.Milliseconds())
 	default:
-		return invalidParam(ctx)
+		value, ok := d.Radio.Parameters[params[0]]
+		if !ok {
+			return invalidParam(ctx)
+		}
+		return ctx.writeResponse(value)
 	}
 }
 
@@ -147,10 +216,34 @@ func (d *Device) processRadioSetCommand(ctx *commandContext, params []string) er
 			return invalidParam(ctx)
 		}
 
+		minPower, maxPower := -3, 15
+		if strings.HasPrefix(d.Sys.FirmwareVersion, string(rn2483.DeviceRN2903)) {
+			minPower, maxPower = 2, 20
+		}
+		if power < minPower || power > maxPower {
+			return invalidParam(ctx)
+		}
+
 		d.Radio.Power = power
 
+		return ok(ctx)
+	case "wdt":
+		if len(params) < 2 || !intInRange(0, 4294967295)(params[1]) {
+			return invalidParam(ctx)
+		}
+
+		milliseconds, _ := strconv.ParseInt(params[1], 10, 64)
+		d.Radio.WatchDogTimer = time.Duration(milliseconds) * time.Millisecond
+
 		return ok(ctx)
 	default:
-		return invalidParam(ctx)
+		validator, known := radioParameterValidators[params[0]]
+		if !known || len(params) < 2 || !validator(params[1]) {
+			return invalidParam(ctx)
+		}
+
+		d.Radio.Parameters[params[0]] = params[1]
+
+		return ok(ctx)
 	}
 }
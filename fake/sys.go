@@ -3,6 +3,8 @@ package fake
 import (
 	"fmt"
 	"math/rand"
+	"strconv"
+	"time"
 
 	"github.com/omaskery/rn2483"
 )
@@ -11,9 +13,22 @@ import (
 type SysState struct {
 	// FirmwareVersion is the raw version information returned by several sys commands
 	FirmwareVersion string
+	// HWEUI is the preprogrammed EUI node address reported by the device
+	HWEUI string
+
+	// BaudMismatch simulates the host using a different baud rate to the device: commands are not understood and
+	// responses are garbled, until the host performs auto-baud (a break followed by 0x55) to resynchronise
+	BaudMismatch bool
 
 	// GPIO holds the current state of all GPIO outputs
 	GPIO map[rn2483.PinName]bool
+	// PinModes holds the configured mode of all GPIO pins
+	PinModes map[rn2483.PinName]rn2483.PinMode
+	// DigitalInputs holds the level applied to each GPIO pin, as read when configured as a digital input
+	DigitalInputs map[rn2483.PinName]bool
+	// AnalogInputs holds the value applied to each analog capable GPIO pin (0-1023), as read when configured as an
+	// analog input
+	AnalogInputs map[rn2483.PinName]rn2483.AnalogValue
 	// NVM holds the current state of all user NVM data
 	NVM []byte
 }
@@ -23,6 +38,10 @@ func (s *SysState) ensureDefaults() {
 		s.FirmwareVersion = "RN2483 1.0.4 Mar 23 1991 13:37:00"
 	}
 
+	if s.HWEUI == "" {
+		s.HWEUI = "0004A30B001C0530"
+	}
+
 	if s.GPIO == nil {
 		s.GPIO = map[rn2483.PinName]bool{}
 		for _, pin := range rn2483.AllPins {
@@ -30,6 +49,27 @@ func (s *SysState) ensureDefaults() {
 		}
 	}
 
+	if s.PinModes == nil {
+		s.PinModes = map[rn2483.PinName]rn2483.PinMode{}
+		for _, pin := range rn2483.AllPins {
+			s.PinModes[pin] = rn2483.PinModeDigitalOutput
+		}
+	}
+
+	if s.DigitalInputs == nil {
+		s.DigitalInputs = map[rn2483.PinName]bool{}
+		for _, pin := range rn2483.AllPins {
+			s.DigitalInputs[pin] = false
+		}
+	}
+
+	if s.AnalogInputs == nil {
+		s.AnalogInputs = map[rn2483.PinName]rn2483.AnalogValue{}
+		for _, pin := range rn2483.AnalogPins {
+			s.AnalogInputs[pin] = 0
+		}
+	}
+
 	if s.NVM == nil {
 		s.NVM = make([]byte, rn2483.UserNVMLength)
 		for i := range s.NVM {
@@ -77,12 +117,49 @@ func (d *Device) processSysCommand(ctx *commandContext, params []string) error {
 	case "set":
 		return d.processSysSetCommand(ctx, params[1:])
 	case "reset":
+		d.reset()
 		return ctx.writeResponse(d.Sys.FirmwareVersion)
+	case "sleep":
+		return d.processSysSleepCommand(ctx, params[1:])
+	case "eraseFW":
+		// the device restarts into the bootloader without responding
+		d.Bootloader.enter()
+		return nil
 	default:
 		return invalidParam(ctx)
 	}
 }
 
+func (d *Device) processSysSleepCommand(ctx *commandContext, params []string) error {
+	if len(params) < 1 {
+		return invalidParam(ctx)
+	}
+
+	milliseconds, err := strconv.ParseUint(params[0], 10, 64)
+	if err != nil || milliseconds < 100 || milliseconds > 4294967296 {
+		return invalidParam(ctx)
+	}
+
+	// discard any breaks received before sleeping, they cannot wake the device
+	select {
+	case <-d.breaks:
+	default:
+	}
+
+	if err := ok(ctx); err != nil {
+		return fmt.Errorf("error sending initial sleep OK response: %w", err)
+	}
+
+	select {
+	case <-d.clock.After(time.Duration(milliseconds) * time.Millisecond):
+		ctx.logger.Info("woke after sleeping")
+	case <-d.breaks:
+		ctx.logger.Info("woken early by break")
+	}
+
+	return ok(ctx)
+}
+
 func (d *Device) processSysSetCommand(ctx *commandContext, params []string) error {
 	if len(params) < 1 {
 		return invalidParam(ctx)
@@ -121,6 +198,10 @@ func (d *Device) processSysSetCommand(ctx *commandContext, params []string) erro
 			return invalidParam(ctx)
 		}
 
+		if d.Sys.PinModes[rn2483.PinName(pinName)] != rn2483.PinModeDigitalOutput {
+			return invalidParam(ctx)
+		}
+
 		if pinStateStr != "0" && pinStateStr != "1" {
 			return invalidParam(ctx)
 		}
@@ -132,6 +213,31 @@ func (d *Device) processSysSetCommand(ctx *commandContext, params []string) erro
 
 		d.Sys.GPIO[rn2483.PinName(pinName)] = pinState
 
+		return ok(ctx)
+	case "pinmode":
+		if len(params) < 3 {
+			return invalidParam(ctx)
+		}
+
+		pin := rn2483.PinName(params[1])
+		mode := rn2483.PinMode(params[2])
+
+		if _, ok := d.Sys.PinModes[pin]; !ok {
+			return invalidParam(ctx)
+		}
+
+		switch mode {
+		case rn2483.PinModeDigitalOutput, rn2483.PinModeDigitalInput:
+		case rn2483.PinModeAnalog:
+			if !pin.SupportsAnalog() {
+				return invalidParam(ctx)
+			}
+		default:
+			return invalidParam(ctx)
+		}
+
+		d.Sys.PinModes[pin] = mode
+
 		return ok(ctx)
 	default:
 		return invalidParam(ctx)
@@ -146,6 +252,8 @@ func (d *Device) processSysGetCommand(ctx *commandContext, params []string) erro
 	switch params[0] {
 	case "ver":
 		return ctx.writeResponse(d.Sys.FirmwareVersion)
+	case "hweui":
+		return ctx.writeResponse(d.Sys.HWEUI)
 	case "vdd":
 		voltage := 3304 + (rand.Intn(8) - 4)
 		return ctx.writeResponse("%d", voltage)
@@ -165,6 +273,35 @@ func (d *Device) processSysGetCommand(ctx *commandContext, params []string) erro
 		}
 
 		return ctx.writeResponse(rn2483.ByteToHex(value))
+	case "pindig":
+		if len(params) < 2 {
+			return invalidParam(ctx)
+		}
+
+		pin := rn2483.PinName(params[1])
+
+		var level bool
+		switch d.Sys.PinModes[pin] {
+		case rn2483.PinModeDigitalInput:
+			level = d.Sys.DigitalInputs[pin]
+		case rn2483.PinModeDigitalOutput:
+			level = d.Sys.GPIO[pin]
+		default:
+			return invalidParam(ctx)
+		}
+
+		return ctx.writeResponse("%d", encodeBoolean(level))
+	case "pinana":
+		if len(params) < 2 {
+			return invalidParam(ctx)
+		}
+
+		pin := rn2483.PinName(params[1])
+		if d.Sys.PinModes[pin] != rn2483.PinModeAnalog {
+			return invalidParam(ctx)
+		}
+
+		return ctx.writeResponse("%d", d.Sys.AnalogInputs[pin])
 	default:
 		return invalidParam(ctx)
 	}
@@ -0,0 +1,87 @@
+package fake
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"time"
+)
+
+const (
+	// breakCharacter is how a break condition appears in the command stream, matching how a UART receives a break
+	breakCharacter = 0x00
+	// syncCharacter follows a break to let the device measure the host's baud rate
+	syncCharacter = 0x55
+
+	inputBufferSize = 64
+)
+
+// garbledResponse is written in place of responses while the host is using the wrong baud rate
+var garbledResponse = []byte{0xF8, 0x80, 0xFE, 0x80, 0x78, 0xE0}
+
+// uartToken is a single unit of input received by the device: either a line of text, a break condition, or input
+// received so far without either (which is only complete once the rest of the line arrives)
+type uartToken struct {
+	line    string
+	isBreak bool
+	partial bool
+	// raw is exactly the input received, including any line ending or break, as needed by the binary bootloader
+	raw []byte
+}
+
+// splitUARTInput is a bufio.SplitFunc separating input into lines, and any break conditions
+func splitUARTInput(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if index := bytes.IndexAny(data, "\n\x00"); index >= 0 {
+		return index + 1, data[:index+1], nil
+	}
+
+	// return incomplete lines too, as binary bootloader commands are not delimited at all
+	if len(data) > 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// receive behaves as the device's UART, continually consuming input so that writers are never blocked by commands
+// that take time to process
+func (d *Device) receive(commandReader io.Reader, input chan<- uartToken, done <-chan struct{}) {
+	defer close(input)
+
+	scanner := bufio.NewScanner(commandReader)
+	scanner.Split(splitUARTInput)
+
+	for scanner.Scan() {
+		data := scanner.Bytes()
+
+		token := uartToken{
+			raw: append([]byte(nil), data...),
+		}
+		switch data[len(data)-1] {
+		case breakCharacter:
+			token.isBreak = true
+
+			// also signal the break out of band, so that it can wake the device while a command is being processed
+			select {
+			case d.breaks <- struct{}{}:
+			default:
+			}
+		case '\n':
+			token.line = string(bytes.TrimRight(data, "\r\n"))
+		default:
+			token.partial = true
+		}
+
+		select {
+		case input <- token:
+		case <-done:
+			return
+		}
+	}
+}
+
+// SendBreak simulates the host sending a break condition to the device, as used to initiate auto-baud detection
+func (d *Device) SendBreak(_ time.Duration) error {
+	_, err := d.Write([]byte{breakCharacter})
+	return err
+}
@@ -7,3 +7,11 @@ func invalidParam(ctx *commandContext) error {
 func ok(ctx *commandContext) error {
 	return ctx.writeResponse("ok")
 }
+
+func encodeBoolean(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,47 @@
+package rn2483
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+)
+
+// lineFramer splits the data read from a transport into the lines of text sent by the device, each terminated by
+// "\r\n". The start of a line whose read is abandoned at a read deadline is kept, so that the line is completed by the
+// next read rather than lost.
+type lineFramer struct {
+	transport Transport
+	reader    *bufio.Reader
+	partial   string
+}
+
+func newLineFramer(transport Transport) *lineFramer {
+	return &lineFramer{
+		transport: transport,
+		reader:    bufio.NewReader(transport),
+	}
+}
+
+// ReadLine reads the next line, without its terminator
+func (f *lineFramer) ReadLine() (string, error) {
+	line, err := f.reader.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			f.partial += line
+		}
+		return "", err
+	}
+
+	line = f.partial + line
+	f.partial = ""
+
+	return strings.TrimSpace(line), nil
+}
+
+// Discard discards any data that has been read from the transport but not yet returned as a line, including partial
+// lines
+func (f *lineFramer) Discard() {
+	f.reader.Reset(f.transport)
+	f.partial = ""
+}
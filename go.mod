@@ -8,4 +8,5 @@ require (
 	github.com/jonboulle/clockwork v0.2.2
 	github.com/poy/onpar v1.1.2
 	go.uber.org/multierr v1.7.0
+	golang.org/x/sys v0.0.0-20210616094352-59db8d763f22
 )
@@ -0,0 +1,298 @@
+// Package gpiowatch periodically polls a device's GPIO inputs, emitting events when digital inputs change level and
+// when analog inputs cross a threshold.
+package gpiowatch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/omaskery/rn2483"
+)
+
+// DefaultInterval is the polling interval used when none is configured
+const DefaultInterval = 100 * time.Millisecond
+
+// EventKind identifies what caused an Event
+type EventKind int
+
+const (
+	// EventRising indicates a digital input changed from low to high
+	EventRising EventKind = iota
+	// EventFalling indicates a digital input changed from high to low
+	EventFalling
+	// EventAboveThreshold indicates an analog input rose to or above its threshold
+	EventAboveThreshold
+	// EventBelowThreshold indicates an analog input fell below its threshold (less any hysteresis)
+	EventBelowThreshold
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventRising:
+		return "rising"
+	case EventFalling:
+		return "falling"
+	case EventAboveThreshold:
+		return "above-threshold"
+	case EventBelowThreshold:
+		return "below-threshold"
+	default:
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+}
+
+// Event describes a change observed on a watched pin
+type Event struct {
+	Pin  rn2483.PinName
+	Kind EventKind
+	// Time is when the poll that observed the change happened
+	Time time.Time
+	// Level is the new level of a digital input
+	Level bool
+	// Value is the analog value that crossed the threshold
+	Value rn2483.AnalogValue
+}
+
+// DigitalInput configures a pin to be watched as a digital input
+type DigitalInput struct {
+	Pin rn2483.PinName
+	// Debounce is how long a new level must be consistently observed before an edge event is emitted, with zero
+	// emitting an event as soon as a change is observed
+	Debounce time.Duration
+}
+
+// AnalogInput configures a pin to be watched as an analog input
+type AnalogInput struct {
+	Pin rn2483.PinName
+	// Threshold is the value at or above which the input is considered above threshold
+	Threshold rn2483.AnalogValue
+	// Hysteresis is how far below the threshold the input must fall before it is considered below threshold again,
+	// preventing a noisy input near the threshold from producing a stream of events
+	Hysteresis rn2483.AnalogValue
+}
+
+// Config configures a Watcher
+type Config struct {
+	Logger logr.Logger
+	// Device is polled by the watcher, and must not be used by anything else while Run is in progress as Device is not
+	// safe for concurrent use
+	Device *rn2483.Device
+	// Clock is used for scheduling polls and timestamping events, defaulting to the real clock
+	Clock clockwork.Clock
+	// Interval is the time between polls, defaulting to DefaultInterval
+	Interval time.Duration
+	// EventBuffer is the capacity of the events channel
+	EventBuffer int
+
+	Digital []DigitalInput
+	Analog  []AnalogInput
+}
+
+type digitalState struct {
+	DigitalInput
+
+	stable       bool
+	pending      bool
+	pendingSince time.Time
+	hasPending   bool
+}
+
+type analogState struct {
+	AnalogInput
+
+	above bool
+}
+
+// Watcher polls GPIO inputs and emits events when they change
+type Watcher struct {
+	logger   logr.Logger
+	device   *rn2483.Device
+	clock    clockwork.Clock
+	interval time.Duration
+	events   chan Event
+
+	digital     []digitalState
+	analog      []analogState
+	initialised bool
+}
+
+// New creates a new Watcher
+func New(cfg Config) *Watcher {
+	logger := logr.Discard()
+	if cfg.Logger != nil {
+		logger = cfg.Logger
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clockwork.NewRealClock()
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+
+	w := &Watcher{
+		logger:   logger,
+		device:   cfg.Device,
+		clock:    cfg.Clock,
+		interval: cfg.Interval,
+		events:   make(chan Event, cfg.EventBuffer),
+	}
+	for _, input := range cfg.Digital {
+		w.digital = append(w.digital, digitalState{DigitalInput: input})
+	}
+	for _, input := range cfg.Analog {
+		w.analog = append(w.analog, analogState{AnalogInput: input})
+	}
+
+	return w
+}
+
+// Events returns the channel on which Run emits events, which is closed when Run returns
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Configure sets the mode of every watched pin to digital or analog input as appropriate
+func (w *Watcher) Configure() error {
+	for _, input := range w.digital {
+		if err := w.device.SetPinMode(input.Pin, rn2483.PinModeDigitalInput); err != nil {
+			return fmt.Errorf("error configuring %s as digital input: %w", input.Pin, err)
+		}
+	}
+	for _, input := range w.analog {
+		if err := w.device.SetPinMode(input.Pin, rn2483.PinModeAnalog); err != nil {
+			return fmt.Errorf("error configuring %s as analog input: %w", input.Pin, err)
+		}
+	}
+
+	return nil
+}
+
+// Poll reads every watched pin once, returning any events caused by changes since the previous poll. The first poll
+// only establishes the initial state of each pin and so never returns events.
+func (w *Watcher) Poll() ([]Event, error) {
+	now := w.clock.Now()
+	var events []Event
+
+	for i := range w.digital {
+		input := &w.digital[i]
+		level, err := w.device.GetDigitalGPIO(input.Pin)
+		if err != nil {
+			return events, fmt.Errorf("error reading %s: %w", input.Pin, err)
+		}
+
+		if event, ok := input.update(w.initialised, level, now); ok {
+			events = append(events, event)
+		}
+	}
+
+	for i := range w.analog {
+		input := &w.analog[i]
+		value, err := w.device.GetAnalogGPIO(input.Pin)
+		if err != nil {
+			return events, fmt.Errorf("error reading %s: %w", input.Pin, err)
+		}
+
+		if event, ok := input.update(w.initialised, value, now); ok {
+			events = append(events, event)
+		}
+	}
+
+	w.initialised = true
+	return events, nil
+}
+
+// Run configures the watched pins and then polls them at the configured interval, emitting events on the Events
+// channel, until ctx is done or an error occurs
+func (w *Watcher) Run(ctx context.Context) error {
+	defer close(w.events)
+
+	if err := w.Configure(); err != nil {
+		return err
+	}
+
+	for {
+		events, err := w.Poll()
+		for _, event := range events {
+			w.logger.V(1).Info("gpio event", "pin", event.Pin, "kind", event.Kind)
+			select {
+			case w.events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-w.clock.After(w.interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *digitalState) update(initialised bool, level bool, now time.Time) (Event, bool) {
+	if !initialised {
+		s.stable = level
+		return Event{}, false
+	}
+
+	if level == s.stable {
+		s.hasPending = false
+		return Event{}, false
+	}
+
+	if !s.hasPending || s.pending != level {
+		s.hasPending = true
+		s.pending = level
+		s.pendingSince = now
+	}
+
+	if now.Sub(s.pendingSince) < s.Debounce {
+		return Event{}, false
+	}
+
+	s.stable = level
+	s.hasPending = false
+
+	kind := EventFalling
+	if level {
+		kind = EventRising
+	}
+	return Event{
+		Pin:   s.Pin,
+		Kind:  kind,
+		Time:  now,
+		Level: level,
+	}, true
+}
+
+func (s *analogState) update(initialised bool, value rn2483.AnalogValue, now time.Time) (Event, bool) {
+	if !initialised {
+		s.above = value >= s.Threshold
+		return Event{}, false
+	}
+
+	var kind EventKind
+	switch {
+	case !s.above && value >= s.Threshold:
+		kind = EventAboveThreshold
+	case s.above && int(value) < int(s.Threshold)-int(s.Hysteresis):
+		kind = EventBelowThreshold
+	default:
+		return Event{}, false
+	}
+
+	s.above = kind == EventAboveThreshold
+	return Event{
+		Pin:   s.Pin,
+		Kind:  kind,
+		Time:  now,
+		Value: value,
+	}, true
+}
@@ -0,0 +1,173 @@
+package gpiowatch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/gpiowatch"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+const interval = 100 * time.Millisecond
+
+type testContext struct {
+	clock   clockwork.FakeClock
+	fake    *fake.Device
+	watcher *gpiowatch.Watcher
+}
+
+func (ctx *testContext) setDigital(pin rn2483.PinName, level bool) {
+	ctx.fake.Update(func(d *fake.Device) {
+		d.Sys.DigitalInputs[pin] = level
+	})
+}
+
+func (ctx *testContext) setAnalog(pin rn2483.PinName, value rn2483.AnalogValue) {
+	ctx.fake.Update(func(d *fake.Device) {
+		d.Sys.AnalogInputs[pin] = value
+	})
+}
+
+// poll advances time by one interval and then polls the watcher
+func (ctx *testContext) poll(t *testing.T) []gpiowatch.Event {
+	ctx.clock.Advance(interval)
+	events, err := ctx.watcher.Poll()
+	Expect(t, err).To(Not(HaveOccurred()))
+	return events
+}
+
+func TestWatcher(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		logger := testutils.CreateTestLogger(t)
+		clock := clockwork.NewFakeClock()
+
+		f, d := fake.NewFakeDevice(fake.Config{
+			Logger: logger.WithName("fake-device"),
+		})
+		t.Cleanup(func() {
+			if err := d.Close(); err != nil {
+				logger.Error(err, "error cleaning up fake device")
+			}
+		})
+
+		watcher := gpiowatch.New(gpiowatch.Config{
+			Logger:   logger.WithName("watcher"),
+			Device:   d,
+			Clock:    clock,
+			Interval: interval,
+			Digital: []gpiowatch.DigitalInput{
+				{Pin: rn2483.PinGPIO04},
+				{Pin: rn2483.PinGPIO05, Debounce: 250 * time.Millisecond},
+			},
+			Analog: []gpiowatch.AnalogInput{
+				{Pin: rn2483.PinGPIO00, Threshold: 500, Hysteresis: 50},
+			},
+		})
+
+		return t, &testContext{
+			clock:   clock,
+			fake:    f,
+			watcher: watcher,
+		}
+	})
+
+	o.Group("polling", func() {
+		o.BeforeEach(func(t *testing.T, ctx *testContext) (*testing.T, *testContext) {
+			Expect(t, ctx.watcher.Configure()).To(Not(HaveOccurred()))
+			events, err := ctx.watcher.Poll()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, events).To(HaveLen(0))
+			return t, ctx
+		})
+
+		o.Spec("emits digital edges", func(t *testing.T, ctx *testContext) {
+			Expect(t, ctx.poll(t)).To(HaveLen(0))
+
+			ctx.setDigital(rn2483.PinGPIO04, true)
+			events := ctx.poll(t)
+			Expect(t, events).To(HaveLen(1))
+			Expect(t, events[0].Pin).To(Equal(rn2483.PinGPIO04))
+			Expect(t, events[0].Kind).To(Equal(gpiowatch.EventRising))
+			Expect(t, events[0].Level).To(BeTrue())
+			Expect(t, events[0].Time).To(Equal(ctx.clock.Now()))
+
+			Expect(t, ctx.poll(t)).To(HaveLen(0))
+
+			ctx.setDigital(rn2483.PinGPIO04, false)
+			events = ctx.poll(t)
+			Expect(t, events).To(HaveLen(1))
+			Expect(t, events[0].Kind).To(Equal(gpiowatch.EventFalling))
+		})
+
+		o.Spec("debounces digital inputs", func(t *testing.T, ctx *testContext) {
+			ctx.setDigital(rn2483.PinGPIO05, true)
+			Expect(t, ctx.poll(t)).To(HaveLen(0))
+			Expect(t, ctx.poll(t)).To(HaveLen(0))
+
+			// bouncing back restarts the debounce period
+			ctx.setDigital(rn2483.PinGPIO05, false)
+			Expect(t, ctx.poll(t)).To(HaveLen(0))
+			ctx.setDigital(rn2483.PinGPIO05, true)
+			Expect(t, ctx.poll(t)).To(HaveLen(0))
+			Expect(t, ctx.poll(t)).To(HaveLen(0))
+			Expect(t, ctx.poll(t)).To(HaveLen(0))
+
+			events := ctx.poll(t)
+			Expect(t, events).To(HaveLen(1))
+			Expect(t, events[0].Pin).To(Equal(rn2483.PinGPIO05))
+			Expect(t, events[0].Kind).To(Equal(gpiowatch.EventRising))
+		})
+
+		o.Spec("emits analog threshold crossings with hysteresis", func(t *testing.T, ctx *testContext) {
+			ctx.setAnalog(rn2483.PinGPIO00, 520)
+			events := ctx.poll(t)
+			Expect(t, events).To(HaveLen(1))
+			Expect(t, events[0].Pin).To(Equal(rn2483.PinGPIO00))
+			Expect(t, events[0].Kind).To(Equal(gpiowatch.EventAboveThreshold))
+			Expect(t, events[0].Value).To(Equal(rn2483.AnalogValue(520)))
+
+			ctx.setAnalog(rn2483.PinGPIO00, 480)
+			Expect(t, ctx.poll(t)).To(HaveLen(0))
+
+			ctx.setAnalog(rn2483.PinGPIO00, 440)
+			events = ctx.poll(t)
+			Expect(t, events).To(HaveLen(1))
+			Expect(t, events[0].Kind).To(Equal(gpiowatch.EventBelowThreshold))
+		})
+	})
+
+	o.Spec("runs until cancelled, emitting events", func(t *testing.T, ctx *testContext) {
+		runCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		result := make(chan error, 1)
+		go func() {
+			result <- ctx.watcher.Run(runCtx)
+		}()
+
+		ctx.clock.BlockUntil(1)
+		ctx.setDigital(rn2483.PinGPIO04, true)
+		ctx.clock.Advance(interval)
+
+		event := <-ctx.watcher.Events()
+		Expect(t, event.Pin).To(Equal(rn2483.PinGPIO04))
+		Expect(t, event.Kind).To(Equal(gpiowatch.EventRising))
+
+		cancel()
+		Expect(t, <-result).To(testutils.MatchError(context.Canceled))
+
+		_, open := <-ctx.watcher.Events()
+		Expect(t, open).To(BeFalse())
+	})
+}
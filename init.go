@@ -0,0 +1,188 @@
+package rn2483
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	// DefaultInitResponseTimeout is how long Init waits for each response when no timeout is configured
+	DefaultInitResponseTimeout = 2 * time.Second
+	// DefaultFlushTimeout is how long the device must be silent before stale input is considered flushed, when no
+	// timeout is configured
+	DefaultFlushTimeout = 100 * time.Millisecond
+
+	// maxFlushLines limits how much stale input is discarded, so that a device continually sending output cannot
+	// prevent initialisation from proceeding
+	maxFlushLines = 64
+)
+
+var (
+	// ErrUnresponsive is returned by Init when the device does not respond sensibly to its version being queried. The
+	// error also matches the reason, such as ErrResponseTimeout or ErrBreakUnsupported, with errors.Is and errors.As.
+	ErrUnresponsive = errors.New("device is unresponsive")
+	// ErrUnknownSKU is returned by Init when the device reports an SKU this library does not know
+	ErrUnknownSKU = errors.New("device reports an unknown SKU")
+)
+
+// unresponsiveError reports why the device was found to be unresponsive, matching both ErrUnresponsive and its cause
+// (such as ErrResponseTimeout) with errors.Is and errors.As
+type unresponsiveError struct {
+	// detail, when set, describes the step that failed
+	detail string
+	cause  error
+}
+
+func (e *unresponsiveError) Error() string {
+	if e.detail != "" {
+		return fmt.Sprintf("%v: %s: %v", ErrUnresponsive, e.detail, e.cause)
+	}
+	return fmt.Sprintf("%v: %v", ErrUnresponsive, e.cause)
+}
+
+func (e *unresponsiveError) Is(target error) bool {
+	return target == ErrUnresponsive
+}
+
+func (e *unresponsiveError) Unwrap() error {
+	return e.cause
+}
+
+// InitOptions configures how a device is initialised by Device.Init
+type InitOptions struct {
+	// Reset resets the device (sys reset), returning it to its stored configuration, rather than only querying its
+	// version
+	Reset bool
+	// ResponseTimeout is how long to wait for each response during initialisation, defaulting to
+	// DefaultInitResponseTimeout
+	ResponseTimeout time.Duration
+	// FlushTimeout is how long the device must be silent before stale input is considered flushed, defaulting to
+	// DefaultFlushTimeout
+	FlushTimeout time.Duration
+	// AutoBaudIfUnresponsive performs auto-baud (see Device.AutoBaud) and tries again if the device does not respond
+	// sensibly, rather than failing with ErrUnresponsive
+	AutoBaudIfUnresponsive bool
+	// AllowUnknownSKU permits devices reporting an SKU this library does not know, which otherwise fail with
+	// ErrUnknownSKU
+	AllowUnknownSKU bool
+}
+
+// DeviceInfo summarises a device, as determined by Device.Init
+type DeviceInfo struct {
+	Firmware     *FirmwareVersion
+	HWEUI        string
+	VDD          Voltage
+	Capabilities Capabilities
+}
+
+// Open creates a Device and initialises it (see Device.Init), closing it again if initialisation fails
+func Open(cfg Config, opts InitOptions) (*Device, *DeviceInfo, error) {
+	d := New(cfg)
+
+	info, err := d.Init(opts)
+	if err != nil {
+		return nil, nil, multierr.Combine(err, d.Close())
+	}
+
+	return d, info, nil
+}
+
+// Init prepares a newly opened device for use: discarding any stale input, resetting or querying the device to confirm
+// it is responsive, checking its firmware (see Config.RequiredFirmware), and reading its HWEUI and supply voltage
+func (d *Device) Init(opts InitOptions) (*DeviceInfo, error) {
+	responseTimeout := opts.ResponseTimeout
+	if responseTimeout == 0 {
+		responseTimeout = DefaultInitResponseTimeout
+	}
+
+	flushTimeout := opts.FlushTimeout
+	if flushTimeout == 0 {
+		flushTimeout = DefaultFlushTimeout
+	}
+
+	// an unresponsive device must not block initialisation forever, whatever timeout is otherwise configured
+	previousTimeout := d.responseTimeout
+	d.responseTimeout = responseTimeout
+	defer func() {
+		d.responseTimeout = previousTimeout
+	}()
+
+	if err := d.flush(flushTimeout); err != nil {
+		return nil, err
+	}
+
+	fw, err := d.probe(opts.Reset)
+	if err != nil {
+		if !opts.AutoBaudIfUnresponsive {
+			return nil, &unresponsiveError{cause: err}
+		}
+
+		if _, err := d.AutoBaud(); err != nil {
+			return nil, &unresponsiveError{detail: "auto-baud failed", cause: err}
+		}
+		if fw, err = d.probe(opts.Reset); err != nil {
+			return nil, &unresponsiveError{cause: err}
+		}
+	}
+
+	if !fw.IsKnownSKU() && !opts.AllowUnknownSKU {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSKU, fw.SKU)
+	}
+
+	if err := d.checkRequiredFirmware(fw); err != nil {
+		return nil, err
+	}
+
+	hweui, err := d.GetHWEUI()
+	if err != nil {
+		return nil, fmt.Errorf("error getting HWEUI: %w", err)
+	}
+
+	vdd, err := d.GetVDD()
+	if err != nil {
+		return nil, fmt.Errorf("error getting VDD: %w", err)
+	}
+
+	return &DeviceInfo{
+		Firmware:     fw,
+		HWEUI:        hweui,
+		VDD:          vdd,
+		Capabilities: CapabilitiesOf(fw),
+	}, nil
+}
+
+// Flush discards any input that has been received but not yet read, then continues discarding input until the device
+// has been silent for the timeout, such as after the device has printed unexpected output
+func (d *Device) Flush(timeout time.Duration) error {
+	return d.flush(timeout)
+}
+
+// flush discards input until the device has been silent for the timeout
+func (d *Device) flush(timeout time.Duration) error {
+	if err := d.discardBuffered(); err != nil {
+		return err
+	}
+
+	for i := 0; i < maxFlushLines; i++ {
+		if _, err := d.readResponse(timeout); err != nil {
+			if errors.Is(err, ErrResponseTimeout) {
+				return nil
+			}
+			return fmt.Errorf("error flushing stale input: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// probe resets the device or queries its version
+func (d *Device) probe(reset bool) (*FirmwareVersion, error) {
+	if reset {
+		return d.Reset()
+	}
+
+	return d.GetVersion()
+}
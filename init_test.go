@@ -0,0 +1,180 @@
+package rn2483_test
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+// unresponsiveTo creates a device that never responds to the first command matching pattern
+func unresponsiveTo(t *testing.T, pattern string, cfg rn2483.Config) (*fake.Device, *rn2483.Device) {
+	logger := testutils.CreateTestLogger(t)
+
+	f := fake.New(fake.Config{
+		Logger: logger.WithName("fake-device"),
+		Faults: fake.InjectFaults(1, fake.FaultRule{
+			Pattern: regexp.MustCompile(pattern),
+			Fault:   fake.Fault{Kind: fake.FaultNoResponse},
+			Limit:   1,
+		}),
+	})
+	cfg.Serial = f
+	d := rn2483.New(cfg)
+	t.Cleanup(func() {
+		if err := d.Close(); err != nil {
+			logger.Error(err, "error cleaning up fake device")
+		}
+	})
+
+	return f, d
+}
+
+func TestInit(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	fastInit := rn2483.InitOptions{
+		ResponseTimeout: 50 * time.Millisecond,
+		FlushTimeout:    10 * time.Millisecond,
+	}
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		return t, prepareTestContext(t)
+	})
+
+	o.Spec("summarises the device", func(t *testing.T, ctx *testContext) {
+		info, err := ctx.device.Init(fastInit)
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, info.Firmware.Raw).To(Equal("RN2483 1.0.4 Mar 23 1991 13:37:00"))
+		Expect(t, info.HWEUI).To(Equal("0004A30B001C0530"))
+		Expect(t, info.VDD.Volts()).To(And(BeAbove(3.2), BeBelow(3.4)))
+		Expect(t, info.Capabilities.Supports(rn2483.CapabilityGPIOInput)).To(BeTrue())
+	})
+
+	o.Spec("discards stale input", func(t *testing.T, ctx *testContext) {
+		// leave the responses to these commands unread
+		Expect(t, ctx.device.Sendf("sys get vdd")).To(Not(HaveOccurred()))
+		Expect(t, ctx.device.Sendf("sys get hweui")).To(Not(HaveOccurred()))
+
+		info, err := ctx.device.Init(fastInit)
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, info.Firmware.SKU).To(Equal(rn2483.DeviceRN2483))
+	})
+
+	o.Spec("can reset the device", func(t *testing.T, ctx *testContext) {
+		_, err := ctx.device.PauseMAC()
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		opts := fastInit
+		opts.Reset = true
+		_, err = ctx.device.Init(opts)
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, ctx.fake.Mac.IsPaused()).To(BeFalse())
+	})
+
+	o.Group("unknown SKUs", func() {
+		o.BeforeEach(func(t *testing.T, ctx *testContext) (*testing.T, *testContext) {
+			ctx.fake.Sys.FirmwareVersion = "RN9999 1.0.4 Mar 23 1991 13:37:00"
+			return t, ctx
+		})
+
+		o.Spec("are refused", func(t *testing.T, ctx *testContext) {
+			_, err := ctx.device.Init(fastInit)
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrUnknownSKU))
+		})
+
+		o.Spec("can be allowed", func(t *testing.T, ctx *testContext) {
+			opts := fastInit
+			opts.AllowUnknownSKU = true
+			info, err := ctx.device.Init(opts)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, info.Firmware.SKU).To(Equal(rn2483.DeviceSKU("RN9999")))
+		})
+	})
+
+	o.Spec("checks the required firmware version", func(t *testing.T, ctx *testContext) {
+		ctx = prepareTestContext(t, func(cfg *rn2483.Config) {
+			cfg.RequiredFirmware = rn2483.MustParseVersionConstraint(">=1.0.5")
+		})
+
+		_, err := ctx.device.Init(fastInit)
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrUnsupportedFirmware))
+	})
+
+	o.Group("unresponsive devices", func() {
+		o.Spec("fail", func(t *testing.T, ctx *testContext) {
+			_, d := unresponsiveTo(t, "^sys get ver$", rn2483.Config{})
+
+			_, err := d.Init(fastInit)
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrUnresponsive))
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrResponseTimeout))
+
+			var commandErr *rn2483.CommandError
+			Expect(t, errors.As(err, &commandErr)).To(BeTrue())
+			Expect(t, commandErr.Command).To(Equal("sys get ver"))
+		})
+
+		o.Spec("report why auto-baud failed", func(t *testing.T, ctx *testContext) {
+			ctx.fake.Sys.BaudMismatch = true
+			// hides the fake's ability to send breaks
+			d := rn2483.New(rn2483.Config{
+				Serial: struct{ io.ReadWriteCloser }{ctx.fake},
+			})
+
+			opts := fastInit
+			opts.AutoBaudIfUnresponsive = true
+			_, err := d.Init(opts)
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrUnresponsive))
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrBreakUnsupported))
+		})
+
+		o.Spec("can be recovered with auto-baud", func(t *testing.T, ctx *testContext) {
+			ctx.fake.Sys.BaudMismatch = true
+
+			opts := fastInit
+			opts.AutoBaudIfUnresponsive = true
+			_, err := ctx.device.Init(opts)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, ctx.fake.Sys.BaudMismatch).To(BeFalse())
+		})
+	})
+
+	o.Spec("open closes devices that fail to initialise", func(t *testing.T, ctx *testContext) {
+		ctx.fake.Sys.FirmwareVersion = "RN9999 1.0.4 Mar 23 1991 13:37:00"
+
+		d, _, err := rn2483.Open(rn2483.Config{Serial: ctx.fake}, fastInit)
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrUnknownSKU))
+		Expect(t, d).To(BeNil())
+
+		_, err = ctx.fake.Write([]byte("sys get ver\r\n"))
+		Expect(t, err).To(HaveOccurred())
+	})
+}
+
+func TestResponseTimeout(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.Spec("commands time out without a response", func(t *testing.T) {
+		_, d := unresponsiveTo(t, "^sys get vdd$", rn2483.Config{
+			ResponseTimeout: 50 * time.Millisecond,
+		})
+
+		_, err := d.GetVDD()
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrResponseTimeout))
+
+		hweui, err := d.GetHWEUI()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, hweui).To(Equal("0004A30B001C0530"))
+	})
+}
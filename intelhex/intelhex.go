@@ -0,0 +1,232 @@
+// Package intelhex reads and writes the Intel HEX format, as used for NVM images and firmware files.
+//
+// Data records (type 00), end of file records (type 01), extended segment address records (type 02) and extended
+// linear address records (type 04) are supported. Start address records (types 03 and 05) are accepted but ignored.
+package intelhex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	recordData                    = 0x00
+	recordEndOfFile               = 0x01
+	recordExtendedSegmentAddress  = 0x02
+	recordStartSegmentAddress     = 0x03
+	recordExtendedLinearAddress   = 0x04
+	recordStartLinearAddress      = 0x05
+	defaultBytesPerRecord         = 16
+	recordOverhead                = 5
+	extendedLinearAddressBoundary = 0x10000
+)
+
+var (
+	// ErrSyntax is returned when a file is not valid Intel HEX
+	ErrSyntax = errors.New("invalid Intel HEX")
+	// ErrChecksum is returned when a record's checksum does not match its contents
+	ErrChecksum = errors.New("Intel HEX record checksum mismatch")
+	// ErrOverlap is returned when a file contains data for the same address more than once
+	ErrOverlap = errors.New("Intel HEX data overlaps")
+)
+
+// Segment is a contiguous run of data starting at an address
+type Segment struct {
+	Address uint32
+	Data    []byte
+}
+
+// End is the address immediately after the segment's last byte
+func (s Segment) End() uint32 {
+	return s.Address + uint32(len(s.Data))
+}
+
+// Decode reads an Intel HEX file, returning its data as segments sorted by address with adjacent data merged
+func Decode(r io.Reader) ([]Segment, error) {
+	var segments []Segment
+	var base uint32
+	sawEOF := false
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if sawEOF {
+			return nil, fmt.Errorf("%w: line %d: data after end of file record", ErrSyntax, lineNumber)
+		}
+
+		recordType, address, data, err := decodeRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		switch recordType {
+		case recordData:
+			segments = append(segments, Segment{
+				Address: base + uint32(address),
+				Data:    data,
+			})
+		case recordEndOfFile:
+			sawEOF = true
+		case recordExtendedSegmentAddress:
+			if len(data) != 2 {
+				return nil, fmt.Errorf("%w: line %d: extended segment address must be 2 bytes", ErrSyntax, lineNumber)
+			}
+			base = (uint32(data[0])<<8 | uint32(data[1])) << 4
+		case recordExtendedLinearAddress:
+			if len(data) != 2 {
+				return nil, fmt.Errorf("%w: line %d: extended linear address must be 2 bytes", ErrSyntax, lineNumber)
+			}
+			base = (uint32(data[0])<<8 | uint32(data[1])) << 16
+		case recordStartSegmentAddress, recordStartLinearAddress:
+		default:
+			return nil, fmt.Errorf("%w: line %d: unknown record type %02X", ErrSyntax, lineNumber, recordType)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading Intel HEX: %w", err)
+	}
+	if !sawEOF {
+		return nil, fmt.Errorf("%w: missing end of file record", ErrSyntax)
+	}
+
+	return merge(segments)
+}
+
+// Encode writes segments as an Intel HEX file, with 16 bytes of data per record
+func Encode(w io.Writer, segments []Segment) error {
+	bw := bufio.NewWriter(w)
+	var base uint32
+
+	for _, segment := range segments {
+		for offset := 0; offset < len(segment.Data); {
+			address := segment.Address + uint32(offset)
+			if upper := address &^ (extendedLinearAddressBoundary - 1); upper != base {
+				base = upper
+				writeRecord(bw, recordExtendedLinearAddress, 0, []byte{byte(base >> 24), byte(base >> 16)})
+			}
+
+			length := defaultBytesPerRecord
+			if remaining := len(segment.Data) - offset; remaining < length {
+				length = remaining
+			}
+			// records must not cross into the next extended linear address region
+			if untilBoundary := int(extendedLinearAddressBoundary - (address - base)); untilBoundary < length {
+				length = untilBoundary
+			}
+
+			writeRecord(bw, recordData, uint16(address-base), segment.Data[offset:offset+length])
+			offset += length
+		}
+	}
+	writeRecord(bw, recordEndOfFile, 0, nil)
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error writing Intel HEX: %w", err)
+	}
+
+	return nil
+}
+
+func decodeRecord(line string) (byte, uint16, []byte, error) {
+	if !strings.HasPrefix(line, ":") {
+		return 0, 0, nil, fmt.Errorf("%w: record does not start with ':'", ErrSyntax)
+	}
+
+	raw, err := hex.DecodeString(line[1:])
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+	}
+	if len(raw) < recordOverhead || len(raw) != recordOverhead+int(raw[0]) {
+		return 0, 0, nil, fmt.Errorf("%w: record length does not match its byte count", ErrSyntax)
+	}
+
+	var sum byte
+	for _, b := range raw {
+		sum += b
+	}
+	if sum != 0 {
+		return 0, 0, nil, ErrChecksum
+	}
+
+	address := uint16(raw[1])<<8 | uint16(raw[2])
+	return raw[3], address, raw[4 : len(raw)-1], nil
+}
+
+func writeRecord(w *bufio.Writer, recordType byte, address uint16, data []byte) {
+	raw := make([]byte, 0, recordOverhead+len(data))
+	raw = append(raw, byte(len(data)), byte(address>>8), byte(address), recordType)
+	raw = append(raw, data...)
+
+	var sum byte
+	for _, b := range raw {
+		sum += b
+	}
+	raw = append(raw, -sum)
+
+	_, _ = fmt.Fprintf(w, ":%s\n", strings.ToUpper(hex.EncodeToString(raw)))
+}
+
+func merge(segments []Segment) ([]Segment, error) {
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].Address < segments[j].Address
+	})
+
+	var merged []Segment
+	for _, segment := range segments {
+		if len(segment.Data) == 0 {
+			continue
+		}
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			if segment.Address < last.End() {
+				return nil, fmt.Errorf("%w: at address %08X", ErrOverlap, segment.Address)
+			}
+			if segment.Address == last.End() {
+				last.Data = append(last.Data, segment.Data...)
+				continue
+			}
+		}
+		merged = append(merged, Segment{
+			Address: segment.Address,
+			Data:    append([]byte(nil), segment.Data...),
+		})
+	}
+
+	return merged, nil
+}
+
+// Flatten copies the data within [start, start+length) from segments into a single buffer, with any addresses not
+// covered by a segment set to fill
+func Flatten(segments []Segment, start uint32, length int, fill byte) []byte {
+	buffer := bytes.Repeat([]byte{fill}, length)
+	end := start + uint32(length)
+
+	for _, segment := range segments {
+		if segment.End() <= start || segment.Address >= end {
+			continue
+		}
+
+		from := segment.Address
+		if from < start {
+			from = start
+		}
+		to := segment.End()
+		if to > end {
+			to = end
+		}
+		copy(buffer[from-start:to-start], segment.Data[from-segment.Address:to-segment.Address])
+	}
+
+	return buffer
+}
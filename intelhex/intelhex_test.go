@@ -0,0 +1,84 @@
+package intelhex_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483/intelhex"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+func TestIntelHex(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.Spec("decodes data records", func(t *testing.T) {
+		input := strings.Join([]string{
+			":0B0010006164647265737320676170A7",
+			":020000040001F9",
+			":0400000001020304F2",
+			":00000001FF",
+		}, "\n")
+
+		segments, err := intelhex.Decode(strings.NewReader(input))
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, segments).To(Equal([]intelhex.Segment{
+			{Address: 0x0010, Data: []byte("address gap")},
+			{Address: 0x10000, Data: []byte{1, 2, 3, 4}},
+		}))
+	})
+
+	o.Spec("round trips segments", func(t *testing.T) {
+		data := make([]byte, 40)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		segments := []intelhex.Segment{
+			{Address: 0x300, Data: data},
+			{Address: 0xFFF8, Data: data[:16]},
+		}
+
+		var buffer bytes.Buffer
+		Expect(t, intelhex.Encode(&buffer, segments)).To(Not(HaveOccurred()))
+
+		decoded, err := intelhex.Decode(&buffer)
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, decoded).To(Equal(segments))
+	})
+
+	o.Spec("detects checksum errors", func(t *testing.T) {
+		_, err := intelhex.Decode(strings.NewReader(":0400000001020304F3\n:00000001FF\n"))
+		Expect(t, err).To(testutils.MatchError(intelhex.ErrChecksum))
+	})
+
+	o.Spec("detects malformed files", func(t *testing.T) {
+		inputs := []string{
+			"0400000001020304F2\n:00000001FF\n",
+			":0500000001020304F2\n:00000001FF\n",
+			":0400000001020304F2\n",
+			":00000001FF\n:0400000001020304F2\n",
+		}
+		for _, input := range inputs {
+			_, err := intelhex.Decode(strings.NewReader(input))
+			Expect(t, err).To(testutils.MatchError(intelhex.ErrSyntax))
+		}
+	})
+
+	o.Spec("detects overlapping data", func(t *testing.T) {
+		_, err := intelhex.Decode(strings.NewReader(":0400000001020304F2\n:0400020001020304F0\n:00000001FF\n"))
+		Expect(t, err).To(testutils.MatchError(intelhex.ErrOverlap))
+	})
+
+	o.Spec("flattens segments into a buffer", func(t *testing.T) {
+		segments := []intelhex.Segment{
+			{Address: 0x0E, Data: []byte{1, 2, 3}},
+			{Address: 0x12, Data: []byte{4}},
+		}
+		Expect(t, intelhex.Flatten(segments, 0x0F, 4, 0xFF)).To(Equal([]byte{2, 3, 0xFF, 4}))
+	})
+}
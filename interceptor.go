@@ -0,0 +1,63 @@
+package rn2483
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Call describes a single exchange with the device passing through the interceptors (see Interceptor): either a
+// command being sent and its response read, or a deferred result being read (such as that of radio tx)
+type Call struct {
+	// Command is the command being sent, or that a deferred result belongs to. Interceptors may change the command
+	// before passing the call on, though doing so has no effect on deferred results.
+	Command string
+	Stage   CommandStage
+	// Attempt counts the attempts made to execute the command, starting from 1, when it is retried (see RetryPolicy)
+	Attempt int
+}
+
+// Invoker performs a call, returning the device's response and whether the call failed. The response is returned
+// even when the call fails, if one was received.
+type Invoker func(call *Call) (string, error)
+
+// Interceptor is called around every exchange with the device made by ExecuteCommand (and its variants), along with
+// the deferred results of commands, allowing tracing, logging, auditing or rate limiting without wrapping the serial
+// device. An interceptor must call next to proceed with the call, or may fail the call without doing so, though a
+// deferred result that is never read will be mistaken for the response to the next command.
+type Interceptor func(call *Call, next Invoker) (string, error)
+
+// intercept performs the call through the configured interceptors, with the first interceptor outermost
+func (d *Device) intercept(call *Call, invoker Invoker) (string, error) {
+	for i := len(d.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := d.interceptors[i], invoker
+		invoker = func(call *Call) (string, error) {
+			return interceptor(call, next)
+		}
+	}
+
+	return invoker(call)
+}
+
+// LoggingInterceptor logs each call, with its response, duration and any failure
+func LoggingInterceptor(logger logr.Logger) Interceptor {
+	return func(call *Call, next Invoker) (string, error) {
+		started := time.Now()
+		response, err := next(call)
+
+		values := []interface{}{
+			"command", call.Command,
+			"stage", call.Stage.String(),
+			"attempt", call.Attempt,
+			"response", response,
+			"elapsed", time.Since(started),
+		}
+		if err != nil {
+			logger.Error(err, "command failed", values...)
+		} else {
+			logger.Info("command executed", values...)
+		}
+
+		return response, err
+	}
+}
@@ -0,0 +1,151 @@
+package rn2483_test
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+func TestInterceptors(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	// recording creates an interceptor that records the calls passing through it, and their outcome
+	recording := func(name string, calls *[]string) rn2483.Interceptor {
+		return func(call *rn2483.Call, next rn2483.Invoker) (string, error) {
+			*calls = append(*calls, fmt.Sprintf("%s> %s (%s #%d)", name, call.Command, call.Stage, call.Attempt))
+			response, err := next(call)
+			*calls = append(*calls, fmt.Sprintf("<%s %s %v", name, response, err))
+			return response, err
+		}
+	}
+
+	o.Spec("are called in order around each command", func(t *testing.T) {
+		var calls []string
+		_, d := faultyDevice(t, rn2483.Config{
+			Interceptors: []rn2483.Interceptor{recording("a", &calls), recording("b", &calls)},
+		})
+
+		Expect(t, d.SetRadioPower(5)).To(Not(HaveOccurred()))
+		Expect(t, calls).To(Equal([]string{
+			"a> radio set pwr 5 (immediate #1)",
+			"b> radio set pwr 5 (immediate #1)",
+			"<b ok <nil>",
+			"<a ok <nil>",
+		}))
+	})
+
+	o.Spec("see failed responses", func(t *testing.T) {
+		var calls []string
+		_, d := faultyDevice(t, rn2483.Config{
+			Interceptors: []rn2483.Interceptor{recording("a", &calls)},
+		})
+
+		Expect(t, d.SetRadioParameter("sf", "sf99")).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		Expect(t, calls).To(Equal([]string{
+			"a> radio set sf sf99 (immediate #1)",
+			"<a invalid_param invalid parameter",
+		}))
+	})
+
+	o.Spec("see each retry", func(t *testing.T) {
+		var calls []string
+		_, d := faultyDevice(t, rn2483.Config{
+			Interceptors: []rn2483.Interceptor{recording("a", &calls)},
+			RetryPolicy:  &rn2483.RetryPolicy{MaxAttempts: 2},
+		}, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio set pwr"),
+			Fault:   fake.Fault{Kind: fake.FaultBusy},
+			Limit:   1,
+		})
+
+		Expect(t, d.SetRadioPower(5)).To(Not(HaveOccurred()))
+		Expect(t, calls).To(Equal([]string{
+			"a> radio set pwr 5 (immediate #1)",
+			"<a busy the transceiver is currently busy",
+			"a> radio set pwr 5 (immediate #2)",
+			"<a ok <nil>",
+		}))
+	})
+
+	o.Spec("see deferred results", func(t *testing.T) {
+		var calls []string
+		_, d := faultyDevice(t, rn2483.Config{
+			Interceptors: []rn2483.Interceptor{recording("a", &calls)},
+		})
+
+		_, err := d.PauseMAC()
+		Expect(t, err).To(Not(HaveOccurred()))
+		calls = nil
+
+		Expect(t, d.RadioTx([]byte{0x01})).To(Not(HaveOccurred()))
+		Expect(t, calls).To(Equal([]string{
+			"a> radio tx 01 (immediate #1)",
+			"<a ok <nil>",
+			"a> radio tx 01 (deferred #1)",
+			"<a radio_tx_ok <nil>",
+		}))
+	})
+
+	o.Spec("can fail commands without sending them", func(t *testing.T) {
+		errRateLimited := errors.New("rate limited")
+		f, d := faultyDevice(t, rn2483.Config{
+			Interceptors: []rn2483.Interceptor{
+				func(call *rn2483.Call, next rn2483.Invoker) (string, error) {
+					if call.Command == "radio set pwr 5" {
+						return "", errRateLimited
+					}
+					return next(call)
+				},
+			},
+		})
+
+		err := d.SetRadioPower(5)
+		Expect(t, err).To(testutils.MatchError(errRateLimited))
+		Expect(t, err.Error()).To(Equal(`command "radio set pwr 5" failed: rate limited`))
+
+		Expect(t, d.SetRadioPower(6)).To(Not(HaveOccurred()))
+		f.Update(func(f *fake.Device) {
+			Expect(t, f.Radio.Power).To(Equal(6))
+		})
+	})
+
+	o.Spec("can rewrite commands", func(t *testing.T) {
+		f, d := faultyDevice(t, rn2483.Config{
+			Interceptors: []rn2483.Interceptor{
+				func(call *rn2483.Call, next rn2483.Invoker) (string, error) {
+					if call.Command == "radio set pwr 15" {
+						call.Command = "radio set pwr 14"
+					}
+					return next(call)
+				},
+			},
+		})
+
+		Expect(t, d.SetRadioPower(15)).To(Not(HaveOccurred()))
+		f.Update(func(f *fake.Device) {
+			Expect(t, f.Radio.Power).To(Equal(14))
+		})
+	})
+
+	o.Spec("can log commands", func(t *testing.T) {
+		_, d := faultyDevice(t, rn2483.Config{
+			Interceptors: []rn2483.Interceptor{
+				rn2483.LoggingInterceptor(testutils.CreateTestLogger(t).WithName("commands")),
+			},
+		})
+
+		_, err := d.GetVDD()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, d.SetRadioParameter("sf", "sf99")).To(HaveOccurred())
+	})
+}
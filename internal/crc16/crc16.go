@@ -0,0 +1,23 @@
+// Package crc16 implements the CRC-16/CCITT-FALSE checksum used to protect data persisted in NVM
+package crc16
+
+// Checksum computes the CRC-16/CCITT-FALSE (polynomial 0x1021, initial value 0xFFFF) of data
+func Checksum(data []byte) uint16 {
+	return Update(0xFFFF, data)
+}
+
+// Update continues computing a checksum over further data
+func Update(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = (crc << 1) ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,25 @@
+package crc16_test
+
+import (
+	"testing"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483/internal/crc16"
+)
+
+func TestChecksum(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.Spec("matches the standard check value", func(t *testing.T) {
+		Expect(t, crc16.Checksum([]byte("123456789"))).To(Equal(uint16(0x29B1)))
+	})
+
+	o.Spec("can be computed incrementally", func(t *testing.T) {
+		crc := crc16.Update(crc16.Checksum([]byte("1234")), []byte("56789"))
+		Expect(t, crc).To(Equal(uint16(0x29B1)))
+	})
+}
@@ -0,0 +1,137 @@
+//go:build linux
+// +build linux
+
+// Package termios provides minimal helpers for configuring terminal devices (serial ports and pseudo-terminals)
+package termios
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Control invokes f with the file's descriptor without disturbing its non-blocking mode
+func Control(f *os.File, fn func(fd int) error) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("error accessing file descriptor: %w", err)
+	}
+
+	var fnErr error
+	err = conn.Control(func(fd uintptr) {
+		fnErr = fn(int(fd))
+	})
+	if err != nil {
+		return fmt.Errorf("error accessing file descriptor: %w", err)
+	}
+
+	return fnErr
+}
+
+// Get retrieves the terminal attributes of the given file
+func Get(f *os.File) (*unix.Termios, error) {
+	var t *unix.Termios
+	err := Control(f, func(fd int) (err error) {
+		t, err = unix.IoctlGetTermios(fd, unix.TCGETS)
+		return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting terminal attributes: %w", err)
+	}
+	return t, nil
+}
+
+// Set applies the terminal attributes to the given file
+func Set(f *os.File, t *unix.Termios) error {
+	err := Control(f, func(fd int) error {
+		return unix.IoctlSetTermios(fd, unix.TCSETS, t)
+	})
+	if err != nil {
+		return fmt.Errorf("error setting terminal attributes: %w", err)
+	}
+	return nil
+}
+
+// MakeRaw configures the terminal for raw 8-bit data with no echo, line editing or character translation, equivalent
+// to cfmakeraw(3)
+func MakeRaw(f *os.File) error {
+	t, err := Get(f)
+	if err != nil {
+		return err
+	}
+
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB
+	t.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+
+	return Set(f, t)
+}
+
+var baudRates = map[uint]uint32{
+	1200:   unix.B1200,
+	2400:   unix.B2400,
+	4800:   unix.B4800,
+	9600:   unix.B9600,
+	19200:  unix.B19200,
+	38400:  unix.B38400,
+	57600:  unix.B57600,
+	115200: unix.B115200,
+	230400: unix.B230400,
+}
+
+// SetBaudRate changes the baud rate of the terminal, only standard baud rates are supported
+func SetBaudRate(f *os.File, baud uint) error {
+	speed, ok := baudRates[baud]
+	if !ok {
+		return fmt.Errorf("unsupported baud rate: %d", baud)
+	}
+
+	t, err := Get(f)
+	if err != nil {
+		return err
+	}
+
+	t.Cflag &^= unix.CBAUD
+	t.Cflag |= speed
+	t.Ispeed = speed
+	t.Ospeed = speed
+
+	return Set(f, t)
+}
+
+// FlushInput discards any data received by the terminal but not yet read
+func FlushInput(f *os.File) error {
+	err := Control(f, func(fd int) error {
+		return unix.IoctlSetInt(fd, unix.TCFLSH, unix.TCIFLUSH)
+	})
+	if err != nil {
+		return fmt.Errorf("error flushing terminal input: %w", err)
+	}
+	return nil
+}
+
+// SendBreak holds a break condition on the terminal for the given duration
+func SendBreak(f *os.File, duration time.Duration) error {
+	err := Control(f, func(fd int) error {
+		return unix.IoctlSetInt(fd, unix.TIOCSBRK, 0)
+	})
+	if err != nil {
+		return fmt.Errorf("error starting break: %w", err)
+	}
+
+	time.Sleep(duration)
+
+	err = Control(f, func(fd int) error {
+		return unix.IoctlSetInt(fd, unix.TIOCCBRK, 0)
+	})
+	if err != nil {
+		return fmt.Errorf("error ending break: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package rn2483_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/poy/onpar"
 	. "github.com/poy/onpar/expect"
@@ -26,4 +27,14 @@ func TestMac(t *testing.T) {
 		Expect(t, duration).To(Equal(fake.MaxPauseDuration))
 		Expect(t, ctx.fake.Mac.IsPaused()).To(BeTrue())
 	})
+	o.Spec("mac pause expires once the pause duration elapses", func(t *testing.T, ctx *testContext) {
+		duration, err := ctx.device.PauseMAC()
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		ctx.clock.Advance(duration - time.Millisecond)
+		Expect(t, ctx.fake.Mac.IsPaused()).To(BeTrue())
+
+		ctx.clock.Advance(time.Millisecond)
+		Expect(t, ctx.fake.Mac.IsPaused()).To(BeFalse())
+	})
 }
@@ -0,0 +1,71 @@
+package rn2483
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Metrics receives measurements of a device's operation, see Config.Metrics. The metrics package provides an
+// implementation that can be scraped by Prometheus.
+type Metrics interface {
+	// CommandExecuted records a command completing, identified by its verb (see CommandVerb), along with its outcome
+	// (see CommandOutcome) and how long it took including any retries
+	CommandExecuted(verb string, outcome string, latency time.Duration)
+	// PacketTransmitted records a packet being transmitted, along with how long the transmission took (from the
+	// command being sent until the device reported its completion), which approximates its time on air
+	PacketTransmitted(size int, airtime time.Duration)
+	// PacketReceived records a packet being received
+	PacketReceived(size int)
+	// ReceiveTimedOut records a receive window elapsing without a packet being received
+	ReceiveTimedOut()
+	// VDDMeasured records the supply voltage reported by the device
+	VDDMeasured(vdd Voltage)
+	// SNRMeasured records the signal to noise ratio of the last received packet reported by the device, in dB
+	SNRMeasured(snr int)
+}
+
+// nopMetrics discards all measurements, used when no Metrics are configured
+type nopMetrics struct{}
+
+func (nopMetrics) CommandExecuted(string, string, time.Duration) {}
+func (nopMetrics) PacketTransmitted(int, time.Duration)          {}
+func (nopMetrics) PacketReceived(int)                            {}
+func (nopMetrics) ReceiveTimedOut()                              {}
+func (nopMetrics) VDDMeasured(Voltage)                           {}
+func (nopMetrics) SNRMeasured(int)                               {}
+
+// CommandVerb identifies the kind of a command without its arguments, such as "radio tx" or "sys get vdd", so that
+// commands can be grouped without an unbounded number of groups
+func CommandVerb(command string) string {
+	tokens := strings.Fields(command)
+	length := 2
+	if len(tokens) > 2 && (tokens[1] == "get" || tokens[1] == "set") {
+		length = 3
+	}
+	if len(tokens) < length {
+		length = len(tokens)
+	}
+
+	return strings.Join(tokens[:length], " ")
+}
+
+// CommandOutcome classifies the result of a command: "ok" if it succeeded, otherwise the kind of failure
+func CommandOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrInvalidParam):
+		return "invalid_param"
+	case errors.Is(err, ErrTransceiverBusy):
+		return "busy"
+	case errors.Is(err, ErrResponseTimeout):
+		return "timeout"
+	case errors.Is(err, ErrUnexpectedReset):
+		return "reset"
+	case errors.Is(err, ErrUnknown):
+		return "unknown"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the Prometheus text exposition format written by Collector.WriteTo
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ServeHTTP serves the collected metrics for scraping by Prometheus
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = c.WriteTo(w)
+}
+
+// WriteTo writes the collected metrics in the Prometheus text exposition format
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := &exporter{
+		w:         bufio.NewWriter(w),
+		namespace: c.namespace,
+	}
+
+	names := make([]string, 0, len(c.devices))
+	for name := range c.devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	e.family("commands_total", "counter", "Commands executed, by verb and outcome.")
+	for _, name := range names {
+		m := c.devices[name]
+		keys := make([]commandKey, 0, len(m.commands))
+		for key := range m.commands {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].verb != keys[j].verb {
+				return keys[i].verb < keys[j].verb
+			}
+			return keys[i].outcome < keys[j].outcome
+		})
+
+		for _, key := range keys {
+			e.sample("commands_total", float64(m.commands[key]), "device", name, "verb", key.verb,
+				"outcome", key.outcome)
+		}
+	}
+
+	e.family("command_duration_seconds", "histogram", "Time taken to execute commands, including retries.")
+	for _, name := range names {
+		m := c.devices[name]
+		verbs := make([]string, 0, len(m.latency))
+		for verb := range m.latency {
+			verbs = append(verbs, verb)
+		}
+		sort.Strings(verbs)
+
+		for _, verb := range verbs {
+			h := m.latency[verb]
+			var cumulative uint64
+			for i, bound := range c.buckets {
+				cumulative += h.counts[i]
+				e.sample("command_duration_seconds_bucket", float64(cumulative), "device", name, "verb", verb,
+					"le", formatFloat(bound))
+			}
+			e.sample("command_duration_seconds_bucket", float64(h.count), "device", name, "verb", verb,
+				"le", "+Inf")
+			e.sample("command_duration_seconds_sum", h.sum, "device", name, "verb", verb)
+			e.sample("command_duration_seconds_count", float64(h.count), "device", name, "verb", verb)
+		}
+	}
+
+	perDevice := []struct {
+		name  string
+		kind  string
+		help  string
+		value func(m *deviceMetrics) *float64
+	}{
+		{"tx_packets_total", "counter", "Packets transmitted.", func(m *deviceMetrics) *float64 {
+			return counter(m.txPackets)
+		}},
+		{"tx_bytes_total", "counter", "Payload bytes transmitted.", func(m *deviceMetrics) *float64 {
+			return counter(m.txBytes)
+		}},
+		{"tx_airtime_seconds_total", "counter", "Time spent transmitting packets.", func(m *deviceMetrics) *float64 {
+			seconds := m.txAirtime.Seconds()
+			return &seconds
+		}},
+		{"rx_packets_total", "counter", "Packets received.", func(m *deviceMetrics) *float64 {
+			return counter(m.rxPackets)
+		}},
+		{"rx_bytes_total", "counter", "Payload bytes received.", func(m *deviceMetrics) *float64 {
+			return counter(m.rxBytes)
+		}},
+		{"rx_timeouts_total", "counter", "Receive windows that elapsed without a packet.",
+			func(m *deviceMetrics) *float64 {
+				return counter(m.rxTimeouts)
+			}},
+		{"vdd_volts", "gauge", "Supply voltage most recently measured by the device.", func(m *deviceMetrics) *float64 {
+			return m.vdd
+		}},
+		{"snr_db", "gauge", "Signal to noise ratio of the last packet received, as most recently reported.",
+			func(m *deviceMetrics) *float64 {
+				return m.snr
+			}},
+	}
+	for _, metric := range perDevice {
+		e.family(metric.name, metric.kind, metric.help)
+		for _, name := range names {
+			if value := metric.value(c.devices[name]); value != nil {
+				e.sample(metric.name, *value, "device", name)
+			}
+		}
+	}
+
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.written, e.err
+}
+
+func counter(value uint64) *float64 {
+	f := float64(value)
+	return &f
+}
+
+// exporter writes metrics in the text exposition format, remembering the first error encountered
+type exporter struct {
+	w         *bufio.Writer
+	namespace string
+	written   int64
+	err       error
+}
+
+func (e *exporter) printf(format string, a ...interface{}) {
+	if e.err != nil {
+		return
+	}
+
+	n, err := fmt.Fprintf(e.w, format, a...)
+	e.written += int64(n)
+	e.err = err
+}
+
+func (e *exporter) family(name, kind, help string) {
+	e.printf("# HELP %s_%s %s\n", e.namespace, name, help)
+	e.printf("# TYPE %s_%s %s\n", e.namespace, name, kind)
+}
+
+// sample writes a single value, with labels given as alternating names and values
+func (e *exporter) sample(name string, value float64, labels ...string) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1])))
+	}
+
+	e.printf("%s_%s{%s} %s\n", e.namespace, name, strings.Join(pairs, ","), formatFloat(value))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,191 @@
+// Package metrics collects measurements of device operations (see rn2483.Metrics) and exports them in the Prometheus
+// text exposition format, so that they can be scraped without depending on the Prometheus client library.
+//
+// A single Collector can serve many devices, each distinguished by a device label:
+//
+//	collector := metrics.New(metrics.Config{})
+//	device := rn2483.New(rn2483.Config{
+//		Serial:  serial,
+//		Metrics: collector.Device("lostik0"),
+//	})
+//	http.Handle("/metrics", collector)
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/omaskery/rn2483"
+)
+
+// DefaultNamespace prefixes the names of all metrics when no namespace is configured
+const DefaultNamespace = "rn2483"
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the command latency histogram buckets when none are
+// configured
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Config configures a Collector
+type Config struct {
+	// Namespace prefixes the names of all metrics, defaulting to DefaultNamespace
+	Namespace string
+	// LatencyBuckets are the upper bounds, in seconds and in increasing order, of the command latency histogram
+	// buckets, defaulting to DefaultLatencyBuckets
+	LatencyBuckets []float64
+}
+
+// Collector accumulates measurements from any number of devices, and is safe for concurrent use
+type Collector struct {
+	namespace string
+	buckets   []float64
+
+	mu      sync.Mutex
+	devices map[string]*deviceMetrics
+}
+
+// New creates a Collector
+func New(cfg Config) *Collector {
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	buckets := cfg.LatencyBuckets
+	if buckets == nil {
+		buckets = DefaultLatencyBuckets
+	}
+
+	return &Collector{
+		namespace: namespace,
+		buckets:   buckets,
+		devices:   map[string]*deviceMetrics{},
+	}
+}
+
+// Device returns the metrics for the named device, for use as rn2483.Config.Metrics
+func (c *Collector) Device(name string) rn2483.Metrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.devices[name]; !ok {
+		c.devices[name] = &deviceMetrics{
+			commands: map[commandKey]uint64{},
+			latency:  map[string]*histogram{},
+		}
+	}
+
+	return &deviceRecorder{
+		collector: c,
+		name:      name,
+	}
+}
+
+type commandKey struct {
+	verb    string
+	outcome string
+}
+
+type histogram struct {
+	// counts holds the number of observations in each bucket, with the last counting those above every bound
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, value float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets)+1)
+	}
+
+	index := len(buckets)
+	for i, bound := range buckets {
+		if value <= bound {
+			index = i
+			break
+		}
+	}
+
+	h.counts[index]++
+	h.sum += value
+	h.count++
+}
+
+// deviceMetrics holds the measurements of a single device
+type deviceMetrics struct {
+	commands map[commandKey]uint64
+	latency  map[string]*histogram
+
+	txPackets  uint64
+	txBytes    uint64
+	txAirtime  time.Duration
+	rxPackets  uint64
+	rxBytes    uint64
+	rxTimeouts uint64
+
+	// vdd and snr are nil until measured, so that no value is reported rather than a misleading zero
+	vdd *float64
+	snr *float64
+}
+
+// deviceRecorder records measurements of a single device into its Collector
+type deviceRecorder struct {
+	collector *Collector
+	name      string
+}
+
+func (r *deviceRecorder) update(f func(m *deviceMetrics)) {
+	r.collector.mu.Lock()
+	defer r.collector.mu.Unlock()
+
+	f(r.collector.devices[r.name])
+}
+
+func (r *deviceRecorder) CommandExecuted(verb string, outcome string, latency time.Duration) {
+	r.update(func(m *deviceMetrics) {
+		m.commands[commandKey{verb: verb, outcome: outcome}]++
+
+		h, ok := m.latency[verb]
+		if !ok {
+			h = &histogram{}
+			m.latency[verb] = h
+		}
+		h.observe(r.collector.buckets, latency.Seconds())
+	})
+}
+
+func (r *deviceRecorder) PacketTransmitted(size int, airtime time.Duration) {
+	r.update(func(m *deviceMetrics) {
+		m.txPackets++
+		m.txBytes += uint64(size)
+		m.txAirtime += airtime
+	})
+}
+
+func (r *deviceRecorder) PacketReceived(size int) {
+	r.update(func(m *deviceMetrics) {
+		m.rxPackets++
+		m.rxBytes += uint64(size)
+	})
+}
+
+func (r *deviceRecorder) ReceiveTimedOut() {
+	r.update(func(m *deviceMetrics) {
+		m.rxTimeouts++
+	})
+}
+
+func (r *deviceRecorder) VDDMeasured(vdd rn2483.Voltage) {
+	r.update(func(m *deviceMetrics) {
+		volts := vdd.Volts()
+		m.vdd = &volts
+	})
+}
+
+func (r *deviceRecorder) SNRMeasured(snr int) {
+	r.update(func(m *deviceMetrics) {
+		value := float64(snr)
+		m.snr = &value
+	})
+}
+
+var _ rn2483.Metrics = (*deviceRecorder)(nil)
@@ -0,0 +1,166 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/metrics"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+type testContext struct {
+	clock     clockwork.FakeClock
+	fake      *fake.Device
+	device    *rn2483.Device
+	collector *metrics.Collector
+}
+
+// export renders the collected metrics, as scraped by Prometheus
+func (ctx *testContext) export(t *testing.T) []string {
+	var buffer bytes.Buffer
+	_, err := ctx.collector.WriteTo(&buffer)
+	Expect(t, err).To(Not(HaveOccurred()))
+
+	return strings.Split(buffer.String(), "\n")
+}
+
+func TestMetrics(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		logger := testutils.CreateTestLogger(t)
+		clock := clockwork.NewFakeClock()
+		collector := metrics.New(metrics.Config{
+			LatencyBuckets: []float64{0.1, 1},
+		})
+
+		f := fake.New(fake.Config{
+			Logger: logger.WithName("fake-device"),
+			Clock:  clock,
+		})
+		d := rn2483.New(rn2483.Config{
+			Serial:  f,
+			Clock:   clock,
+			Metrics: collector.Device("lostik0"),
+		})
+		t.Cleanup(func() {
+			if err := d.Close(); err != nil {
+				logger.Error(err, "error cleaning up fake device")
+			}
+		})
+
+		return t, &testContext{
+			clock:     clock,
+			fake:      f,
+			device:    d,
+			collector: collector,
+		}
+	})
+
+	o.Spec("counts commands by verb and outcome", func(t *testing.T, ctx *testContext) {
+		Expect(t, ctx.device.SetRadioPower(5)).To(Not(HaveOccurred()))
+		Expect(t, ctx.device.SetRadioPower(6)).To(Not(HaveOccurred()))
+		Expect(t, ctx.device.SetRadioParameter("sf", "sf99")).To(HaveOccurred())
+
+		lines := ctx.export(t)
+		Expect(t, lines).To(Contain(
+			"# TYPE rn2483_commands_total counter",
+			`rn2483_commands_total{device="lostik0",verb="radio set pwr",outcome="ok"} 2`,
+			`rn2483_commands_total{device="lostik0",verb="radio set sf",outcome="invalid_param"} 1`,
+			"# TYPE rn2483_command_duration_seconds histogram",
+			`rn2483_command_duration_seconds_bucket{device="lostik0",verb="radio set pwr",le="0.1"} 2`,
+			`rn2483_command_duration_seconds_bucket{device="lostik0",verb="radio set pwr",le="+Inf"} 2`,
+			`rn2483_command_duration_seconds_count{device="lostik0",verb="radio set pwr"} 2`,
+		))
+	})
+
+	o.Spec("counts packets and airtime", func(t *testing.T, ctx *testContext) {
+		_, err := ctx.device.PauseMAC()
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		ctx.fake.Radio.Tx = func(d *fake.Device, packet []byte) error {
+			ctx.clock.Advance(40 * time.Millisecond)
+			return nil
+		}
+		Expect(t, ctx.device.RadioTx([]byte("hello"))).To(Not(HaveOccurred()))
+
+		rxChan := make(chan []byte, 1)
+		rxChan <- []byte("hi")
+		ctx.fake.Radio.Rx = func(d *fake.Device) <-chan []byte {
+			return rxChan
+		}
+		_, err = ctx.device.RadioRx(rn2483.ContinuousReceiveMode)
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		lines := ctx.export(t)
+		Expect(t, lines).To(Contain(
+			`rn2483_tx_packets_total{device="lostik0"} 1`,
+			`rn2483_tx_bytes_total{device="lostik0"} 5`,
+			`rn2483_tx_airtime_seconds_total{device="lostik0"} 0.04`,
+			`rn2483_rx_packets_total{device="lostik0"} 1`,
+			`rn2483_rx_bytes_total{device="lostik0"} 2`,
+			`rn2483_rx_timeouts_total{device="lostik0"} 0`,
+		))
+	})
+
+	o.Spec("counts receive timeouts", func(t *testing.T, ctx *testContext) {
+		_, err := ctx.device.PauseMAC()
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		errChan := make(chan error)
+		go func() {
+			_, err := ctx.device.RadioRx(100)
+			errChan <- err
+		}()
+
+		ctx.clock.BlockUntil(1)
+		ctx.clock.Advance(100 * time.Millisecond)
+		Expect(t, <-errChan).To(testutils.MatchError(rn2483.ErrReceiveTimeout))
+
+		Expect(t, ctx.export(t)).To(Contain(`rn2483_rx_timeouts_total{device="lostik0"} 1`))
+	})
+
+	o.Spec("reports gauges only once measured", func(t *testing.T, ctx *testContext) {
+		Expect(t, strings.Join(ctx.export(t), "\n")).To(Not(ContainSubstring("rn2483_vdd_volts{")))
+
+		_, err := ctx.device.GetVDD()
+		Expect(t, err).To(Not(HaveOccurred()))
+		snr, err := ctx.device.GetRadioSNR()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, snr).To(Equal(-128))
+
+		exported := strings.Join(ctx.export(t), "\n")
+		// the fake device's supply voltage fluctuates slightly around 3.3V
+		Expect(t, exported).To(ContainSubstring(`rn2483_vdd_volts{device="lostik0"} 3.3`))
+		Expect(t, exported).To(ContainSubstring(`rn2483_snr_db{device="lostik0"} -128`))
+	})
+
+	o.Spec("serves metrics over HTTP", func(t *testing.T, ctx *testContext) {
+		_, err := ctx.device.GetVDD()
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		recorder := httptest.NewRecorder()
+		ctx.collector.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		Expect(t, recorder.Header().Get("Content-Type")).To(Equal(metrics.ContentType))
+		Expect(t, recorder.Body.String()).To(ContainSubstring(
+			`rn2483_commands_total{device="lostik0",verb="sys get vdd",outcome="ok"} 1`))
+	})
+
+	o.Spec("escapes label values", func(t *testing.T, ctx *testContext) {
+		m := ctx.collector.Device("quote\"d\\")
+		m.ReceiveTimedOut()
+
+		Expect(t, ctx.export(t)).To(Contain(`rn2483_rx_timeouts_total{device="quote\"d\\"} 1`))
+	})
+}
@@ -0,0 +1,395 @@
+package netserial
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/multierr"
+
+	"github.com/omaskery/rn2483"
+)
+
+// DefaultBaudRate is the baud rate the RN2483 uses unless configured otherwise
+const DefaultBaudRate uint = 57600
+
+// BridgeConfig configures a Bridge
+type BridgeConfig struct {
+	Logger logr.Logger
+	// Mode selects the protocol spoken to clients, defaulting to ModeRaw
+	Mode Mode
+	// Device is the local serial device (or fake.Device) to expose. RFC 2217 clients are able to change the baud
+	// rate, send breaks and purge received data where the device supports it (see rn2483.AdaptTransport).
+	Device io.ReadWriteCloser
+	// BaudRate is the baud rate the device was opened with, reported to RFC 2217 clients that query it until a client
+	// changes it, defaulting to DefaultBaudRate
+	BaudRate uint
+}
+
+// Bridge exposes a local serial device to clients connecting over TCP. Only one client may use the device at a time,
+// further clients are disconnected until the current client leaves.
+type Bridge struct {
+	cfg       BridgeConfig
+	transport rn2483.Transport
+
+	lock      sync.Mutex
+	session   *bridgeSession
+	listeners []net.Listener
+	closed    bool
+	baudRate  uint
+
+	deviceStopped chan struct{}
+}
+
+// NewBridge creates a new Bridge, immediately taking ownership of the device
+func NewBridge(cfg BridgeConfig) (*Bridge, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = logr.Discard()
+	}
+
+	if cfg.Mode == "" {
+		cfg.Mode = ModeRaw
+	}
+
+	if cfg.Mode != ModeRaw && cfg.Mode != ModeRFC2217 {
+		return nil, fmt.Errorf("unknown mode: %s", cfg.Mode)
+	}
+
+	if cfg.Device == nil {
+		return nil, errors.New("no device provided to bridge")
+	}
+
+	if cfg.BaudRate == 0 {
+		cfg.BaudRate = DefaultBaudRate
+	}
+
+	b := &Bridge{
+		cfg:           cfg,
+		transport:     rn2483.AdaptTransport(cfg.Device),
+		baudRate:      cfg.BaudRate,
+		deviceStopped: make(chan struct{}),
+	}
+
+	go b.forwardDeviceOutput()
+
+	return b, nil
+}
+
+// ListenAndServe listens on the given TCP address and serves clients until the Bridge is closed
+func (b *Bridge) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", address, err)
+	}
+
+	return b.Serve(listener)
+}
+
+// Serve accepts clients from the listener until the Bridge is closed, the listener is closed when Serve returns
+func (b *Bridge) Serve(listener net.Listener) error {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return listener.Close()
+	}
+	b.listeners = append(b.listeners, listener)
+	b.lock.Unlock()
+
+	b.cfg.Logger.Info("serving device", "address", listener.Addr().String(), "mode", b.cfg.Mode)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			b.lock.Lock()
+			closed := b.closed
+			b.lock.Unlock()
+
+			if closed {
+				return nil
+			}
+
+			_ = listener.Close()
+			return fmt.Errorf("error accepting client: %w", err)
+		}
+
+		go b.serveClient(conn)
+	}
+}
+
+// Close stops serving clients, disconnects any current client and closes the device
+func (b *Bridge) Close() error {
+	b.lock.Lock()
+	b.closed = true
+	listeners := b.listeners
+	session := b.session
+	b.lock.Unlock()
+
+	var err error
+	for _, listener := range listeners {
+		err = multierr.Append(err, listener.Close())
+	}
+
+	if session != nil {
+		err = multierr.Append(err, session.conn.Close())
+	}
+
+	err = multierr.Append(err, b.cfg.Device.Close())
+	<-b.deviceStopped
+
+	return err
+}
+
+func (b *Bridge) forwardDeviceOutput() {
+	defer close(b.deviceStopped)
+
+	buffer := make([]byte, 1024)
+	for {
+		n, err := b.cfg.Device.Read(buffer)
+		if n > 0 {
+			b.writeToClient(buffer[:n])
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				b.cfg.Logger.Error(err, "error reading from device")
+			}
+			break
+		}
+	}
+
+	b.lock.Lock()
+	session := b.session
+	b.lock.Unlock()
+
+	if session != nil {
+		_ = session.conn.Close()
+	}
+}
+
+// writeToClient forwards device output to the current client, if any. The write is made without holding the bridge's
+// lock, so that a stalled client cannot prevent the bridge from being closed or other clients being refused.
+func (b *Bridge) writeToClient(data []byte) {
+	b.lock.Lock()
+	session := b.session
+	b.lock.Unlock()
+
+	if session == nil {
+		b.cfg.Logger.V(1).Info("no client connected: discarding device output", "n", len(data))
+		return
+	}
+
+	if b.cfg.Mode == ModeRFC2217 {
+		data = escapeIAC(data)
+	}
+
+	if err := session.write(data); err != nil {
+		session.logger.Error(err, "error writing to client")
+	}
+}
+
+func (b *Bridge) serveClient(conn net.Conn) {
+	logger := b.cfg.Logger.WithValues("client", conn.RemoteAddr().String())
+
+	session := &bridgeSession{
+		bridge: b,
+		logger: logger,
+		conn:   conn,
+	}
+
+	b.lock.Lock()
+	if b.session != nil || b.closed {
+		b.lock.Unlock()
+		logger.Info("device busy: refusing client")
+		_ = conn.Close()
+		return
+	}
+	b.session = session
+	b.lock.Unlock()
+
+	logger.Info("client connected")
+	defer func() {
+		b.lock.Lock()
+		b.session = nil
+		b.lock.Unlock()
+
+		_ = conn.Close()
+		logger.Info("client disconnected")
+	}()
+
+	if err := session.run(); err != nil {
+		logger.Error(err, "error serving client")
+	}
+}
+
+// bridgeSession holds the state of a single client connected to a Bridge
+type bridgeSession struct {
+	bridge *Bridge
+	logger logr.Logger
+	conn   net.Conn
+
+	// writeLock serialises writes to the client, which are made by both the session and the bridge
+	writeLock sync.Mutex
+
+	decoder    telnetDecoder
+	breakStart time.Time
+}
+
+func (s *bridgeSession) run() error {
+	if s.bridge.cfg.Mode == ModeRFC2217 {
+		s.decoder.onCommand = s.handleCommand
+		s.decoder.onSubnegotiation = s.handleSubnegotiation
+
+		var offer []byte
+		offer = append(offer, command(telnetDO, optionComPort)...)
+		offer = append(offer, command(telnetWILL, optionBinary)...)
+		offer = append(offer, command(telnetDO, optionBinary)...)
+		offer = append(offer, command(telnetWILL, optionSuppressGoAhead)...)
+		offer = append(offer, command(telnetDO, optionSuppressGoAhead)...)
+		if err := s.write(offer); err != nil {
+			return fmt.Errorf("error negotiating telnet options: %w", err)
+		}
+	}
+
+	buffer := make([]byte, 1024)
+	for {
+		n, err := s.conn.Read(buffer)
+		data := buffer[:n]
+		if s.bridge.cfg.Mode == ModeRFC2217 {
+			data = s.decoder.decode(data)
+		}
+
+		if len(data) > 0 {
+			if _, err := s.bridge.cfg.Device.Write(data); err != nil {
+				return fmt.Errorf("error writing to device: %w", err)
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("error reading from client: %w", err)
+		}
+	}
+}
+
+func (s *bridgeSession) write(data []byte) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	_, err := s.conn.Write(data)
+	return err
+}
+
+func (s *bridgeSession) handleCommand(verb, option byte) {
+	var refusal byte
+	switch verb {
+	case telnetWILL:
+		if option == optionComPort || option == optionBinary || option == optionSuppressGoAhead {
+			return
+		}
+		refusal = telnetDONT
+	case telnetDO:
+		if option == optionBinary || option == optionSuppressGoAhead {
+			return
+		}
+		refusal = telnetWONT
+	default:
+		return
+	}
+
+	if err := s.write(command(refusal, option)); err != nil {
+		s.logger.Error(err, "error refusing telnet option", "option", option)
+	}
+}
+
+func (s *bridgeSession) handleSubnegotiation(payload []byte) {
+	if len(payload) < 2 || payload[0] != optionComPort {
+		s.logger.V(1).Info("ignoring unknown subnegotiation", "payload", payload)
+		return
+	}
+
+	cmd := payload[1]
+	value := payload[2:]
+
+	switch cmd {
+	case comPortSetBaudRate:
+		if len(value) == 4 {
+			baud := binary.BigEndian.Uint32(value)
+			if baud != 0 {
+				s.setBaudRate(uint(baud))
+			}
+			// the reply reports the baud rate in use, which answers clients querying it with a baud rate of 0
+			value = encodeUint32(uint32(s.bridge.currentBaudRate()))
+		}
+	case comPortSetControl:
+		if len(value) == 1 {
+			switch value[0] {
+			case controlBreakOn:
+				s.breakStart = time.Now()
+			case controlBreakOff:
+				s.sendBreak(time.Since(s.breakStart))
+			}
+		}
+	case comPortPurgeData:
+		if len(value) == 1 && (value[0] == purgeReceiveBuffer || value[0] == purgeBothBuffers) {
+			s.purge()
+		}
+	case comPortSetDataSize, comPortSetParity, comPortSetStopSize:
+		// accepted but not applied, the RN2483 only supports 8N1
+	default:
+		s.logger.V(1).Info("ignoring unsupported com port command", "command", cmd)
+	}
+
+	if err := s.write(comPortCommand(cmd+serverReplyOffset, value)); err != nil {
+		s.logger.Error(err, "error replying to com port command", "command", cmd)
+	}
+}
+
+func (s *bridgeSession) setBaudRate(baud uint) {
+	s.logger.Info("changing baud rate", "baud", baud)
+	err := s.bridge.transport.SetBaudRate(baud)
+	switch {
+	case errors.Is(err, rn2483.ErrUnsupportedByTransport):
+		s.logger.Info("device does not support changing baud rate", "baud", baud)
+	case err != nil:
+		s.logger.Error(err, "error changing baud rate", "baud", baud)
+	default:
+		s.bridge.lock.Lock()
+		s.bridge.baudRate = baud
+		s.bridge.lock.Unlock()
+	}
+}
+
+func (b *Bridge) currentBaudRate() uint {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.baudRate
+}
+
+func (s *bridgeSession) purge() {
+	s.logger.V(1).Info("purging received data")
+	err := s.bridge.transport.Flush()
+	switch {
+	case errors.Is(err, rn2483.ErrUnsupportedByTransport):
+		s.logger.V(1).Info("device does not support purging received data")
+	case err != nil:
+		s.logger.Error(err, "error purging received data")
+	}
+}
+
+func (s *bridgeSession) sendBreak(duration time.Duration) {
+	s.logger.V(1).Info("sending break", "duration", duration)
+	err := s.bridge.transport.SendBreak(duration)
+	switch {
+	case errors.Is(err, rn2483.ErrBreakUnsupported):
+		s.logger.Info("device does not support sending a break")
+	case err != nil:
+		s.logger.Error(err, "error sending break")
+	}
+}
@@ -0,0 +1,283 @@
+// Package netserial provides access to serial devices over TCP, either as a raw byte stream or using the RFC 2217
+// telnet com port control protocol, along with a Bridge for exposing a local device on the network
+package netserial
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/omaskery/rn2483"
+)
+
+// DefaultNegotiationTimeout is how long to wait for the server to accept the com port option, when not configured
+const DefaultNegotiationTimeout = 5 * time.Second
+
+var (
+	ErrRawMode = fmt.Errorf("%w: operation not supported in raw mode", rn2483.ErrUnsupportedByTransport)
+	// ErrComPortRefused is returned when dialing a server that refuses the RFC 2217 com port option
+	ErrComPortRefused = errors.New("server refused the com port option")
+)
+
+// Mode selects the protocol used to carry serial data over TCP
+type Mode string
+
+const (
+	// ModeRaw sends serial data directly over the TCP connection, with no way of controlling the serial port
+	ModeRaw Mode = "raw"
+	// ModeRFC2217 sends serial data using the telnet com port control protocol, allowing for setting the baud rate
+	// and sending breaks
+	ModeRFC2217 Mode = "rfc2217"
+)
+
+// DialConfig configures a connection to a remote serial device
+type DialConfig struct {
+	Logger logr.Logger
+	// Mode selects the protocol to speak, defaulting to ModeRaw
+	Mode Mode
+	// Timeout limits how long establishing the connection may take, zero means no timeout
+	Timeout time.Duration
+	// BaudRate, if non-zero, is requested of the remote serial port once connected (ModeRFC2217 only)
+	BaudRate uint
+	// NegotiationTimeout limits how long to wait for the server to accept the com port option, defaulting to
+	// DefaultNegotiationTimeout (ModeRFC2217 only)
+	NegotiationTimeout time.Duration
+}
+
+// Conn is a connection to a remote serial device, satisfying the rn2483.Transport interface
+type Conn struct {
+	logger logr.Logger
+	conn   net.Conn
+	mode   Mode
+
+	writeLock sync.Mutex
+	decoder   telnetDecoder
+
+	// comPortAccepted and comPortRefused record the server's response to the com port option
+	comPortAccepted bool
+	comPortRefused  bool
+	// received holds data received while negotiating, until it is read
+	received []byte
+}
+
+// Dial connects to a remote serial device at the given TCP address. In ModeRFC2217, Dial waits for the server to accept
+// the com port option, failing with ErrComPortRefused if it refuses.
+func Dial(address string, cfg DialConfig) (*Conn, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = logr.Discard()
+	}
+
+	if cfg.Mode == "" {
+		cfg.Mode = ModeRaw
+	}
+
+	if cfg.Mode != ModeRaw && cfg.Mode != ModeRFC2217 {
+		return nil, fmt.Errorf("unknown mode: %s", cfg.Mode)
+	}
+
+	conn, err := net.DialTimeout("tcp", address, cfg.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", address, err)
+	}
+
+	c := &Conn{
+		logger: cfg.Logger,
+		conn:   conn,
+		mode:   cfg.Mode,
+	}
+	c.decoder.onCommand = c.handleCommand
+	c.decoder.onSubnegotiation = c.handleSubnegotiation
+
+	if c.mode == ModeRFC2217 {
+		negotiationTimeout := cfg.NegotiationTimeout
+		if negotiationTimeout == 0 {
+			negotiationTimeout = DefaultNegotiationTimeout
+		}
+
+		if err := c.negotiate(negotiationTimeout); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		if cfg.BaudRate != 0 {
+			if err := c.SetBaudRate(cfg.BaudRate); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// negotiate requests the telnet options needed for RFC 2217, waiting until the server accepts the com port option as
+// com port commands sent before then may be ignored
+func (c *Conn) negotiate(timeout time.Duration) error {
+	var request []byte
+	request = append(request, command(telnetWILL, optionComPort)...)
+	request = append(request, command(telnetWILL, optionBinary)...)
+	request = append(request, command(telnetDO, optionBinary)...)
+	request = append(request, command(telnetWILL, optionSuppressGoAhead)...)
+	request = append(request, command(telnetDO, optionSuppressGoAhead)...)
+
+	if err := c.writeRaw(request); err != nil {
+		return fmt.Errorf("error negotiating telnet options: %w", err)
+	}
+
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return fmt.Errorf("error negotiating telnet options: %w", err)
+	}
+	defer func() {
+		_ = c.conn.SetReadDeadline(time.Time{})
+	}()
+
+	buffer := make([]byte, 1024)
+	for !c.comPortAccepted {
+		if c.comPortRefused {
+			return ErrComPortRefused
+		}
+
+		n, err := c.conn.Read(buffer)
+		c.received = append(c.received, c.decoder.decode(buffer[:n])...)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("timed out waiting for the server to accept the com port option: %w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("error negotiating telnet options: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Conn) handleCommand(verb, option byte) {
+	c.logger.V(2).Info("received telnet command", "verb", verb, "option", option)
+
+	var refusal byte
+	switch verb {
+	case telnetDO:
+		if option == optionComPort {
+			c.comPortAccepted = true
+		}
+		if option == optionComPort || option == optionBinary || option == optionSuppressGoAhead {
+			return
+		}
+		refusal = telnetWONT
+	case telnetWILL:
+		if option == optionBinary || option == optionSuppressGoAhead {
+			return
+		}
+		refusal = telnetDONT
+	case telnetDONT:
+		if option == optionComPort {
+			c.comPortRefused = true
+		}
+		return
+	default:
+		return
+	}
+
+	if err := c.writeRaw(command(refusal, option)); err != nil {
+		c.logger.Error(err, "error refusing telnet option", "option", option)
+	}
+}
+
+func (c *Conn) handleSubnegotiation(payload []byte) {
+	c.logger.V(2).Info("received telnet subnegotiation", "payload", payload)
+}
+
+func (c *Conn) writeRaw(data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	_, err := c.conn.Write(data)
+	return err
+}
+
+func (c *Conn) sendComPortCommand(cmd byte, value []byte) error {
+	if c.mode != ModeRFC2217 {
+		return ErrRawMode
+	}
+
+	if err := c.writeRaw(comPortCommand(cmd, value)); err != nil {
+		return fmt.Errorf("error sending com port command: %w", err)
+	}
+
+	return nil
+}
+
+// SetBaudRate requests that the remote serial port change baud rate (ModeRFC2217 only)
+func (c *Conn) SetBaudRate(baud uint) error {
+	return c.sendComPortCommand(comPortSetBaudRate, encodeUint32(uint32(baud)))
+}
+
+// SendBreak asserts a break condition on the remote serial port for the given duration (ModeRFC2217 only)
+func (c *Conn) SendBreak(duration time.Duration) error {
+	if err := c.sendComPortCommand(comPortSetControl, []byte{controlBreakOn}); err != nil {
+		return err
+	}
+
+	time.Sleep(duration)
+
+	return c.sendComPortCommand(comPortSetControl, []byte{controlBreakOff})
+}
+
+// Flush requests that the remote serial port discard data it has received but not yet sent (ModeRFC2217 only). Data
+// already sent over the network is not discarded.
+func (c *Conn) Flush() error {
+	return c.sendComPortCommand(comPortPurgeData, []byte{purgeReceiveBuffer})
+}
+
+// SetReadDeadline sets the deadline for reads, implementing rn2483.ReadDeadliner
+func (c *Conn) SetReadDeadline(deadline time.Time) error {
+	return c.conn.SetReadDeadline(deadline)
+}
+
+var _ rn2483.Transport = (*Conn)(nil)
+
+// Read implements the io.ReadWriteCloser interface
+func (c *Conn) Read(p []byte) (int, error) {
+	if len(c.received) > 0 {
+		n := copy(p, c.received)
+		c.received = c.received[n:]
+		return n, nil
+	}
+
+	if c.mode == ModeRaw {
+		return c.conn.Read(p)
+	}
+
+	for {
+		n, err := c.conn.Read(p)
+		data := c.decoder.decode(p[:n])
+		copy(p, data)
+
+		// avoid reporting a read of zero bytes when a chunk consisted entirely of telnet commands
+		if len(data) > 0 || err != nil {
+			return len(data), err
+		}
+	}
+}
+
+// Write implements the io.ReadWriteCloser interface
+func (c *Conn) Write(p []byte) (int, error) {
+	if c.mode == ModeRaw {
+		return c.conn.Write(p)
+	}
+
+	if err := c.writeRaw(escapeIAC(p)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close implements the io.ReadWriteCloser interface
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
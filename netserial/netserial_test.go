@@ -0,0 +1,403 @@
+package netserial_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/netserial"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+// echoDevice echoes back all data written to it, recording any serial port control requests
+type echoDevice struct {
+	reader *io.PipeReader
+	writer *io.PipeWriter
+
+	baudRates chan uint
+	breaks    chan time.Duration
+	flushes   chan struct{}
+}
+
+func newEchoDevice() *echoDevice {
+	r, w := io.Pipe()
+	return &echoDevice{
+		reader:    r,
+		writer:    w,
+		baudRates: make(chan uint, 1),
+		breaks:    make(chan time.Duration, 1),
+		flushes:   make(chan struct{}, 1),
+	}
+}
+
+func (e *echoDevice) Read(p []byte) (int, error)  { return e.reader.Read(p) }
+func (e *echoDevice) Write(p []byte) (int, error) { return e.writer.Write(p) }
+func (e *echoDevice) Close() error                { return e.writer.Close() }
+
+func (e *echoDevice) SetBaudRate(baud uint) error {
+	e.baudRates <- baud
+	return nil
+}
+
+func (e *echoDevice) SendBreak(duration time.Duration) error {
+	e.breaks <- duration
+	return nil
+}
+
+func (e *echoDevice) Flush() error {
+	e.flushes <- struct{}{}
+	return nil
+}
+
+// chattyDevice produces output endlessly once it has been written to, until it is closed
+type chattyDevice struct {
+	started   chan struct{}
+	startOnce sync.Once
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newChattyDevice() *chattyDevice {
+	return &chattyDevice{
+		started: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (c *chattyDevice) Read(p []byte) (int, error) {
+	select {
+	case <-c.started:
+	case <-c.closed:
+		return 0, io.EOF
+	}
+
+	select {
+	case <-c.closed:
+		return 0, io.EOF
+	default:
+		return copy(p, bytes.Repeat([]byte("x"), len(p))), nil
+	}
+}
+
+func (c *chattyDevice) Write(p []byte) (int, error) {
+	c.startOnce.Do(func() {
+		close(c.started)
+	})
+	return len(p), nil
+}
+
+func (c *chattyDevice) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+type testContext struct {
+	logger logr.Logger
+}
+
+func (c *testContext) serve(t *testing.T, mode netserial.Mode, device io.ReadWriteCloser) string {
+	bridge, err := netserial.NewBridge(netserial.BridgeConfig{
+		Logger: c.logger.WithName("bridge"),
+		Mode:   mode,
+		Device: device,
+	})
+	Expect(t, err).To(Not(HaveOccurred()))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(t, err).To(Not(HaveOccurred()))
+
+	go func() {
+		if err := bridge.Serve(listener); err != nil {
+			c.logger.Error(err, "error serving bridge")
+		}
+	}()
+	t.Cleanup(func() {
+		if err := bridge.Close(); err != nil {
+			c.logger.Error(err, "error closing bridge")
+		}
+	})
+
+	return listener.Addr().String()
+}
+
+func (c *testContext) dial(t *testing.T, address string, mode netserial.Mode) *netserial.Conn {
+	conn, err := netserial.Dial(address, netserial.DialConfig{
+		Logger:  c.logger.WithName("conn"),
+		Mode:    mode,
+		Timeout: time.Second,
+	})
+	Expect(t, err).To(Not(HaveOccurred()))
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+// listen accepts a single connection, standing in for a server that negotiates telnet options itself
+func (c *testContext) listen(t *testing.T) (string, <-chan net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(t, err).To(Not(HaveOccurred()))
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			c.logger.Error(err, "error accepting connection")
+			return
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		accepted <- conn
+	}()
+
+	return listener.Addr().String(), accepted
+}
+
+// readFor reads everything received on the connection until nothing more arrives within the duration
+func readFor(conn net.Conn, duration time.Duration) []byte {
+	var received []byte
+	buffer := make([]byte, 1024)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(duration))
+		n, err := conn.Read(buffer)
+		received = append(received, buffer[:n]...)
+		if err != nil {
+			return received
+		}
+	}
+}
+
+type dialResult struct {
+	conn *netserial.Conn
+	err  error
+}
+
+func TestNetSerial(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		return t, &testContext{
+			logger: testutils.CreateTestLogger(t),
+		}
+	})
+
+	for _, mode := range []netserial.Mode{netserial.ModeRaw, netserial.ModeRFC2217} {
+		mode := mode
+
+		o.Spec("can talk to a fake device over "+string(mode), func(t *testing.T, ctx *testContext) {
+			address := ctx.serve(t, mode, fake.New(fake.Config{
+				Logger: ctx.logger.WithName("fake-device"),
+			}))
+
+			d := rn2483.New(rn2483.Config{
+				Serial: ctx.dial(t, address, mode),
+			})
+
+			version, err := d.GetVersion()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, version.IsKnownSKU()).To(BeTrue())
+
+			Expect(t, d.SetRadioPower(7)).To(Not(HaveOccurred()))
+			power, err := d.GetRadioPower()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, power).To(Equal(7))
+		})
+	}
+
+	o.Spec("binary data survives telnet escaping", func(t *testing.T, ctx *testContext) {
+		address := ctx.serve(t, netserial.ModeRFC2217, newEchoDevice())
+		conn := ctx.dial(t, address, netserial.ModeRFC2217)
+
+		data := []byte{0x01, 0xFF, 0x02, 0xFF, 0xFF, 0xF0}
+		_, err := conn.Write(data)
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		received := make([]byte, len(data))
+		_, err = io.ReadFull(conn, received)
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, received).To(Equal(data))
+	})
+
+	o.Spec("baud rate changes and breaks reach the device", func(t *testing.T, ctx *testContext) {
+		device := newEchoDevice()
+		address := ctx.serve(t, netserial.ModeRFC2217, device)
+		conn := ctx.dial(t, address, netserial.ModeRFC2217)
+
+		Expect(t, conn.SetBaudRate(19200)).To(Not(HaveOccurred()))
+		Expect(t, <-device.baudRates).To(Equal(uint(19200)))
+
+		Expect(t, conn.SendBreak(time.Millisecond)).To(Not(HaveOccurred()))
+		Expect(t, float64(<-device.breaks)).To(BeAbove(0.0))
+
+		Expect(t, conn.Flush()).To(Not(HaveOccurred()))
+		<-device.flushes
+	})
+
+	o.Spec("waits for the server to accept the com port option before sending com port commands",
+		func(t *testing.T, ctx *testContext) {
+			address, accepted := ctx.listen(t)
+
+			dialed := make(chan dialResult, 1)
+			go func() {
+				conn, err := netserial.Dial(address, netserial.DialConfig{
+					Logger:   ctx.logger.WithName("conn"),
+					Mode:     netserial.ModeRFC2217,
+					Timeout:  time.Second,
+					BaudRate: 57600,
+				})
+				dialed <- dialResult{conn: conn, err: err}
+			}()
+
+			server := <-accepted
+			setBaudRate := []byte{255, 250, 44, 1}
+			Expect(t, bytes.Contains(readFor(server, 100*time.Millisecond), setBaudRate)).To(BeFalse())
+
+			_, err := server.Write([]byte{255, 253, 44, 'o', 'k'})
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, bytes.Contains(readFor(server, 100*time.Millisecond), setBaudRate)).To(BeTrue())
+
+			result := <-dialed
+			Expect(t, result.err).To(Not(HaveOccurred()))
+			defer result.conn.Close()
+
+			received := make([]byte, 2)
+			_, err = io.ReadFull(result.conn, received)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, string(received)).To(Equal("ok"))
+		})
+
+	o.Spec("fails to dial servers that refuse the com port option", func(t *testing.T, ctx *testContext) {
+		address, accepted := ctx.listen(t)
+		go func() {
+			_, _ = (<-accepted).Write([]byte{255, 254, 44})
+		}()
+
+		_, err := netserial.Dial(address, netserial.DialConfig{
+			Logger:  ctx.logger.WithName("conn"),
+			Mode:    netserial.ModeRFC2217,
+			Timeout: time.Second,
+		})
+		Expect(t, err).To(testutils.MatchError(netserial.ErrComPortRefused))
+	})
+
+	o.Spec("fails to dial servers that do not accept the com port option in time",
+		func(t *testing.T, ctx *testContext) {
+			address, _ := ctx.listen(t)
+
+			_, err := netserial.Dial(address, netserial.DialConfig{
+				Logger:             ctx.logger.WithName("conn"),
+				Mode:               netserial.ModeRFC2217,
+				Timeout:            time.Second,
+				NegotiationTimeout: 50 * time.Millisecond,
+			})
+			Expect(t, errors.Is(err, os.ErrDeadlineExceeded)).To(BeTrue())
+		})
+
+	o.Spec("a stalled client does not hold up other clients or closing", func(t *testing.T, ctx *testContext) {
+		bridge, err := netserial.NewBridge(netserial.BridgeConfig{
+			Logger: ctx.logger.WithName("bridge"),
+			Device: newChattyDevice(),
+		})
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(t, err).To(Not(HaveOccurred()))
+		go func() {
+			if err := bridge.Serve(listener); err != nil {
+				ctx.logger.Error(err, "error serving bridge")
+			}
+		}()
+
+		// the first client starts the device's output, but never reads it
+		stalled, err := net.Dial("tcp", listener.Addr().String())
+		Expect(t, err).To(Not(HaveOccurred()))
+		defer stalled.Close()
+		_, err = stalled.Write([]byte("x"))
+		Expect(t, err).To(Not(HaveOccurred()))
+		time.Sleep(200 * time.Millisecond)
+
+		refused, err := net.Dial("tcp", listener.Addr().String())
+		Expect(t, err).To(Not(HaveOccurred()))
+		defer refused.Close()
+		Expect(t, refused.SetReadDeadline(time.Now().Add(time.Second))).To(Not(HaveOccurred()))
+		_, err = refused.Read(make([]byte, 1))
+		Expect(t, err).To(Equal(io.EOF))
+
+		closed := make(chan error, 1)
+		go func() {
+			closed <- bridge.Close()
+		}()
+		select {
+		case err := <-closed:
+			Expect(t, err).To(Not(HaveOccurred()))
+		case <-time.After(time.Second):
+			t.Fatalf("bridge did not close while a client was stalled")
+		}
+	})
+
+	o.Spec("reports the baud rate to clients querying it", func(t *testing.T, ctx *testContext) {
+		device := newEchoDevice()
+		address := ctx.serve(t, netserial.ModeRFC2217, device)
+
+		conn, err := net.Dial("tcp", address)
+		Expect(t, err).To(Not(HaveOccurred()))
+		defer conn.Close()
+
+		query := []byte{255, 250, 44, 1, 0, 0, 0, 0, 255, 240}
+		_, err = conn.Write(query)
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, bytes.Contains(readFor(conn, 100*time.Millisecond), []byte{255, 250, 44, 101, 0, 0, 0xE1, 0x00})).
+			To(BeTrue())
+
+		_, err = conn.Write([]byte{255, 250, 44, 1, 0, 0, 0x4B, 0x00, 255, 240})
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, <-device.baudRates).To(Equal(uint(19200)))
+
+		_, err = conn.Write(query)
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, bytes.Contains(readFor(conn, 100*time.Millisecond), []byte{255, 250, 44, 101, 0, 0, 0x4B, 0x00})).
+			To(BeTrue())
+	})
+
+	o.Spec("serial port control is unavailable in raw mode", func(t *testing.T, ctx *testContext) {
+		address := ctx.serve(t, netserial.ModeRaw, newEchoDevice())
+		conn := ctx.dial(t, address, netserial.ModeRaw)
+
+		Expect(t, conn.SetBaudRate(19200)).To(testutils.MatchError(netserial.ErrRawMode))
+		Expect(t, conn.SendBreak(time.Millisecond)).To(testutils.MatchError(netserial.ErrRawMode))
+		Expect(t, conn.Flush()).To(testutils.MatchError(rn2483.ErrUnsupportedByTransport))
+	})
+
+	o.Spec("only one client may use the device at a time", func(t *testing.T, ctx *testContext) {
+		address := ctx.serve(t, netserial.ModeRaw, newEchoDevice())
+		first := ctx.dial(t, address, netserial.ModeRaw)
+
+		_, err := first.Write([]byte("x"))
+		Expect(t, err).To(Not(HaveOccurred()))
+		_, err = io.ReadFull(first, make([]byte, 1))
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		second := ctx.dial(t, address, netserial.ModeRaw)
+		_, err = second.Read(make([]byte, 1))
+		Expect(t, err).To(Equal(io.EOF))
+	})
+}
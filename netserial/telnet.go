@@ -0,0 +1,150 @@
+package netserial
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// telnet protocol bytes (RFC 854)
+const (
+	telnetSE   byte = 240
+	telnetSB   byte = 250
+	telnetWILL byte = 251
+	telnetWONT byte = 252
+	telnetDO   byte = 253
+	telnetDONT byte = 254
+	telnetIAC  byte = 255
+)
+
+// telnet options used when negotiating RFC 2217
+const (
+	optionBinary          byte = 0
+	optionSuppressGoAhead byte = 3
+	optionComPort         byte = 44
+)
+
+// RFC 2217 com port option commands as sent by the client, servers respond with the command plus serverReplyOffset
+const (
+	comPortSetBaudRate byte = 1
+	comPortSetDataSize byte = 2
+	comPortSetParity   byte = 3
+	comPortSetStopSize byte = 4
+	comPortSetControl  byte = 5
+	comPortPurgeData   byte = 12
+
+	serverReplyOffset byte = 100
+)
+
+// RFC 2217 SET-CONTROL values
+const (
+	controlBreakOn  byte = 5
+	controlBreakOff byte = 6
+)
+
+// RFC 2217 PURGE-DATA values
+const (
+	purgeReceiveBuffer byte = 1
+	purgeBothBuffers   byte = 3
+)
+
+type telnetState int
+
+const (
+	stateData telnetState = iota
+	stateIAC
+	stateOption
+	stateSubnegotiation
+	stateSubnegotiationIAC
+)
+
+// telnetDecoder separates a telnet byte stream into data and protocol commands
+type telnetDecoder struct {
+	state  telnetState
+	verb   byte
+	subneg bytes.Buffer
+
+	// onCommand is invoked for each option negotiation command (WILL, WONT, DO, DONT)
+	onCommand func(verb, option byte)
+	// onSubnegotiation is invoked for each completed subnegotiation, the first byte of the payload is the option
+	onSubnegotiation func(payload []byte)
+}
+
+// decode consumes a chunk of the telnet stream, returning only the data bytes it contained
+func (t *telnetDecoder) decode(in []byte) []byte {
+	data := make([]byte, 0, len(in))
+
+	for _, b := range in {
+		switch t.state {
+		case stateData:
+			if b == telnetIAC {
+				t.state = stateIAC
+			} else {
+				data = append(data, b)
+			}
+		case stateIAC:
+			switch b {
+			case telnetIAC:
+				data = append(data, b)
+				t.state = stateData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				t.verb = b
+				t.state = stateOption
+			case telnetSB:
+				t.subneg.Reset()
+				t.state = stateSubnegotiation
+			default:
+				// other commands (NOP, GA, etc.) carry no meaning for a serial stream
+				t.state = stateData
+			}
+		case stateOption:
+			if t.onCommand != nil {
+				t.onCommand(t.verb, b)
+			}
+			t.state = stateData
+		case stateSubnegotiation:
+			if b == telnetIAC {
+				t.state = stateSubnegotiationIAC
+			} else {
+				t.subneg.WriteByte(b)
+			}
+		case stateSubnegotiationIAC:
+			switch b {
+			case telnetSE:
+				if t.onSubnegotiation != nil {
+					t.onSubnegotiation(t.subneg.Bytes())
+				}
+				t.state = stateData
+			default:
+				t.subneg.WriteByte(b)
+				t.state = stateSubnegotiation
+			}
+		}
+	}
+
+	return data
+}
+
+// escapeIAC doubles any IAC bytes in the data so they are not interpreted as telnet commands
+func escapeIAC(data []byte) []byte {
+	if bytes.IndexByte(data, telnetIAC) < 0 {
+		return data
+	}
+
+	return bytes.ReplaceAll(data, []byte{telnetIAC}, []byte{telnetIAC, telnetIAC})
+}
+
+func command(verb, option byte) []byte {
+	return []byte{telnetIAC, verb, option}
+}
+
+func comPortCommand(cmd byte, value []byte) []byte {
+	frame := []byte{telnetIAC, telnetSB, optionComPort, cmd}
+	frame = append(frame, escapeIAC(value)...)
+	return append(frame, telnetIAC, telnetSE)
+}
+
+func encodeUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
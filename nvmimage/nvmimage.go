@@ -0,0 +1,366 @@
+// Package nvmimage backs up and restores the contents of a device's user NVM, in Intel HEX, raw binary or JSON formats.
+//
+// The Intel HEX and JSON formats record the device the image was taken from (its HWEUI, SKU and firmware version),
+// Intel HEX images holding it as JSON in data records outside user NVM (see HexMetadataAddress). Raw binary images carry
+// no device information, so cannot be checked against the device they are restored to and are only restored if forced.
+package nvmimage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/intelhex"
+)
+
+// Format identifies how an image is encoded
+type Format string
+
+const (
+	FormatHex    Format = "hex"
+	FormatBinary Format = "bin"
+	FormatJSON   Format = "json"
+)
+
+// erased is the value of NVM that has never been written, used to fill gaps in sparse images
+const erased = 0xFF
+
+// HexMetadataAddress is where Intel HEX images record the device they were taken from, far outside user NVM so that
+// the image's data is not mistaken for it
+const HexMetadataAddress uint32 = 0x10000
+
+var (
+	// ErrUnknownFormat is returned for unrecognised image formats
+	ErrUnknownFormat = errors.New("unknown image format")
+	// ErrOutOfBounds is returned when an image's data does not lie within user NVM
+	ErrOutOfBounds = errors.New("image is outside user NVM")
+	// ErrSKUMismatch is returned when restoring an image taken from a different model of device
+	ErrSKUMismatch = errors.New("image was taken from a different device SKU")
+	// ErrUnknownSKU is returned when restoring an image that does not record the model of device it was taken from
+	ErrUnknownSKU = errors.New("image does not record the device SKU it was taken from")
+	// ErrMismatch is returned when verifying a device whose NVM does not match the image
+	ErrMismatch = errors.New("NVM does not match image")
+)
+
+// Image is a copy of some or all of a device's user NVM
+type Image struct {
+	// Start is the address of the first byte of Data
+	Start uint16
+	Data  []byte
+	// Segments, when set, are the only parts of Data the image covers, as for sparse Intel HEX images. The gaps between
+	// them hold the value of erased NVM in Data, and are neither restored nor verified.
+	Segments []intelhex.Segment
+
+	// HWEUI is the EUI of the device the image was taken from, if known
+	HWEUI string
+	// SKU is the model of device the image was taken from, if known
+	SKU rn2483.DeviceSKU
+	// FirmwareVersion is the version string reported by the device the image was taken from, if known
+	FirmwareVersion string
+}
+
+// End is the address immediately after the image's last byte
+func (img *Image) End() uint32 {
+	return uint32(img.Start) + uint32(len(img.Data))
+}
+
+// covered returns the parts of the image that hold data
+func (img *Image) covered() []intelhex.Segment {
+	if len(img.Segments) > 0 {
+		return img.Segments
+	}
+
+	return []intelhex.Segment{{Address: uint32(img.Start), Data: img.Data}}
+}
+
+func (img *Image) validate() error {
+	if img.Start < rn2483.UserNVMStart || img.End() > uint32(rn2483.UserNVMEnd)+1 {
+		return fmt.Errorf("%w: %s-%s", ErrOutOfBounds, rn2483.UInt16ToHex(img.Start), rn2483.UInt16ToHex(uint16(img.End()-1)))
+	}
+
+	for _, segment := range img.Segments {
+		if segment.Address < uint32(img.Start) || segment.End() > img.End() {
+			return fmt.Errorf("%w: segment %08X-%08X lies outside the image", ErrOutOfBounds, segment.Address,
+				segment.End()-1)
+		}
+	}
+
+	return nil
+}
+
+// Backup reads the entirety of the device's user NVM, along with the information identifying the device
+func Backup(d *rn2483.Device) (*Image, error) {
+	version, err := d.GetVersion()
+	if err != nil {
+		return nil, fmt.Errorf("error getting firmware version: %w", err)
+	}
+
+	hweui, err := d.GetHWEUI()
+	if err != nil {
+		return nil, fmt.Errorf("error getting HWEUI: %w", err)
+	}
+
+	data, err := rn2483.ReadNVM(d, rn2483.UserNVMStart, rn2483.UserNVMLength)
+	if err != nil {
+		return nil, fmt.Errorf("error reading NVM: %w", err)
+	}
+
+	return &Image{
+		Start:           rn2483.UserNVMStart,
+		Data:            data,
+		HWEUI:           hweui,
+		SKU:             version.SKU,
+		FirmwareVersion: version.Raw,
+	}, nil
+}
+
+// RestoreOptions configures how an image is restored
+type RestoreOptions struct {
+	// Force allows an image taken from a different SKU, or that does not record its SKU, to be restored
+	Force bool
+}
+
+// Restore writes the image to the device's user NVM, only writing bytes that differ and verifying them afterwards. Only
+// the parts of NVM the image covers are written.
+// Images are refused if the SKU they were taken from does not match the device's, or is unknown (as it is for raw binary
+// images), unless forced.
+func Restore(d *rn2483.Device, img *Image, opts RestoreOptions) (rn2483.NVMWriteStats, error) {
+	if err := img.validate(); err != nil {
+		return rn2483.NVMWriteStats{}, err
+	}
+
+	if !opts.Force {
+		if img.SKU == "" {
+			return rn2483.NVMWriteStats{}, ErrUnknownSKU
+		}
+
+		version, err := d.GetVersion()
+		if err != nil {
+			return rn2483.NVMWriteStats{}, fmt.Errorf("error getting firmware version: %w", err)
+		}
+		if version.SKU != img.SKU {
+			return rn2483.NVMWriteStats{}, fmt.Errorf("%w: image is from %s, device is %s", ErrSKUMismatch, img.SKU,
+				version.SKU)
+		}
+	}
+
+	var stats rn2483.NVMWriteStats
+	for _, segment := range img.covered() {
+		segmentStats, err := rn2483.UpdateNVM(d, uint16(segment.Address), segment.Data)
+		stats.Written += segmentStats.Written
+		stats.Skipped += segmentStats.Skipped
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// Verify compares the parts of the device's user NVM covered by the image against it, returning ErrMismatch if they
+// differ
+func Verify(d *rn2483.Device, img *Image) error {
+	if err := img.validate(); err != nil {
+		return err
+	}
+
+	differences := 0
+	var first uint16
+	for _, segment := range img.covered() {
+		data, err := rn2483.ReadNVM(d, uint16(segment.Address), uint16(len(segment.Data)))
+		if err != nil {
+			return fmt.Errorf("error reading NVM: %w", err)
+		}
+
+		for i := range data {
+			if data[i] != segment.Data[i] {
+				if differences == 0 {
+					first = uint16(segment.Address) + uint16(i)
+				}
+				differences++
+			}
+		}
+	}
+	if differences > 0 {
+		return fmt.Errorf("%w: %d bytes differ, first at %s", ErrMismatch, differences, rn2483.UInt16ToHex(first))
+	}
+
+	return nil
+}
+
+// FormatForFilename determines an image format from a filename's extension
+func FormatForFilename(filename string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".hex", ".ihex":
+		return FormatHex, nil
+	case ".bin":
+		return FormatBinary, nil
+	case ".json":
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownFormat, filename)
+	}
+}
+
+// metadata describes the device an image was taken from
+type metadata struct {
+	HWEUI           string           `json:"hweui,omitempty"`
+	SKU             rn2483.DeviceSKU `json:"sku,omitempty"`
+	FirmwareVersion string           `json:"firmwareVersion,omitempty"`
+}
+
+func (img *Image) metadata() metadata {
+	return metadata{
+		HWEUI:           img.HWEUI,
+		SKU:             img.SKU,
+		FirmwareVersion: img.FirmwareVersion,
+	}
+}
+
+func (img *Image) setMetadata(m metadata) {
+	img.HWEUI = m.HWEUI
+	img.SKU = m.SKU
+	img.FirmwareVersion = m.FirmwareVersion
+}
+
+type jsonImage struct {
+	metadata
+	Start    uint16        `json:"start"`
+	Data     string        `json:"data"`
+	Segments []jsonSegment `json:"segments,omitempty"`
+}
+
+// jsonSegment records a part of a sparse image's data
+type jsonSegment struct {
+	Start  uint16 `json:"start"`
+	Length uint16 `json:"length"`
+}
+
+// Encode writes the image in the specified format
+func Encode(w io.Writer, img *Image, format Format) error {
+	switch format {
+	case FormatHex:
+		segments := img.covered()
+		if m := img.metadata(); m != (metadata{}) {
+			encoded, err := json.Marshal(m)
+			if err != nil {
+				return fmt.Errorf("error encoding image metadata: %w", err)
+			}
+			segments = append(segments, intelhex.Segment{Address: HexMetadataAddress, Data: encoded})
+		}
+		return intelhex.Encode(w, segments)
+	case FormatBinary:
+		if _, err := w.Write(img.Data); err != nil {
+			return fmt.Errorf("error writing image: %w", err)
+		}
+		return nil
+	case FormatJSON:
+		var segments []jsonSegment
+		for _, segment := range img.Segments {
+			segments = append(segments, jsonSegment{
+				Start:  uint16(segment.Address),
+				Length: uint16(len(segment.Data)),
+			})
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(jsonImage{
+			metadata: img.metadata(),
+			Start:    img.Start,
+			Data:     rn2483.BytesToHex(img.Data),
+			Segments: segments,
+		})
+		if err != nil {
+			return fmt.Errorf("error writing image: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// Decode reads an image in the specified format. Raw binary images are assumed to start at the beginning of user NVM.
+// Sparse Intel HEX images keep their segments (see Image.Segments), so that the gaps between them are not restored.
+func Decode(r io.Reader, format Format) (*Image, error) {
+	var img *Image
+
+	switch format {
+	case FormatHex:
+		segments, err := intelhex.Decode(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading image: %w", err)
+		}
+		var m metadata
+		if last := len(segments) - 1; last >= 0 && segments[last].Address == HexMetadataAddress {
+			if err := json.Unmarshal(segments[last].Data, &m); err != nil {
+				return nil, fmt.Errorf("error decoding image metadata: %w", err)
+			}
+			segments = segments[:last]
+		}
+		if len(segments) == 0 {
+			return nil, fmt.Errorf("%w: image contains no data", ErrOutOfBounds)
+		}
+		start := segments[0].Address
+		end := segments[len(segments)-1].End()
+		if start > uint32(rn2483.UserNVMEnd) || end > uint32(rn2483.UserNVMEnd)+1 {
+			return nil, fmt.Errorf("%w: %08X-%08X", ErrOutOfBounds, start, end-1)
+		}
+		img = &Image{
+			Start: uint16(start),
+			Data:  intelhex.Flatten(segments, start, int(end-start), erased),
+		}
+		img.setMetadata(m)
+		if len(segments) > 1 {
+			img.Segments = segments
+		}
+	case FormatBinary:
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading image: %w", err)
+		}
+		img = &Image{
+			Start: rn2483.UserNVMStart,
+			Data:  data,
+		}
+	case FormatJSON:
+		var decoded jsonImage
+		if err := json.NewDecoder(r).Decode(&decoded); err != nil {
+			return nil, fmt.Errorf("error reading image: %w", err)
+		}
+		data, err := hex.DecodeString(decoded.Data)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding image data: %w", err)
+		}
+		img = &Image{
+			Start: decoded.Start,
+			Data:  data,
+		}
+		img.setMetadata(decoded.metadata)
+		for _, segment := range decoded.Segments {
+			offset := int(segment.Start) - int(decoded.Start)
+			if offset < 0 || offset+int(segment.Length) > len(data) {
+				return nil, fmt.Errorf("%w: segment %s lies outside the image", ErrOutOfBounds,
+					rn2483.UInt16ToHex(segment.Start))
+			}
+			img.Segments = append(img.Segments, intelhex.Segment{
+				Address: uint32(segment.Start),
+				Data:    data[offset : offset+int(segment.Length)],
+			})
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+
+	if err := img.validate(); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
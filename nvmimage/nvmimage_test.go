@@ -0,0 +1,204 @@
+package nvmimage_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/nvmimage"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+type testContext struct {
+	fake   *fake.Device
+	device *rn2483.Device
+	image  *nvmimage.Image
+}
+
+func TestImage(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		logger := testutils.CreateTestLogger(t)
+
+		f, d := fake.NewFakeDevice(fake.Config{
+			Logger: logger.WithName("fake-device"),
+		})
+		t.Cleanup(func() {
+			if err := d.Close(); err != nil {
+				logger.Error(err, "error cleaning up fake device")
+			}
+		})
+
+		Expect(t, rn2483.WriteNVM(d, rn2483.UserNVMStart+0x10, []byte("node 42"))).To(Not(HaveOccurred()))
+		image, err := nvmimage.Backup(d)
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		return t, &testContext{
+			fake:   f,
+			device: d,
+			image:  image,
+		}
+	})
+
+	o.Spec("backups identify the device", func(t *testing.T, ctx *testContext) {
+		Expect(t, ctx.image.Start).To(Equal(rn2483.UserNVMStart))
+		Expect(t, ctx.image.Data).To(HaveLen(int(rn2483.UserNVMLength)))
+		Expect(t, ctx.image.Data[0x10:0x17]).To(Equal([]byte("node 42")))
+		Expect(t, ctx.image.HWEUI).To(Equal("0004A30B001C0530"))
+		Expect(t, ctx.image.SKU).To(Equal(rn2483.DeviceRN2483))
+		Expect(t, ctx.image.FirmwareVersion).To(Equal("RN2483 1.0.4 Mar 23 1991 13:37:00"))
+	})
+
+	o.Group("formats round trip", func() {
+		formats := []nvmimage.Format{nvmimage.FormatHex, nvmimage.FormatBinary, nvmimage.FormatJSON}
+		for _, format := range formats {
+			format := format
+			o.Spec(string(format), func(t *testing.T, ctx *testContext) {
+				var buffer bytes.Buffer
+				Expect(t, nvmimage.Encode(&buffer, ctx.image, format)).To(Not(HaveOccurred()))
+
+				decoded, err := nvmimage.Decode(&buffer, format)
+				Expect(t, err).To(Not(HaveOccurred()))
+				Expect(t, decoded.Start).To(Equal(ctx.image.Start))
+				Expect(t, decoded.Data).To(Equal(ctx.image.Data))
+
+				if format != nvmimage.FormatBinary {
+					Expect(t, decoded).To(Equal(ctx.image))
+				}
+			})
+		}
+	})
+
+	o.Spec("restores and verifies images", func(t *testing.T, ctx *testContext) {
+		Expect(t, nvmimage.Verify(ctx.device, ctx.image)).To(Not(HaveOccurred()))
+
+		Expect(t, rn2483.WriteNVM(ctx.device, rn2483.UserNVMStart, []byte{1, 2})).To(Not(HaveOccurred()))
+		err := nvmimage.Verify(ctx.device, ctx.image)
+		Expect(t, err).To(testutils.MatchError(nvmimage.ErrMismatch))
+
+		stats, err := nvmimage.Restore(ctx.device, ctx.image, nvmimage.RestoreOptions{})
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, stats.Written).To(Equal(2))
+		Expect(t, nvmimage.Verify(ctx.device, ctx.image)).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("refuses images from other SKUs unless forced", func(t *testing.T, ctx *testContext) {
+		ctx.image.SKU = rn2483.DeviceRN2903
+
+		_, err := nvmimage.Restore(ctx.device, ctx.image, nvmimage.RestoreOptions{})
+		Expect(t, err).To(testutils.MatchError(nvmimage.ErrSKUMismatch))
+
+		_, err = nvmimage.Restore(ctx.device, ctx.image, nvmimage.RestoreOptions{Force: true})
+		Expect(t, err).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("refuses Intel HEX images from other SKUs unless forced", func(t *testing.T, ctx *testContext) {
+		var buffer bytes.Buffer
+		Expect(t, nvmimage.Encode(&buffer, ctx.image, nvmimage.FormatHex)).To(Not(HaveOccurred()))
+		image, err := nvmimage.Decode(&buffer, nvmimage.FormatHex)
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		ctx.fake.Update(func(f *fake.Device) {
+			f.Sys.FirmwareVersion = "RN2903 1.0.5 Nov 06 2018 10:45:27"
+		})
+
+		_, err = nvmimage.Restore(ctx.device, image, nvmimage.RestoreOptions{})
+		Expect(t, err).To(testutils.MatchError(nvmimage.ErrSKUMismatch))
+
+		_, err = nvmimage.Restore(ctx.device, image, nvmimage.RestoreOptions{Force: true})
+		Expect(t, err).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("refuses images of unknown SKU unless forced", func(t *testing.T, ctx *testContext) {
+		var buffer bytes.Buffer
+		Expect(t, nvmimage.Encode(&buffer, ctx.image, nvmimage.FormatBinary)).To(Not(HaveOccurred()))
+		image, err := nvmimage.Decode(&buffer, nvmimage.FormatBinary)
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		_, err = nvmimage.Restore(ctx.device, image, nvmimage.RestoreOptions{})
+		Expect(t, err).To(testutils.MatchError(nvmimage.ErrUnknownSKU))
+
+		_, err = nvmimage.Restore(ctx.device, image, nvmimage.RestoreOptions{Force: true})
+		Expect(t, err).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("decodes partial Intel HEX images", func(t *testing.T, ctx *testContext) {
+		input := ":02031000AABB86\n:01031300CC1D\n:00000001FF\n"
+
+		image, err := nvmimage.Decode(strings.NewReader(input), nvmimage.FormatHex)
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, image.Start).To(Equal(uint16(0x310)))
+		Expect(t, image.Data).To(Equal([]byte{0xAA, 0xBB, 0xFF, 0xCC}))
+		Expect(t, image.Segments).To(HaveLen(2))
+		Expect(t, image.SKU).To(Equal(rn2483.DeviceSKU("")))
+	})
+
+	o.Spec("restores only the parts of NVM covered by sparse images", func(t *testing.T, ctx *testContext) {
+		Expect(t, rn2483.WriteNVM(ctx.device, 0x310, []byte{1, 2, 3, 4})).To(Not(HaveOccurred()))
+
+		input := ":02031000AABB86\n:01031300CC1D\n:00000001FF\n"
+		image, err := nvmimage.Decode(strings.NewReader(input), nvmimage.FormatHex)
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		stats, err := nvmimage.Restore(ctx.device, image, nvmimage.RestoreOptions{Force: true})
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, stats.Written).To(Equal(3))
+		Expect(t, nvmimage.Verify(ctx.device, image)).To(Not(HaveOccurred()))
+
+		data, err := rn2483.ReadNVM(ctx.device, 0x310, 4)
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, data).To(Equal([]byte{0xAA, 0xBB, 3, 0xCC}))
+	})
+
+	o.Spec("sparse images round trip", func(t *testing.T, ctx *testContext) {
+		input := ":02031000AABB86\n:01031300CC1D\n:00000001FF\n"
+		image, err := nvmimage.Decode(strings.NewReader(input), nvmimage.FormatHex)
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		for _, format := range []nvmimage.Format{nvmimage.FormatHex, nvmimage.FormatJSON} {
+			var buffer bytes.Buffer
+			Expect(t, nvmimage.Encode(&buffer, image, format)).To(Not(HaveOccurred()))
+
+			decoded, err := nvmimage.Decode(&buffer, format)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, decoded).To(Equal(image))
+		}
+	})
+
+	o.Spec("rejects images outside user NVM", func(t *testing.T, ctx *testContext) {
+		_, err := nvmimage.Decode(strings.NewReader(":0102000001FC\n:00000001FF\n"), nvmimage.FormatHex)
+		Expect(t, err).To(testutils.MatchError(nvmimage.ErrOutOfBounds))
+
+		_, err = nvmimage.Decode(bytes.NewReader(make([]byte, 257)), nvmimage.FormatBinary)
+		Expect(t, err).To(testutils.MatchError(nvmimage.ErrOutOfBounds))
+	})
+
+	o.Group("formats are determined from filenames", func() {
+		expected := map[string]nvmimage.Format{
+			"backup.hex":  nvmimage.FormatHex,
+			"backup.BIN":  nvmimage.FormatBinary,
+			"backup.json": nvmimage.FormatJSON,
+		}
+		for filename, format := range expected {
+			filename, format := filename, format
+			o.Spec(filename, func(t *testing.T, ctx *testContext) {
+				actual, err := nvmimage.FormatForFilename(filename)
+				Expect(t, err).To(Not(HaveOccurred()))
+				Expect(t, actual).To(Equal(format))
+			})
+		}
+
+		o.Spec("unknown", func(t *testing.T, ctx *testContext) {
+			_, err := nvmimage.FormatForFilename("backup.txt")
+			Expect(t, err).To(testutils.MatchError(nvmimage.ErrUnknownFormat))
+		})
+	})
+}
@@ -0,0 +1,369 @@
+// Package nvmkv implements a small persistent key-value store within a device's user NVM.
+//
+// The store's region begins with a header (the magic bytes "KV" followed by a format version), followed by a log of
+// records, each laid out as:
+//
+//	[key length][value length][flags][key][value][CRC-16 (big-endian)]
+//
+// A key length of 0xFF (the value of erased NVM) marks the end of the log. Setting a key appends a new record that
+// supersedes any earlier record for the same key, and deleting a key appends a tombstone record. When the log runs out
+// of space it is compacted, rewriting only the latest record for each key that has not been deleted.
+package nvmkv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/internal/crc16"
+)
+
+const (
+	// Version is the version of the store format written by this package
+	Version byte = 1
+	// MaxKeyLength is the longest key that can be stored
+	MaxKeyLength = 0xFE
+	// MaxValueLength is the longest value that can be stored
+	MaxValueLength = 0xFF
+
+	headerLength       = 3
+	recordHeaderLength = 3
+	recordCRCLength    = 2
+	endOfLog           = 0xFF
+
+	flagTombstone byte = 1 << 0
+)
+
+var magic = []byte("KV")
+
+var (
+	// ErrNotFormatted is returned when opening a region that does not contain a store
+	ErrNotFormatted = errors.New("NVM region is not formatted as a key-value store")
+	// ErrUnsupportedVersion is returned when opening a store written in a format version this package does not support
+	ErrUnsupportedVersion = errors.New("unsupported key-value store version")
+	// ErrFull is returned when there is not enough space to store a value, even after compaction
+	ErrFull = errors.New("key-value store is full")
+	// ErrInvalidKey is returned when a key is empty or too long
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrValueTooLong is returned when a value is longer than MaxValueLength
+	ErrValueTooLong = errors.New("value too long")
+)
+
+// Config configures a Store
+type Config struct {
+	Logger logr.Logger
+	// NVM is the memory the store is kept in, typically a *rn2483.Device
+	NVM rn2483.NVM
+	// Start is the address of the region the store occupies, defaulting to rn2483.UserNVMStart
+	Start uint16
+	// Length is the size of the region the store occupies, defaulting to the remainder of user NVM after Start
+	Length uint16
+}
+
+// Store is a key-value store persisted in NVM. An in-memory image of the region is kept so that reads never touch the
+// device, so the region must not be modified by anything else while the Store is in use. A Store is not safe for
+// concurrent use.
+type Store struct {
+	logger logr.Logger
+	nvm    *rn2483.NVMCache
+	start  uint16
+
+	image   []byte
+	entries map[string][]byte
+	end     int
+}
+
+func (cfg *Config) applyDefaults() {
+	if cfg.Logger == nil {
+		cfg.Logger = logr.Discard()
+	}
+	if cfg.Start == 0 {
+		cfg.Start = rn2483.UserNVMStart
+	}
+	if cfg.Length == 0 {
+		cfg.Length = (rn2483.UserNVMEnd + 1) - cfg.Start
+	}
+}
+
+// checkLength ensures the region can hold the header and the end of the log
+func (cfg *Config) checkLength() error {
+	if int(cfg.Length) < headerLength+1 {
+		return fmt.Errorf("%w: region of %d bytes is too small", ErrFull, cfg.Length)
+	}
+
+	return nil
+}
+
+// Open loads an existing store from NVM, returning ErrNotFormatted if the region does not contain one
+func Open(cfg Config) (*Store, error) {
+	cfg.applyDefaults()
+
+	if err := cfg.checkLength(); err != nil {
+		return nil, err
+	}
+
+	nvm := rn2483.NewNVMCache(cfg.NVM)
+	image, err := rn2483.ReadNVM(nvm, cfg.Start, cfg.Length)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key-value store: %w", err)
+	}
+
+	s := &Store{
+		logger: cfg.Logger,
+		nvm:    nvm,
+		start:  cfg.Start,
+		image:  image,
+	}
+	if err := s.parse(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Format initialises an empty store in NVM, discarding anything previously stored in the region
+func Format(cfg Config) (*Store, error) {
+	cfg.applyDefaults()
+
+	if err := cfg.checkLength(); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		logger:  cfg.Logger,
+		nvm:     rn2483.NewNVMCache(cfg.NVM),
+		start:   cfg.Start,
+		image:   make([]byte, cfg.Length),
+		entries: map[string][]byte{},
+	}
+	for i := range s.image {
+		s.image[i] = endOfLog
+	}
+
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get retrieves the value stored for key, if any
+func (s *Store) Get(key string) ([]byte, bool) {
+	value, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	return append([]byte(nil), value...), true
+}
+
+// Keys lists all keys in the store, in sorted order
+func (s *Store) Keys() []string {
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Set stores value for key, compacting the store first if there is not enough space
+func (s *Store) Set(key string, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if len(value) > MaxValueLength {
+		return fmt.Errorf("%w: %d bytes", ErrValueTooLong, len(value))
+	}
+
+	if existing, ok := s.entries[key]; ok && bytes.Equal(existing, value) {
+		return nil
+	}
+
+	return s.append(key, value, 0)
+}
+
+// Delete removes key from the store, if present
+func (s *Store) Delete(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	if _, ok := s.entries[key]; !ok {
+		return nil
+	}
+
+	return s.append(key, nil, flagTombstone)
+}
+
+// Free is the number of bytes available for new records before the store must be compacted
+func (s *Store) Free() int {
+	// one byte is always reserved for the end of log marker
+	return len(s.image) - s.end - 1
+}
+
+// Compact rewrites the store containing only the current value of each key, reclaiming space used by superseded and
+// deleted records. Only bytes that change are written, but the store may still be corrupted if the device loses power
+// while it is being compacted.
+func (s *Store) Compact() error {
+	return s.rewrite()
+}
+
+func validateKey(key string) error {
+	if len(key) == 0 || len(key) > MaxKeyLength {
+		return fmt.Errorf("%w: length must be between 1 and %d bytes", ErrInvalidKey, MaxKeyLength)
+	}
+
+	return nil
+}
+
+func encodeRecord(key string, value []byte, flags byte) []byte {
+	record := make([]byte, 0, recordHeaderLength+len(key)+len(value)+recordCRCLength)
+	record = append(record, byte(len(key)), byte(len(value)), flags)
+	record = append(record, key...)
+	record = append(record, value...)
+
+	return append(record, make([]byte, recordCRCLength)...)
+}
+
+func sealRecord(record []byte) {
+	body := record[:len(record)-recordCRCLength]
+	binary.BigEndian.PutUint16(record[len(body):], crc16.Checksum(body))
+}
+
+func (s *Store) parse() error {
+	if bytes.Equal(s.image[:len(magic)], []byte{endOfLog, endOfLog}) {
+		return ErrNotFormatted
+	}
+	if !bytes.Equal(s.image[:len(magic)], magic) {
+		return fmt.Errorf("%w: unrecognised header", ErrNotFormatted)
+	}
+	if s.image[len(magic)] != Version {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, s.image[len(magic)])
+	}
+
+	s.entries = map[string][]byte{}
+	offset := headerLength
+	for offset < len(s.image) && s.image[offset] != endOfLog {
+		length, ok := s.recordAt(offset)
+		if !ok {
+			// a record interrupted by power loss is left unterminated, so it is treated as the end of the log and is
+			// overwritten by the next record appended
+			s.logger.Info("ignoring corrupt record at end of key-value store", "offset", offset)
+			break
+		}
+
+		keyLength := int(s.image[offset])
+		valueLength := int(s.image[offset+1])
+		flags := s.image[offset+2]
+		keyStart := offset + recordHeaderLength
+		key := string(s.image[keyStart : keyStart+keyLength])
+		if flags&flagTombstone != 0 {
+			delete(s.entries, key)
+		} else {
+			valueStart := keyStart + keyLength
+			s.entries[key] = append([]byte(nil), s.image[valueStart:valueStart+valueLength]...)
+		}
+
+		offset += length
+	}
+	s.end = offset
+
+	return nil
+}
+
+// recordAt validates the record at offset, returning its total length
+func (s *Store) recordAt(offset int) (int, bool) {
+	if offset+recordHeaderLength > len(s.image) {
+		return 0, false
+	}
+
+	keyLength := int(s.image[offset])
+	valueLength := int(s.image[offset+1])
+	if keyLength == 0 {
+		return 0, false
+	}
+
+	length := recordHeaderLength + keyLength + valueLength + recordCRCLength
+	if offset+length > len(s.image) {
+		return 0, false
+	}
+
+	body := s.image[offset : offset+length-recordCRCLength]
+	checksum := binary.BigEndian.Uint16(s.image[offset+len(body):])
+	return length, crc16.Checksum(body) == checksum
+}
+
+func (s *Store) append(key string, value []byte, flags byte) error {
+	record := encodeRecord(key, value, flags)
+	sealRecord(record)
+
+	if len(record) > s.Free() {
+		s.logger.V(1).Info("compacting key-value store", "free", s.Free(), "required", len(record))
+		if err := s.Compact(); err != nil {
+			return fmt.Errorf("error compacting key-value store: %w", err)
+		}
+		if len(record) > s.Free() {
+			return fmt.Errorf("%w: %d bytes required, %d available", ErrFull, len(record), s.Free())
+		}
+	}
+
+	// the record's first byte is written last, so the record is only part of the log once it is complete
+	offset := s.end
+	if err := s.write(offset+1, append(record[1:], endOfLog)); err != nil {
+		return err
+	}
+	if err := s.write(offset, record[:1]); err != nil {
+		return err
+	}
+
+	s.end += len(record)
+	if flags&flagTombstone != 0 {
+		delete(s.entries, key)
+	} else {
+		s.entries[key] = append([]byte(nil), value...)
+	}
+
+	return nil
+}
+
+func (s *Store) rewrite() error {
+	image := make([]byte, 0, len(s.image))
+	image = append(image, magic...)
+	image = append(image, Version)
+	for _, key := range s.Keys() {
+		record := encodeRecord(key, s.entries[key], 0)
+		sealRecord(record)
+		image = append(image, record...)
+	}
+	end := len(image)
+	image = append(image, endOfLog)
+
+	if len(image) > len(s.image) {
+		return fmt.Errorf("%w: %d bytes required, %d available", ErrFull, len(image), len(s.image))
+	}
+
+	if err := s.write(0, image); err != nil {
+		return err
+	}
+	s.end = end
+
+	return nil
+}
+
+func (s *Store) write(offset int, data []byte) error {
+	stats, err := rn2483.UpdateNVM(s.nvm, s.start+uint16(offset), data)
+	if err != nil {
+		return fmt.Errorf("error writing key-value store: %w", err)
+	}
+	s.logger.V(1).Info("wrote key-value store", "offset", offset, "written", stats.Written, "skipped", stats.Skipped)
+	copy(s.image[offset:], data)
+
+	return nil
+}
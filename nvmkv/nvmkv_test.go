@@ -0,0 +1,197 @@
+package nvmkv_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/nvmkv"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+type testContext struct {
+	fake   *fake.Device
+	config nvmkv.Config
+}
+
+func TestStore(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		logger := testutils.CreateTestLogger(t)
+
+		f, d := fake.NewFakeDevice(fake.Config{
+			Logger: logger.WithName("fake-device"),
+		})
+		t.Cleanup(func() {
+			if err := d.Close(); err != nil {
+				logger.Error(err, "error cleaning up fake device")
+			}
+		})
+
+		return t, &testContext{
+			fake: f,
+			config: nvmkv.Config{
+				Logger: logger.WithName("store"),
+				NVM:    d,
+			},
+		}
+	})
+
+	o.Spec("refuses to open unformatted NVM", func(t *testing.T, ctx *testContext) {
+		_, err := nvmkv.Open(ctx.config)
+		Expect(t, err).To(testutils.MatchError(nvmkv.ErrNotFormatted))
+	})
+
+	o.Spec("refuses to open unsupported versions", func(t *testing.T, ctx *testContext) {
+		ctx.fake.Update(func(d *fake.Device) {
+			copy(d.Sys.NVM, []byte{'K', 'V', 99, 0xFF})
+		})
+
+		_, err := nvmkv.Open(ctx.config)
+		Expect(t, err).To(testutils.MatchError(nvmkv.ErrUnsupportedVersion))
+	})
+
+	o.Group("formatted", func() {
+		o.BeforeEach(func(t *testing.T, ctx *testContext) (*testing.T, *testContext, *nvmkv.Store) {
+			store, err := nvmkv.Format(ctx.config)
+			Expect(t, err).To(Not(HaveOccurred()))
+			return t, ctx, store
+		})
+
+		o.Spec("values persist across reopening", func(t *testing.T, ctx *testContext, store *nvmkv.Store) {
+			Expect(t, store.Set("node-id", []byte{0x12, 0x34})).To(Not(HaveOccurred()))
+			Expect(t, store.Set("profile", []byte("sf7bw125"))).To(Not(HaveOccurred()))
+			Expect(t, store.Set("node-id", []byte{0x56})).To(Not(HaveOccurred()))
+
+			reopened, err := nvmkv.Open(ctx.config)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, reopened.Keys()).To(Equal([]string{"node-id", "profile"}))
+
+			value, ok := reopened.Get("node-id")
+			Expect(t, ok).To(BeTrue())
+			Expect(t, value).To(Equal([]byte{0x56}))
+
+			value, ok = reopened.Get("profile")
+			Expect(t, ok).To(BeTrue())
+			Expect(t, value).To(Equal([]byte("sf7bw125")))
+		})
+
+		o.Spec("deleted values stay deleted", func(t *testing.T, ctx *testContext, store *nvmkv.Store) {
+			Expect(t, store.Set("calibration", []byte{1, 2, 3})).To(Not(HaveOccurred()))
+			Expect(t, store.Delete("calibration")).To(Not(HaveOccurred()))
+
+			_, ok := store.Get("calibration")
+			Expect(t, ok).To(BeFalse())
+
+			reopened, err := nvmkv.Open(ctx.config)
+			Expect(t, err).To(Not(HaveOccurred()))
+			_, ok = reopened.Get("calibration")
+			Expect(t, ok).To(BeFalse())
+		})
+
+		o.Spec("compacts when full", func(t *testing.T, ctx *testContext, store *nvmkv.Store) {
+			for i := 0; i < 50; i++ {
+				value := []byte(fmt.Sprintf("value %d", i))
+				Expect(t, store.Set(fmt.Sprintf("key-%d", i%3), value)).To(Not(HaveOccurred()))
+			}
+
+			reopened, err := nvmkv.Open(ctx.config)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, reopened.Keys()).To(Equal([]string{"key-0", "key-1", "key-2"}))
+
+			value, ok := reopened.Get("key-1")
+			Expect(t, ok).To(BeTrue())
+			Expect(t, value).To(Equal([]byte("value 49")))
+		})
+
+		o.Spec("reports when values cannot fit", func(t *testing.T, ctx *testContext, store *nvmkv.Store) {
+			Expect(t, store.Set("a", make([]byte, 200))).To(Not(HaveOccurred()))
+
+			err := store.Set("b", make([]byte, 100))
+			Expect(t, err).To(testutils.MatchError(nvmkv.ErrFull))
+
+			_, ok := store.Get("b")
+			Expect(t, ok).To(BeFalse())
+		})
+
+		o.Spec("rejects invalid keys and values", func(t *testing.T, ctx *testContext, store *nvmkv.Store) {
+			Expect(t, store.Set("", nil)).To(testutils.MatchError(nvmkv.ErrInvalidKey))
+			Expect(t, store.Set(string(make([]byte, 255)), nil)).To(testutils.MatchError(nvmkv.ErrInvalidKey))
+			Expect(t, store.Set("a", make([]byte, 256))).To(testutils.MatchError(nvmkv.ErrValueTooLong))
+		})
+
+		o.Spec("ignores a corrupt record at the end of the log", func(t *testing.T, ctx *testContext, store *nvmkv.Store) {
+			Expect(t, store.Set("good", []byte{1})).To(Not(HaveOccurred()))
+			Expect(t, store.Set("bad", []byte{2})).To(Not(HaveOccurred()))
+
+			ctx.fake.Update(func(d *fake.Device) {
+				// flip a bit in the value of the last record
+				index := 3 + (3 + 4 + 1 + 2) + 3 + 3
+				d.Sys.NVM[index] ^= 0x01
+			})
+
+			reopened, err := nvmkv.Open(ctx.config)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, reopened.Keys()).To(Equal([]string{"good"}))
+
+			Expect(t, reopened.Set("other", []byte{3})).To(Not(HaveOccurred()))
+			reopened, err = nvmkv.Open(ctx.config)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, reopened.Keys()).To(Equal([]string{"good", "other"}))
+		})
+
+		o.Group("refuses regions too small to hold a store", func() {
+			expected := map[uint16]error{
+				0: nil, // the remainder of user NVM
+				1: nvmkv.ErrFull,
+				2: nvmkv.ErrFull,
+				3: nvmkv.ErrFull,
+			}
+			for length, expectedErr := range expected {
+				length, expectedErr := length, expectedErr
+				o.Spec(fmt.Sprintf("length %d", length), func(t *testing.T, ctx *testContext, store *nvmkv.Store) {
+					cfg := ctx.config
+					cfg.Length = length
+
+					_, err := nvmkv.Open(cfg)
+					if expectedErr == nil {
+						Expect(t, err).To(Not(HaveOccurred()))
+					} else {
+						Expect(t, err).To(testutils.MatchError(expectedErr))
+					}
+
+					_, err = nvmkv.Format(cfg)
+					if expectedErr == nil {
+						Expect(t, err).To(Not(HaveOccurred()))
+					} else {
+						Expect(t, err).To(testutils.MatchError(expectedErr))
+					}
+				})
+			}
+		})
+
+		o.Spec("can occupy a smaller region", func(t *testing.T, ctx *testContext, store *nvmkv.Store) {
+			cfg := ctx.config
+			cfg.Start = rn2483.UserNVMStart + 0x80
+			cfg.Length = 0x20
+
+			small, err := nvmkv.Format(cfg)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, small.Set("id", []byte{7})).To(Not(HaveOccurred()))
+			Expect(t, small.Set("big", make([]byte, 0x20))).To(testutils.MatchError(nvmkv.ErrFull))
+
+			// the rest of user NVM is untouched
+			Expect(t, store.Keys()).To(HaveLen(0))
+			reopened, err := nvmkv.Open(ctx.config)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, reopened.Keys()).To(HaveLen(0))
+		})
+	})
+}
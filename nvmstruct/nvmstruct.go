@@ -0,0 +1,185 @@
+// Package nvmstruct persists fixed-size Go structs in a device's user NVM.
+//
+// Values are encoded with encoding/binary (big-endian) and framed as:
+//
+//	[magic (2 bytes)][schema version][payload length (2 bytes)][payload][CRC-16 (2 bytes)]
+//
+// with all multi-byte fields big-endian and the CRC-16 covering everything before it. When the schema version stored
+// in NVM is older than the current version, migrations are applied to the payload in turn until it is current.
+package nvmstruct
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/go-logr/logr"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/internal/crc16"
+)
+
+const (
+	headerLength = 5
+	crcLength    = 2
+)
+
+var (
+	// ErrNotFound is returned when loading from NVM that does not contain a value with the expected magic number
+	ErrNotFound = errors.New("no value found in NVM")
+	// ErrChecksum is returned when a value's checksum does not match its contents
+	ErrChecksum = errors.New("checksum mismatch")
+	// ErrUnsupportedVersion is returned when a value's schema version is newer than the current version
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+	// ErrNoMigration is returned when a value's schema version is older than the current version and there is no
+	// migration to bring it up to date
+	ErrNoMigration = errors.New("no migration for schema version")
+	// ErrTooLarge is returned when a value does not fit in the configured region
+	ErrTooLarge = errors.New("value too large")
+	// ErrUnsupportedType is returned for values that encoding/binary cannot encode with a fixed size
+	ErrUnsupportedType = errors.New("type is not fixed size")
+)
+
+// Migration converts a payload encoded with one schema version into the encoding of the next version
+type Migration func(payload []byte) ([]byte, error)
+
+// Config configures a Slot
+type Config struct {
+	Logger logr.Logger
+	// NVM is the memory the value is kept in, typically a *rn2483.Device
+	NVM rn2483.NVM
+	// Start is the address the value is stored at, defaulting to rn2483.UserNVMStart
+	Start uint16
+	// Length is the size of the region available to the value, defaulting to the remainder of user NVM after Start
+	Length uint16
+	// Magic identifies the kind of value stored, so that unrelated data is not mistaken for it
+	Magic uint16
+	// Version is the current schema version
+	Version uint8
+	// Migrations maps a schema version to the migration that converts payloads of that version to the next version
+	Migrations map[uint8]Migration
+}
+
+// Slot is a region of NVM holding a single framed value
+type Slot struct {
+	logger     logr.Logger
+	nvm        rn2483.NVM
+	start      uint16
+	length     uint16
+	magic      uint16
+	version    uint8
+	migrations map[uint8]Migration
+}
+
+// New creates a new Slot
+func New(cfg Config) *Slot {
+	logger := logr.Discard()
+	if cfg.Logger != nil {
+		logger = cfg.Logger
+	}
+	if cfg.Start == 0 {
+		cfg.Start = rn2483.UserNVMStart
+	}
+	if cfg.Length == 0 {
+		cfg.Length = (rn2483.UserNVMEnd + 1) - cfg.Start
+	}
+
+	return &Slot{
+		logger:     logger,
+		nvm:        cfg.NVM,
+		start:      cfg.Start,
+		length:     cfg.Length,
+		magic:      cfg.Magic,
+		version:    cfg.Version,
+		migrations: cfg.Migrations,
+	}
+}
+
+// Save encodes v, which must be a fixed-size value or pointer to one, and writes it to NVM, only writing the bytes
+// that have changed
+func (s *Slot) Save(v interface{}) error {
+	size := binary.Size(v)
+	if size < 0 {
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+	if headerLength+size+crcLength > int(s.length) {
+		return fmt.Errorf("%w: %d bytes encoded, %d available", ErrTooLarge, headerLength+size+crcLength, s.length)
+	}
+
+	var buffer bytes.Buffer
+	buffer.Grow(headerLength + size + crcLength)
+	_ = binary.Write(&buffer, binary.BigEndian, s.magic)
+	buffer.WriteByte(s.version)
+	_ = binary.Write(&buffer, binary.BigEndian, uint16(size))
+	if err := binary.Write(&buffer, binary.BigEndian, v); err != nil {
+		return fmt.Errorf("error encoding value: %w", err)
+	}
+	_ = binary.Write(&buffer, binary.BigEndian, crc16.Checksum(buffer.Bytes()))
+
+	stats, err := rn2483.UpdateNVM(s.nvm, s.start, buffer.Bytes())
+	if err != nil {
+		return fmt.Errorf("error writing value: %w", err)
+	}
+	s.logger.V(1).Info("saved value", "written", stats.Written, "skipped", stats.Skipped)
+
+	return nil
+}
+
+// Load reads a value from NVM into v, which must be a pointer to a fixed-size value, migrating it from older schema
+// versions as required. A migrated value is not written back to NVM until it is saved.
+func (s *Slot) Load(v interface{}) error {
+	size := binary.Size(v)
+	if size < 0 {
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+
+	header, err := rn2483.ReadNVM(s.nvm, s.start, headerLength)
+	if err != nil {
+		return fmt.Errorf("error reading value header: %w", err)
+	}
+
+	magic := binary.BigEndian.Uint16(header[0:2])
+	version := header[2]
+	length := binary.BigEndian.Uint16(header[3:5])
+	if magic != s.magic {
+		return fmt.Errorf("%w: magic number 0x%04X does not match 0x%04X", ErrNotFound, magic, s.magic)
+	}
+	if headerLength+int(length)+crcLength > int(s.length) {
+		return fmt.Errorf("%w: stored length %d exceeds region", ErrChecksum, length)
+	}
+
+	rest, err := rn2483.ReadNVM(s.nvm, s.start+headerLength, length+crcLength)
+	if err != nil {
+		return fmt.Errorf("error reading value: %w", err)
+	}
+	payload := rest[:length]
+	checksum := binary.BigEndian.Uint16(rest[length:])
+	if crc16.Update(crc16.Checksum(header), payload) != checksum {
+		return ErrChecksum
+	}
+
+	if version > s.version {
+		return fmt.Errorf("%w: %d is newer than %d", ErrUnsupportedVersion, version, s.version)
+	}
+	for ; version < s.version; version++ {
+		migration, ok := s.migrations[version]
+		if !ok {
+			return fmt.Errorf("%w: %d", ErrNoMigration, version)
+		}
+
+		s.logger.V(1).Info("migrating value", "from", version, "to", version+1)
+		if payload, err = migration(payload); err != nil {
+			return fmt.Errorf("error migrating value from schema version %d: %w", version, err)
+		}
+	}
+
+	if len(payload) != size {
+		return fmt.Errorf("error decoding value: payload of %d bytes does not match %T of %d bytes", len(payload), v, size)
+	}
+	if err := binary.Read(bytes.NewReader(payload), binary.BigEndian, v); err != nil {
+		return fmt.Errorf("error decoding value: %w", err)
+	}
+
+	return nil
+}
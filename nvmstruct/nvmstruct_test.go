@@ -0,0 +1,144 @@
+package nvmstruct_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/nvmstruct"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+const magic = 0x4E44
+
+type settingsV1 struct {
+	NodeID uint32
+	Power  int8
+}
+
+type settingsV2 struct {
+	NodeID          uint32
+	Power           int8
+	SpreadingFactor uint8
+}
+
+type testContext struct {
+	fake   *fake.Device
+	config nvmstruct.Config
+}
+
+func TestSlot(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		logger := testutils.CreateTestLogger(t)
+
+		f, d := fake.NewFakeDevice(fake.Config{
+			Logger: logger.WithName("fake-device"),
+		})
+		t.Cleanup(func() {
+			if err := d.Close(); err != nil {
+				logger.Error(err, "error cleaning up fake device")
+			}
+		})
+
+		return t, &testContext{
+			fake: f,
+			config: nvmstruct.Config{
+				Logger:  logger.WithName("slot"),
+				NVM:     d,
+				Magic:   magic,
+				Version: 1,
+			},
+		}
+	})
+
+	o.Spec("values can be saved and loaded", func(t *testing.T, ctx *testContext) {
+		slot := nvmstruct.New(ctx.config)
+		Expect(t, slot.Save(settingsV1{NodeID: 0xCAFE, Power: -3})).To(Not(HaveOccurred()))
+
+		var loaded settingsV1
+		Expect(t, slot.Load(&loaded)).To(Not(HaveOccurred()))
+		Expect(t, loaded).To(Equal(settingsV1{NodeID: 0xCAFE, Power: -3}))
+	})
+
+	o.Spec("erased NVM contains no value", func(t *testing.T, ctx *testContext) {
+		var loaded settingsV1
+		err := nvmstruct.New(ctx.config).Load(&loaded)
+		Expect(t, err).To(testutils.MatchError(nvmstruct.ErrNotFound))
+	})
+
+	o.Spec("detects corruption", func(t *testing.T, ctx *testContext) {
+		slot := nvmstruct.New(ctx.config)
+		Expect(t, slot.Save(settingsV1{NodeID: 1})).To(Not(HaveOccurred()))
+		ctx.fake.Update(func(d *fake.Device) {
+			d.Sys.NVM[6] ^= 0x80
+		})
+
+		var loaded settingsV1
+		Expect(t, slot.Load(&loaded)).To(testutils.MatchError(nvmstruct.ErrChecksum))
+	})
+
+	o.Spec("migrates older schema versions", func(t *testing.T, ctx *testContext) {
+		Expect(t, nvmstruct.New(ctx.config).Save(settingsV1{NodeID: 42, Power: 14})).To(Not(HaveOccurred()))
+
+		cfg := ctx.config
+		cfg.Version = 2
+		cfg.Migrations = map[uint8]nvmstruct.Migration{
+			1: func(payload []byte) ([]byte, error) {
+				return append(payload, 7), nil
+			},
+		}
+		slot := nvmstruct.New(cfg)
+
+		var loaded settingsV2
+		Expect(t, slot.Load(&loaded)).To(Not(HaveOccurred()))
+		Expect(t, loaded).To(Equal(settingsV2{NodeID: 42, Power: 14, SpreadingFactor: 7}))
+	})
+
+	o.Spec("fails without a migration", func(t *testing.T, ctx *testContext) {
+		Expect(t, nvmstruct.New(ctx.config).Save(settingsV1{})).To(Not(HaveOccurred()))
+
+		cfg := ctx.config
+		cfg.Version = 2
+
+		var loaded settingsV2
+		Expect(t, nvmstruct.New(cfg).Load(&loaded)).To(testutils.MatchError(nvmstruct.ErrNoMigration))
+	})
+
+	o.Spec("refuses newer schema versions", func(t *testing.T, ctx *testContext) {
+		cfg := ctx.config
+		cfg.Version = 2
+		Expect(t, nvmstruct.New(cfg).Save(settingsV2{})).To(Not(HaveOccurred()))
+
+		var loaded settingsV1
+		err := nvmstruct.New(ctx.config).Load(&loaded)
+		Expect(t, err).To(testutils.MatchError(nvmstruct.ErrUnsupportedVersion))
+	})
+
+	o.Spec("uses the configured region", func(t *testing.T, ctx *testContext) {
+		cfg := ctx.config
+		cfg.Start = rn2483.UserNVMStart + 0x10
+		cfg.Length = 0x10
+		slot := nvmstruct.New(cfg)
+
+		Expect(t, slot.Save(uint32(0x01020304))).To(Not(HaveOccurred()))
+		Expect(t, slot.Save([16]byte{})).To(testutils.MatchError(nvmstruct.ErrTooLarge))
+
+		ctx.fake.Update(func(d *fake.Device) {
+			Expect(t, d.Sys.NVM[0x10:0x12]).To(Equal([]byte{0x4E, 0x44}))
+			Expect(t, binary.BigEndian.Uint32(d.Sys.NVM[0x15:0x19])).To(Equal(uint32(0x01020304)))
+		})
+	})
+
+	o.Spec("rejects values that are not fixed size", func(t *testing.T, ctx *testContext) {
+		err := nvmstruct.New(ctx.config).Save(struct{ Name string }{"node"})
+		Expect(t, err).To(testutils.MatchError(nvmstruct.ErrUnsupportedType))
+	})
+}
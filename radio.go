@@ -43,6 +43,49 @@ func (d *Device) GetRadioPower() (int, error) {
 	return value, nil
 }
 
+// GetRadioRSSI gets the current received signal strength of the channel, in dBm
+func (d *Device) GetRadioRSSI() (int, error) {
+	if err := d.require(CapabilityRadioRSSI); err != nil {
+		return 0, err
+	}
+
+	return d.getRadioIntParameter("rssi")
+}
+
+// GetRadioPacketRSSI gets the received signal strength of the last packet received, in dBm
+func (d *Device) GetRadioPacketRSSI() (int, error) {
+	if err := d.require(CapabilityPacketRSSI); err != nil {
+		return 0, err
+	}
+
+	return d.getRadioIntParameter("pktrssi")
+}
+
+// GetRadioSNR gets the signal to noise ratio of the last packet received, in dB
+func (d *Device) GetRadioSNR() (int, error) {
+	snr, err := d.getRadioIntParameter("snr")
+	if err != nil {
+		return 0, err
+	}
+
+	d.metrics.SNRMeasured(snr)
+	return snr, nil
+}
+
+func (d *Device) getRadioIntParameter(name string) (int, error) {
+	valueStr, err := d.GetRadioParameter(name)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing radio %s: %w", name, err)
+	}
+
+	return value, nil
+}
+
 var (
 	ErrTransmitTimeout = errors.New("transmission unsuccessful, interrupted by radio WDT")
 )
@@ -54,17 +97,18 @@ func (d *Device) RadioTx(data []byte) error {
 		return err
 	}
 
-	line, err := d.ReadResponse()
+	line, err := d.readDeferredResponse()
 	if err != nil {
 		return fmt.Errorf("error reading transmission result: %w", err)
 	}
 
 	switch line {
 	case "radio_tx_ok":
+		d.metrics.PacketTransmitted(len(data), d.clock.Since(d.lastCommandSent))
 	case "radio_err":
-		return ErrTransmitTimeout
+		return d.responseError(StageDeferred, line, ErrTransmitTimeout)
 	default:
-		return fmt.Errorf("%w: %s", ErrUnknown, line)
+		return d.responseError(StageDeferred, line, fmt.Errorf("%w: %s", ErrUnknown, line))
 	}
 
 	return nil
@@ -84,21 +128,26 @@ func (d *Device) RadioRx(windowSize uint16) ([]byte, error) {
 		return nil, err
 	}
 
-	line, err := d.ReadResponse()
+	line, err := d.readDeferredResponse()
 	if err != nil {
 		return nil, fmt.Errorf("error reading receive result: %w", err)
 	}
 
 	if line == "radio_err" {
-		return nil, ErrReceiveTimeout
+		d.metrics.ReceiveTimedOut()
+		return nil, d.responseError(StageDeferred, line, ErrReceiveTimeout)
 	}
 
 	const radioRxPrefix = "radio_rx"
 	if !strings.HasPrefix(line, radioRxPrefix) {
-		return nil, fmt.Errorf("%w: %s", ErrUnknown, line)
+		return nil, d.responseError(StageDeferred, line, fmt.Errorf("%w: %s", ErrUnknown, line))
 	}
 
-	data := strings.TrimSpace(line[len(radioRxPrefix):])
+	data, err := HexToBytes(PadHexToEvenLength(strings.TrimSpace(line[len(radioRxPrefix):])))
+	if err != nil {
+		return nil, err
+	}
 
-	return HexToBytes(PadHexToEvenLength(data))
+	d.metrics.PacketReceived(len(data))
+	return data, nil
 }
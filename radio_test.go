@@ -2,6 +2,7 @@ package rn2483_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/poy/onpar"
 	. "github.com/poy/onpar/expect"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/omaskery/rn2483"
 	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
 )
 
 func TestRadio(t *testing.T) {
@@ -31,6 +33,14 @@ func TestRadio(t *testing.T) {
 		Expect(t, power).To(Equal(5))
 	})
 
+	o.Spec("can get the SNR of the last packet", func(t *testing.T, ctx *testContext) {
+		ctx.fake.Radio.Parameters["snr"] = "-7"
+
+		snr, err := ctx.device.GetRadioSNR()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, snr).To(Equal(-7))
+	})
+
 	o.Spec("can transmit", func(t *testing.T, ctx *testContext) {
 		testData := []byte("Hello, World!")
 
@@ -61,4 +71,31 @@ func TestRadio(t *testing.T) {
 		Expect(t, err).To(Not(HaveOccurred()))
 		Expect(t, data).To(Equal(testData))
 	})
+	o.Spec("receive times out once the receive window elapses", func(t *testing.T, ctx *testContext) {
+		errChan := make(chan error)
+		go func() {
+			_, err := ctx.device.RadioRx(100)
+			errChan <- err
+		}()
+
+		ctx.clock.BlockUntil(1)
+		ctx.clock.Advance(100 * time.Millisecond)
+
+		Expect(t, <-errChan).To(testutils.MatchError(rn2483.ErrReceiveTimeout))
+	})
+
+	o.Spec("receive window is limited by the radio watchdog timer", func(t *testing.T, ctx *testContext) {
+		ctx.fake.Radio.WatchDogTimer = 50 * time.Millisecond
+
+		errChan := make(chan error)
+		go func() {
+			_, err := ctx.device.RadioRx(1000)
+			errChan <- err
+		}()
+
+		ctx.clock.BlockUntil(1)
+		ctx.clock.Advance(50 * time.Millisecond)
+
+		Expect(t, <-errChan).To(testutils.MatchError(rn2483.ErrReceiveTimeout))
+	})
 }
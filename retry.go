@@ -0,0 +1,164 @@
+package rn2483
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// RetryPolicy describes how commands that fail transiently are retried. Each retry repeats the whole exchange: sending
+// the command, reading its response and checking it.
+type RetryPolicy struct {
+	// MaxAttempts is the most times a command is attempted, including the first, with values below 2 never retrying
+	MaxAttempts int
+	// Backoff returns how long to wait before each retry (numbered from 1), retrying immediately when nil. See
+	// ConstantBackoff and ExponentialBackoff.
+	Backoff func(retry int) time.Duration
+	// Retryable decides whether a failure is worth retrying. By default, failures are retried if IsTransient, except
+	// that timeouts are only retried for commands that are idempotent (see IsIdempotent), as the device may have
+	// carried out a command whose response was late. Retryable is consulted for all commands, so can be used with
+	// Device.WithRetryPolicy to retry the timeouts of other commands where that is safe.
+	Retryable func(err error) bool
+	// OnRetry, when set, is called before waiting to retry a command, allowing retries to be logged or counted
+	OnRetry func(event RetryEvent)
+}
+
+// RetryEvent describes a command about to be retried
+type RetryEvent struct {
+	Command string
+	// Retry is the number of this retry, starting from 1
+	Retry int
+	// Err is the failure that caused the retry
+	Err error
+	// Delay is how long will be waited before retrying
+	Delay time.Duration
+}
+
+// IsTransient determines whether an error is likely to go away if the command is retried: the transceiver being busy,
+// or the device not responding in time
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrTransceiverBusy) || errors.Is(err, ErrResponseTimeout)
+}
+
+// IsIdempotent determines whether a command can safely be repeated, having the same effect whether it is carried out
+// once or more: the get and set commands (such as "radio get pwr" and "radio set pwr 14"). Commands such as
+// "radio tx" and "mac tx" are not, as repeating them transmits again.
+func IsIdempotent(command string) bool {
+	tokens := strings.Fields(command)
+	return len(tokens) >= 2 && (tokens[1] == "get" || tokens[1] == "set")
+}
+
+// ConstantBackoff waits the same time before every retry
+func ConstantBackoff(delay time.Duration) func(retry int) time.Duration {
+	return func(int) time.Duration {
+		return delay
+	}
+}
+
+// ExponentialBackoff doubles the time waited before each retry, starting from initial and never exceeding max
+func ExponentialBackoff(initial, max time.Duration) func(retry int) time.Duration {
+	return func(retry int) time.Duration {
+		delay := initial
+		for i := 1; i < retry && delay < max; i++ {
+			delay *= 2
+		}
+
+		if delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+func (p *RetryPolicy) shouldRetry(command string, attempt int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+
+	if p.Retryable == nil {
+		return IsTransient(err) && (!errors.Is(err, ErrResponseTimeout) || IsIdempotent(command))
+	}
+	return p.Retryable(err)
+}
+
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	if p.Backoff == nil {
+		return 0
+	}
+	return p.Backoff(retry)
+}
+
+// WithRetryPolicy calls f with policy in place of the retry policy configured for the device (see Config.RetryPolicy),
+// so that individual calls can be retried differently. A nil policy disables retrying within f.
+func (d *Device) WithRetryPolicy(policy *RetryPolicy, f func() error) error {
+	previousPolicy := d.retryPolicy
+	d.retryPolicy = policy
+	defer func() {
+		d.retryPolicy = previousPolicy
+	}()
+
+	return f()
+}
+
+// executeWithRetry exchanges the command with the device, checking the response if check is set, and retries the
+// exchange according to the retry policy. Failures are described by a CommandError. Commands are refused if the
+// device's firmware does not satisfy Config.RequiredFirmware.
+func (d *Device) executeWithRetry(command string, check func(line string) error) (string, error) {
+	if err := d.enforceRequiredFirmware(command); err != nil {
+		return "", err
+	}
+
+	d.lastCommand = command
+	d.lastCommandSent = d.clock.Now()
+
+	line, err := d.retry(command, check)
+	d.metrics.CommandExecuted(CommandVerb(command), CommandOutcome(err), d.clock.Since(d.lastCommandSent))
+
+	return line, err
+}
+
+func (d *Device) retry(command string, check func(line string) error) (string, error) {
+	for attempt := 1; ; attempt++ {
+		call := &Call{
+			Command: command,
+			Stage:   StageImmediate,
+			Attempt: attempt,
+		}
+		line, err := d.intercept(call, func(call *Call) (string, error) {
+			line, err := d.exchange(call.Command)
+			if err == nil && check != nil {
+				err = check(line)
+			}
+			return line, err
+		})
+		if err == nil {
+			return line, nil
+		}
+
+		policy := d.retryPolicy
+		if !policy.shouldRetry(command, attempt, err) {
+			return "", d.responseError(StageImmediate, line, err)
+		}
+
+		event := RetryEvent{
+			Command: command,
+			Retry:   attempt,
+			Err:     err,
+			Delay:   policy.delay(attempt),
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(event)
+		}
+		if event.Delay > 0 {
+			d.clock.Sleep(event.Delay)
+		}
+
+		// the response the device failed to send in time may still arrive, and must not be mistaken for the response
+		// to the retried command
+		if errors.Is(err, ErrResponseTimeout) && d.responseTimeout != 0 {
+			if err := d.flush(d.responseTimeout); err != nil {
+				return "", d.responseError(StageImmediate, "", err)
+			}
+		}
+	}
+}
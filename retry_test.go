@@ -0,0 +1,201 @@
+package rn2483_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+// faultyDevice creates a device that misbehaves according to the rules
+func faultyDevice(t *testing.T, cfg rn2483.Config, rules ...fake.FaultRule) (*fake.Device, *rn2483.Device) {
+	logger := testutils.CreateTestLogger(t)
+
+	f := fake.New(fake.Config{
+		Logger: logger.WithName("fake-device"),
+		Faults: fake.InjectFaults(1, rules...),
+	})
+	cfg.Serial = f
+	d := rn2483.New(cfg)
+	t.Cleanup(func() {
+		if err := d.Close(); err != nil {
+			logger.Error(err, "error cleaning up fake device")
+		}
+	})
+
+	return f, d
+}
+
+func TestRetryPolicy(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	busy := func(limit int) fake.FaultRule {
+		return fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio set pwr"),
+			Fault:   fake.Fault{Kind: fake.FaultBusy},
+			Limit:   limit,
+		}
+	}
+
+	type retryContext struct {
+		policy  *rn2483.RetryPolicy
+		retries []rn2483.RetryEvent
+	}
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *retryContext) {
+		ctx := &retryContext{}
+		ctx.policy = &rn2483.RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     rn2483.ConstantBackoff(time.Millisecond),
+			OnRetry: func(event rn2483.RetryEvent) {
+				ctx.retries = append(ctx.retries, event)
+			},
+		}
+		return t, ctx
+	})
+
+	o.Spec("retries while the transceiver is busy", func(t *testing.T, ctx *retryContext) {
+		f, d := faultyDevice(t, rn2483.Config{RetryPolicy: ctx.policy}, busy(2))
+
+		Expect(t, d.SetRadioPower(5)).To(Not(HaveOccurred()))
+		Expect(t, ctx.retries).To(HaveLen(2))
+		Expect(t, ctx.retries[0].Command).To(Equal("radio set pwr 5"))
+		Expect(t, ctx.retries[0].Err).To(testutils.MatchError(rn2483.ErrTransceiverBusy))
+		Expect(t, ctx.retries[1].Retry).To(Equal(2))
+		f.Update(func(f *fake.Device) {
+			Expect(t, f.Radio.Power).To(Equal(5))
+		})
+	})
+
+	o.Spec("gives up after the maximum attempts", func(t *testing.T, ctx *retryContext) {
+		_, d := faultyDevice(t, rn2483.Config{RetryPolicy: ctx.policy}, busy(0))
+
+		Expect(t, d.SetRadioPower(5)).To(testutils.MatchError(rn2483.ErrTransceiverBusy))
+		Expect(t, ctx.retries).To(HaveLen(2))
+	})
+
+	o.Spec("does not retry other failures", func(t *testing.T, ctx *retryContext) {
+		_, d := faultyDevice(t, rn2483.Config{RetryPolicy: ctx.policy}, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio set pwr"),
+			Fault:   fake.Fault{Kind: fake.FaultInvalidParam},
+		})
+
+		Expect(t, d.SetRadioPower(5)).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		Expect(t, ctx.retries).To(HaveLen(0))
+	})
+
+	o.Spec("can choose which failures are retried", func(t *testing.T, ctx *retryContext) {
+		ctx.policy.Retryable = func(err error) bool {
+			return false
+		}
+		_, d := faultyDevice(t, rn2483.Config{RetryPolicy: ctx.policy}, busy(1))
+
+		Expect(t, d.SetRadioPower(5)).To(testutils.MatchError(rn2483.ErrTransceiverBusy))
+		Expect(t, ctx.retries).To(HaveLen(0))
+	})
+
+	o.Spec("retries timeouts without mistaking the late response", func(t *testing.T, ctx *retryContext) {
+		_, d := faultyDevice(t, rn2483.Config{
+			RetryPolicy:     ctx.policy,
+			ResponseTimeout: 50 * time.Millisecond,
+		}, fake.FaultRule{
+			Pattern: regexp.MustCompile("^sys get hweui$"),
+			Fault:   fake.Fault{Kind: fake.FaultDelay, Delay: 75 * time.Millisecond},
+			Limit:   1,
+		})
+
+		hweui, err := d.GetHWEUI()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, hweui).To(Equal("0004A30B001C0530"))
+		Expect(t, ctx.retries).To(HaveLen(1))
+		Expect(t, ctx.retries[0].Err).To(testutils.MatchError(rn2483.ErrResponseTimeout))
+
+		version, err := d.GetVersion()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, version.SKU).To(Equal(rn2483.DeviceRN2483))
+	})
+
+	o.Spec("does not retry timeouts of commands that are not idempotent", func(t *testing.T, ctx *retryContext) {
+		sent := 0
+		_, d := faultyDevice(t, rn2483.Config{
+			RetryPolicy:     ctx.policy,
+			ResponseTimeout: 50 * time.Millisecond,
+			Interceptors: []rn2483.Interceptor{
+				func(call *rn2483.Call, next rn2483.Invoker) (string, error) {
+					if call.Stage == rn2483.StageImmediate && strings.HasPrefix(call.Command, "radio tx") {
+						sent++
+					}
+					return next(call)
+				},
+			},
+		}, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio tx"),
+			Fault:   fake.Fault{Kind: fake.FaultDelay, Delay: 75 * time.Millisecond},
+			Limit:   1,
+		})
+
+		_, err := d.PauseMAC()
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		Expect(t, d.RadioTx([]byte{0x01})).To(testutils.MatchError(rn2483.ErrResponseTimeout))
+		Expect(t, sent).To(Equal(1))
+		Expect(t, ctx.retries).To(HaveLen(0))
+
+		// the transmission went ahead regardless, so its late responses must be discarded
+		Expect(t, d.Flush(100*time.Millisecond)).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("determines which commands are idempotent", func(t *testing.T, ctx *retryContext) {
+		Expect(t, rn2483.IsIdempotent("radio get pwr")).To(BeTrue())
+		Expect(t, rn2483.IsIdempotent("sys set nvm 300 FF")).To(BeTrue())
+		Expect(t, rn2483.IsIdempotent("radio tx 01")).To(BeFalse())
+		Expect(t, rn2483.IsIdempotent("mac tx uncnf 1 01")).To(BeFalse())
+		Expect(t, rn2483.IsIdempotent("sys eraseFW")).To(BeFalse())
+	})
+
+	o.Group("per call", func() {
+		o.Spec("can retry when the device does not", func(t *testing.T, ctx *retryContext) {
+			_, d := faultyDevice(t, rn2483.Config{}, busy(2))
+
+			err := d.WithRetryPolicy(ctx.policy, func() error {
+				return d.SetRadioPower(5)
+			})
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, ctx.retries).To(HaveLen(2))
+		})
+
+		o.Spec("can disable retrying", func(t *testing.T, ctx *retryContext) {
+			_, d := faultyDevice(t, rn2483.Config{RetryPolicy: ctx.policy}, busy(1))
+
+			err := d.WithRetryPolicy(nil, func() error {
+				return d.SetRadioPower(5)
+			})
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrTransceiverBusy))
+			Expect(t, ctx.retries).To(HaveLen(0))
+
+			Expect(t, d.SetRadioPower(5)).To(Not(HaveOccurred()))
+		})
+	})
+
+	o.Spec("exponential backoff doubles up to the maximum", func(t *testing.T, ctx *retryContext) {
+		backoff := rn2483.ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+
+		var delays []time.Duration
+		for retry := 1; retry <= 5; retry++ {
+			delays = append(delays, backoff(retry))
+		}
+		Expect(t, delays).To(Equal([]time.Duration{
+			10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond,
+			50 * time.Millisecond,
+		}))
+	})
+}
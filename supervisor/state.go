@@ -0,0 +1,130 @@
+package supervisor
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/omaskery/rn2483"
+)
+
+// radioParameter is a radio parameter that has been successfully set
+type radioParameter struct {
+	name  string
+	value string
+}
+
+// state is the configuration that has been applied to the device, which is lost if the device resets
+type state struct {
+	mu sync.Mutex
+
+	macPaused bool
+	// radio holds parameters in the order they were last set, as some depend on others (e.g. the modulation mode)
+	radio []radioParameter
+}
+
+// snapshot copies the recorded state, so that it can be restored while further changes are recorded
+func (s *state) snapshot() (bool, []radioParameter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.macPaused, append([]radioParameter(nil), s.radio...)
+}
+
+// observe records the effect of a command, given the device's response to it
+func (s *state) observe(command, response string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := strings.Fields(command)
+	switch {
+	case len(tokens) == 4 && tokens[0] == "radio" && tokens[1] == "set" && response == "ok":
+		s.setRadioParameter(tokens[2], tokens[3])
+	case command == "mac pause":
+		// the device responds with how long it has paused for, or zero if it cannot be paused
+		duration, err := strconv.ParseUint(response, 10, 32)
+		s.macPaused = err == nil && duration > 0
+	case command == "mac resume" && response == "ok":
+		s.macPaused = false
+	case command == "sys reset" || command == "sys factoryRESET":
+		// deliberately resetting the device discards its configuration, so there is nothing to restore
+		if _, err := rn2483.ParseFirmwareVersion(response); err == nil {
+			s.macPaused = false
+			s.radio = nil
+		}
+	}
+}
+
+func (s *state) setRadioParameter(name, value string) {
+	for i, parameter := range s.radio {
+		if parameter.name == name {
+			s.radio = append(s.radio[:i], s.radio[i+1:]...)
+			break
+		}
+	}
+
+	s.radio = append(s.radio, radioParameter{name: name, value: value})
+}
+
+// recorder wraps the device's transport, observing each command and its response to record the configuration applied
+// to the device
+type recorder struct {
+	rn2483.Transport
+	state *state
+
+	mu sync.Mutex
+	// written and read hold partial lines, until the rest of the line is written or read
+	written []byte
+	read    []byte
+	// awaiting is the last command sent, until its response is read
+	awaiting string
+}
+
+// Write implements the io.ReadWriteCloser interface
+func (r *recorder) Write(p []byte) (int, error) {
+	n, err := r.Transport.Write(p)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, line := range splitLines(&r.written, p[:n]) {
+		r.awaiting = line
+	}
+
+	return n, err
+}
+
+// Read implements the io.ReadWriteCloser interface
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.Transport.Read(p)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, line := range splitLines(&r.read, p[:n]) {
+		// only the first line following a command is its response, later lines are deferred results (e.g. radio tx)
+		if r.awaiting != "" {
+			r.state.observe(r.awaiting, line)
+			r.awaiting = ""
+		}
+	}
+
+	return n, err
+}
+
+var _ rn2483.Transport = (*recorder)(nil)
+
+// splitLines appends data to a partial line, returning any lines that are now complete
+func splitLines(partial *[]byte, data []byte) []string {
+	*partial = append(*partial, data...)
+
+	var lines []string
+	for {
+		index := bytes.IndexByte(*partial, '\n')
+		if index < 0 {
+			return lines
+		}
+
+		lines = append(lines, strings.TrimSpace(string((*partial)[:index])))
+		*partial = (*partial)[index+1:]
+	}
+}
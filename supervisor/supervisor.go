@@ -0,0 +1,319 @@
+// Package supervisor keeps a device usable across disconnects (such as a USB serial adapter being unplugged and
+// re-enumerating) and spontaneous resets (such as on brownout). It reopens the serial device when it fails, and
+// restores the MAC pause and radio configuration that had been applied to the device when it loses them.
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jonboulle/clockwork"
+	"go.uber.org/multierr"
+
+	"github.com/omaskery/rn2483"
+)
+
+// DefaultReconnectDelay is the time between reconnection attempts when no delay is configured
+const DefaultReconnectDelay = time.Second
+
+// ErrGaveUp is returned when the device could not be reconnected within the configured number of attempts
+var ErrGaveUp = errors.New("gave up reconnecting to device")
+
+// Dialer opens the serial device the device is connected to
+type Dialer func() (io.ReadWriteCloser, error)
+
+// EventKind identifies what caused an Event
+type EventKind int
+
+const (
+	// EventDisconnected indicates the serial device failed, and is to be reopened
+	EventDisconnected EventKind = iota
+	// EventUnexpectedReset indicates the device reset itself, losing its configuration
+	EventUnexpectedReset
+	// EventReconnectFailed indicates an attempt to reopen and initialise the device failed
+	EventReconnectFailed
+	// EventReconnected indicates the device was reopened and initialised
+	EventReconnected
+	// EventRestored indicates the recorded configuration was reapplied to the device
+	EventRestored
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventDisconnected:
+		return "disconnected"
+	case EventUnexpectedReset:
+		return "unexpected-reset"
+	case EventReconnectFailed:
+		return "reconnect-failed"
+	case EventReconnected:
+		return "reconnected"
+	case EventRestored:
+		return "restored"
+	default:
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+}
+
+// Event describes something that happened to the supervised device
+type Event struct {
+	Kind EventKind
+	Time time.Time
+	// Err is what caused a disconnect, unexpected reset or failed reconnection
+	Err error
+	// Attempt is the number of the reconnection attempt that failed or succeeded
+	Attempt int
+	// Info describes the device once reconnected
+	Info *rn2483.DeviceInfo
+}
+
+// Config configures a Supervisor
+type Config struct {
+	Logger logr.Logger
+	// Dial opens the serial device, and is called again to reopen it after it fails
+	Dial Dialer
+	// Device configures each rn2483.Device created, with Serial replaced by the serial device returned by Dial
+	Device rn2483.Config
+	// Init configures how the device is initialised each time it is opened (see rn2483.Device.Init)
+	Init rn2483.InitOptions
+	// Clock is used for waiting between reconnection attempts, defaulting to the real clock
+	Clock clockwork.Clock
+	// ReconnectDelay is the time between reconnection attempts, defaulting to DefaultReconnectDelay
+	ReconnectDelay time.Duration
+	// MaxReconnectAttempts limits how many times reconnecting is attempted before giving up with ErrGaveUp, with zero
+	// meaning no limit
+	MaxReconnectAttempts int
+	// ReconnectOnTimeout treats response timeouts (see rn2483.Config.ResponseTimeout) as a disconnect, as some serial
+	// devices stop responding rather than failing when unplugged
+	ReconnectOnTimeout bool
+	// OnEvent, if set, is called for each disconnect, unexpected reset, reconnection and restoration
+	OnEvent func(Event)
+}
+
+// Supervisor owns a Device, reconnecting and restoring it as necessary. Like Device, a Supervisor is not safe for
+// concurrent use.
+type Supervisor struct {
+	logger               logr.Logger
+	dial                 Dialer
+	deviceConfig         rn2483.Config
+	initOptions          rn2483.InitOptions
+	clock                clockwork.Clock
+	reconnectDelay       time.Duration
+	maxReconnectAttempts int
+	reconnectOnTimeout   bool
+	onEvent              func(Event)
+
+	state  *state
+	device *rn2483.Device
+	info   *rn2483.DeviceInfo
+}
+
+// New creates a Supervisor, which does not open the device until Connect is called
+func New(cfg Config) *Supervisor {
+	logger := logr.Discard()
+	if cfg.Logger != nil {
+		logger = cfg.Logger
+	}
+
+	clock := cfg.Clock
+	if clock == nil {
+		clock = clockwork.NewRealClock()
+	}
+
+	reconnectDelay := cfg.ReconnectDelay
+	if reconnectDelay == 0 {
+		reconnectDelay = DefaultReconnectDelay
+	}
+
+	return &Supervisor{
+		logger:               logger,
+		dial:                 cfg.Dial,
+		deviceConfig:         cfg.Device,
+		initOptions:          cfg.Init,
+		clock:                clock,
+		reconnectDelay:       reconnectDelay,
+		maxReconnectAttempts: cfg.MaxReconnectAttempts,
+		reconnectOnTimeout:   cfg.ReconnectOnTimeout,
+		onEvent:              cfg.OnEvent,
+		state:                &state{},
+	}
+}
+
+// Connect opens and initialises the device, making a single attempt
+func (s *Supervisor) Connect() (*rn2483.DeviceInfo, error) {
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s.info, nil
+}
+
+// Device returns the current device, which is replaced each time the device is reconnected. It is nil until connected.
+func (s *Supervisor) Device() *rn2483.Device {
+	return s.device
+}
+
+// Info returns the description of the device from when it was last connected
+func (s *Supervisor) Info() *rn2483.DeviceInfo {
+	return s.info
+}
+
+// Do calls f with the device, reconnecting it first if it is not open (e.g. if reconnecting previously gave up). If f
+// fails because the device was disconnected or reset itself, the device is reconnected or its configuration restored
+// before returning f's error, so that the operation can be retried if appropriate.
+func (s *Supervisor) Do(f func(d *rn2483.Device) error) error {
+	if s.device == nil {
+		if err := s.reconnect(); err != nil {
+			return err
+		}
+	}
+
+	err := f(s.device)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, rn2483.ErrUnexpectedReset):
+		s.logger.Info("device reset unexpectedly, restoring configuration", "err", err)
+		s.emit(Event{Kind: EventUnexpectedReset, Err: err})
+		if restoreErr := s.recover(); restoreErr != nil {
+			return multierr.Combine(err, restoreErr)
+		}
+	case s.isDisconnect(err):
+		s.logger.Info("device disconnected, reconnecting", "err", err)
+		s.emit(Event{Kind: EventDisconnected, Err: err})
+		if reconnectErr := s.reconnect(); reconnectErr != nil {
+			return multierr.Combine(err, reconnectErr)
+		}
+	}
+
+	return err
+}
+
+// Close closes the device
+func (s *Supervisor) Close() error {
+	if s.device == nil {
+		return nil
+	}
+
+	err := s.device.Close()
+	s.device = nil
+	return err
+}
+
+// isDisconnect determines whether the error shows the serial device has failed
+func (s *Supervisor) isDisconnect(err error) bool {
+	if s.reconnectOnTimeout && errors.Is(err, rn2483.ErrResponseTimeout) {
+		return true
+	}
+
+	disconnects := []error{
+		io.EOF, io.ErrUnexpectedEOF, io.ErrClosedPipe, os.ErrClosed,
+		syscall.EIO, syscall.ENXIO, syscall.ENODEV, syscall.EBADF,
+	}
+	for _, disconnect := range disconnects {
+		if errors.Is(err, disconnect) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reconnect closes the device, if open, then repeatedly attempts to reopen it before restoring its configuration
+func (s *Supervisor) reconnect() error {
+	if s.device != nil {
+		if err := s.Close(); err != nil {
+			s.logger.V(1).Info("error closing failed device", "err", err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := s.open()
+		if err == nil {
+			s.logger.Info("device reconnected", "attempt", attempt)
+			s.emit(Event{Kind: EventReconnected, Attempt: attempt, Info: s.info})
+			return s.restore()
+		}
+
+		s.logger.Info("error reconnecting to device", "attempt", attempt, "err", err)
+		s.emit(Event{Kind: EventReconnectFailed, Attempt: attempt, Err: err})
+		if s.maxReconnectAttempts > 0 && attempt >= s.maxReconnectAttempts {
+			return fmt.Errorf("%w after %d attempts: %v", ErrGaveUp, attempt, err)
+		}
+
+		s.clock.Sleep(s.reconnectDelay)
+	}
+}
+
+// open dials and initialises the device
+func (s *Supervisor) open() error {
+	serial, err := s.dial()
+	if err != nil {
+		return fmt.Errorf("error opening serial device: %w", err)
+	}
+
+	cfg := s.deviceConfig
+	cfg.Serial = &recorder{
+		Transport: rn2483.AdaptTransport(serial),
+		state:     s.state,
+	}
+
+	device, info, err := rn2483.Open(cfg, s.initOptions)
+	if err != nil {
+		return err
+	}
+
+	s.device = device
+	s.info = info
+	return nil
+}
+
+// recover restores the configuration of a device that has reset itself. The version banner printed by the device may
+// have been read in place of the response to a command, so the response is discarded before anything else is sent.
+func (s *Supervisor) recover() error {
+	flushTimeout := s.initOptions.FlushTimeout
+	if flushTimeout == 0 {
+		flushTimeout = rn2483.DefaultFlushTimeout
+	}
+
+	if err := s.device.Flush(flushTimeout); err != nil {
+		return fmt.Errorf("error discarding input following reset: %w", err)
+	}
+
+	return s.restore()
+}
+
+// restore reapplies the recorded configuration to the device
+func (s *Supervisor) restore() error {
+	paused, radio := s.state.snapshot()
+
+	if paused {
+		if _, err := s.device.PauseMAC(); err != nil {
+			return fmt.Errorf("error restoring MAC pause: %w", err)
+		}
+	}
+
+	for _, parameter := range radio {
+		if err := s.device.SetRadioParameter(parameter.name, parameter.value); err != nil {
+			return fmt.Errorf("error restoring radio parameter %s: %w", parameter.name, err)
+		}
+	}
+
+	s.logger.Info("device configuration restored", "mac-paused", paused, "radio-parameters", len(radio))
+	s.emit(Event{Kind: EventRestored})
+	return nil
+}
+
+func (s *Supervisor) emit(event Event) {
+	if s.onEvent == nil {
+		return
+	}
+
+	event.Time = s.clock.Now()
+	s.onEvent(event)
+}
@@ -0,0 +1,277 @@
+package supervisor_test
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/supervisor"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+type testContext struct {
+	mu     sync.Mutex
+	fakes  []*fake.Device
+	events []supervisor.Event
+	// faults are injected into the first fake device only
+	faults fake.FaultInjector
+	// dialErr, if set, fails every dial after the first
+	dialErr error
+
+	supervisor *supervisor.Supervisor
+}
+
+func (ctx *testContext) dial() (io.ReadWriteCloser, error) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if len(ctx.fakes) > 0 && ctx.dialErr != nil {
+		return nil, ctx.dialErr
+	}
+
+	cfg := fake.Config{}
+	if len(ctx.fakes) == 0 {
+		cfg.Faults = ctx.faults
+	}
+
+	f := fake.New(cfg)
+	ctx.fakes = append(ctx.fakes, f)
+	return f, nil
+}
+
+func (ctx *testContext) latest() *fake.Device {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	return ctx.fakes[len(ctx.fakes)-1]
+}
+
+func (ctx *testContext) kinds() []supervisor.EventKind {
+	var kinds []supervisor.EventKind
+	for _, event := range ctx.events {
+		kinds = append(kinds, event.Kind)
+	}
+	return kinds
+}
+
+// unplug simulates the serial device disappearing
+func (ctx *testContext) unplug(t *testing.T) {
+	Expect(t, ctx.latest().Close()).To(Not(HaveOccurred()))
+}
+
+// configure pauses the MAC and changes some radio parameters, which are lost if the device resets
+func configure(d *rn2483.Device) error {
+	if _, err := d.PauseMAC(); err != nil {
+		return err
+	}
+	if err := d.SetRadioPower(5); err != nil {
+		return err
+	}
+	return d.SetRadioParameter("sf", "sf7")
+}
+
+func expectConfigured(t *testing.T, f *fake.Device) {
+	f.Update(func(f *fake.Device) {
+		Expect(t, f.Mac.IsPaused()).To(BeTrue())
+		Expect(t, f.Radio.Power).To(Equal(5))
+		Expect(t, f.Radio.Parameters["sf"]).To(Equal("sf7"))
+	})
+}
+
+func TestSupervisor(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	prepare := func(t *testing.T, ctx *testContext, options ...func(*supervisor.Config)) {
+		logger := testutils.CreateTestLogger(t)
+
+		cfg := supervisor.Config{
+			Logger: logger.WithName("supervisor"),
+			Dial:   ctx.dial,
+			Init: rn2483.InitOptions{
+				FlushTimeout: 5 * time.Millisecond,
+			},
+			ReconnectDelay: time.Millisecond,
+			OnEvent: func(event supervisor.Event) {
+				ctx.events = append(ctx.events, event)
+			},
+		}
+		for _, option := range options {
+			option(&cfg)
+		}
+
+		ctx.supervisor = supervisor.New(cfg)
+		t.Cleanup(func() {
+			if err := ctx.supervisor.Close(); err != nil {
+				logger.Error(err, "error cleaning up supervisor")
+			}
+		})
+
+		_, err := ctx.supervisor.Connect()
+		Expect(t, err).To(Not(HaveOccurred()))
+	}
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		return t, &testContext{}
+	})
+
+	o.Spec("connects to the device", func(t *testing.T, ctx *testContext) {
+		prepare(t, ctx)
+
+		Expect(t, ctx.supervisor.Info().Firmware.SKU).To(Equal(rn2483.DeviceRN2483))
+		Expect(t, ctx.supervisor.Device()).To(Not(BeNil()))
+		Expect(t, ctx.events).To(HaveLen(0))
+	})
+
+	o.Spec("restores configuration after a disconnect", func(t *testing.T, ctx *testContext) {
+		prepare(t, ctx)
+
+		Expect(t, ctx.supervisor.Do(configure)).To(Not(HaveOccurred()))
+		ctx.unplug(t)
+
+		err := ctx.supervisor.Do(func(d *rn2483.Device) error {
+			_, err := d.GetVDD()
+			return err
+		})
+		Expect(t, err).To(testutils.MatchError(io.ErrClosedPipe))
+		Expect(t, ctx.kinds()).To(Equal([]supervisor.EventKind{
+			supervisor.EventDisconnected, supervisor.EventReconnected, supervisor.EventRestored,
+		}))
+		Expect(t, ctx.events[1].Info.HWEUI).To(Equal("0004A30B001C0530"))
+		Expect(t, ctx.fakes).To(HaveLen(2))
+		expectConfigured(t, ctx.latest())
+
+		Expect(t, ctx.supervisor.Do(func(d *rn2483.Device) error {
+			_, err := d.GetVDD()
+			return err
+		})).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("restores configuration after an unexpected reset", func(t *testing.T, ctx *testContext) {
+		ctx.faults = fake.InjectFaults(1, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio get pwr$"),
+			Fault:   fake.Fault{Kind: fake.FaultResetBanner},
+			Limit:   1,
+		})
+		prepare(t, ctx)
+
+		Expect(t, ctx.supervisor.Do(configure)).To(Not(HaveOccurred()))
+		err := ctx.supervisor.Do(func(d *rn2483.Device) error {
+			_, err := d.GetRadioPower()
+			return err
+		})
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrUnexpectedReset))
+		Expect(t, ctx.kinds()).To(Equal([]supervisor.EventKind{
+			supervisor.EventUnexpectedReset, supervisor.EventRestored,
+		}))
+		Expect(t, ctx.fakes).To(HaveLen(1))
+		expectConfigured(t, ctx.latest())
+	})
+
+	o.Spec("discards the response following the banner of an unexpected reset", func(t *testing.T, ctx *testContext) {
+		ctx.faults = fake.InjectFaults(1, fake.FaultRule{
+			Pattern: regexp.MustCompile("^radio get pwr$"),
+			Fault:   fake.Fault{Kind: fake.FaultResetBeforeCommand},
+			Limit:   1,
+		})
+		prepare(t, ctx, func(cfg *supervisor.Config) {
+			cfg.Device.ResponseTimeout = time.Second
+		})
+
+		Expect(t, ctx.supervisor.Do(configure)).To(Not(HaveOccurred()))
+		err := ctx.supervisor.Do(func(d *rn2483.Device) error {
+			_, err := d.GetRadioPower()
+			return err
+		})
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrUnexpectedReset))
+		Expect(t, ctx.kinds()).To(Equal([]supervisor.EventKind{
+			supervisor.EventUnexpectedReset, supervisor.EventRestored,
+		}))
+
+		// left unread, the response to the command would be mistaken for the response to the next
+		var power int
+		Expect(t, ctx.supervisor.Do(func(d *rn2483.Device) error {
+			var err error
+			power, err = d.GetRadioPower()
+			return err
+		})).To(Not(HaveOccurred()))
+		Expect(t, power).To(Equal(5))
+		expectConfigured(t, ctx.latest())
+	})
+
+	o.Spec("forgets configuration discarded by deliberate resets", func(t *testing.T, ctx *testContext) {
+		prepare(t, ctx)
+
+		Expect(t, ctx.supervisor.Do(func(d *rn2483.Device) error {
+			if err := configure(d); err != nil {
+				return err
+			}
+			_, err := d.Reset()
+			return err
+		})).To(Not(HaveOccurred()))
+		ctx.unplug(t)
+
+		Expect(t, ctx.supervisor.Do(func(d *rn2483.Device) error {
+			return d.SetRadioPower(5)
+		})).To(HaveOccurred())
+		ctx.latest().Update(func(f *fake.Device) {
+			Expect(t, f.Mac.IsPaused()).To(BeFalse())
+			Expect(t, f.Radio.Parameters["sf"]).To(Equal("sf12"))
+		})
+	})
+
+	o.Spec("does not record failed commands", func(t *testing.T, ctx *testContext) {
+		prepare(t, ctx)
+
+		err := ctx.supervisor.Do(func(d *rn2483.Device) error {
+			return d.SetRadioParameter("sf", "sf99")
+		})
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		ctx.unplug(t)
+
+		Expect(t, ctx.supervisor.Do(func(d *rn2483.Device) error {
+			return d.SetRadioPower(5)
+		})).To(HaveOccurred())
+		Expect(t, ctx.kinds()).To(Equal([]supervisor.EventKind{
+			supervisor.EventDisconnected, supervisor.EventReconnected, supervisor.EventRestored,
+		}))
+	})
+
+	o.Spec("gives up after the configured number of attempts", func(t *testing.T, ctx *testContext) {
+		ctx.dialErr = errors.New("no such device")
+		prepare(t, ctx, func(cfg *supervisor.Config) {
+			cfg.MaxReconnectAttempts = 2
+		})
+		ctx.unplug(t)
+
+		err := ctx.supervisor.Do(func(d *rn2483.Device) error {
+			_, err := d.GetVDD()
+			return err
+		})
+		Expect(t, err).To(testutils.MatchError(supervisor.ErrGaveUp))
+		Expect(t, ctx.kinds()).To(Equal([]supervisor.EventKind{
+			supervisor.EventDisconnected, supervisor.EventReconnectFailed, supervisor.EventReconnectFailed,
+		}))
+		Expect(t, ctx.events[2].Attempt).To(Equal(2))
+	})
+
+	o.Spec("leaves other errors alone", func(t *testing.T, ctx *testContext) {
+		prepare(t, ctx)
+
+		err := ctx.supervisor.Do(func(d *rn2483.Device) error {
+			return d.SetRadioParameter("sf", "sf99")
+		})
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		Expect(t, ctx.events).To(HaveLen(0))
+		Expect(t, ctx.fakes).To(HaveLen(1))
+	})
+}
@@ -1,14 +1,64 @@
 package rn2483
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"time"
 )
 
-// Sleep causes the device to sleep for the specified duration
+// Sleep causes the device to sleep for the specified duration, returning once the device has woken
 func (d *Device) Sleep(duration time.Duration) error {
-	return d.ExecuteCommandCheckedStrict("sys sleep %d", duration.Milliseconds())
+	return d.SleepContext(context.Background(), duration)
+}
+
+// SleepContext causes the device to sleep for the specified duration, returning once the device has woken. The device
+// acknowledges the command with "ok" and then reports "ok" again on waking, both are consumed. If the context is done
+// before the device wakes then the device is woken early (see Device.Wake). Should that fail, SleepContext returns the
+// error straight away, and the device's response on waking is left to be read by the next command, as a response that
+// times out is, so should be discarded once the device has woken (see Device.Flush).
+func (d *Device) SleepContext(ctx context.Context, duration time.Duration) error {
+	if err := d.ExecuteCommandCheckedStrict("sys sleep %d", duration.Milliseconds()); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	wakeFailed := make(chan struct{})
+	wakeDone := make(chan struct{})
+	var earlyWakeErr error
+	go func() {
+		defer close(wakeDone)
+		select {
+		case <-ctx.Done():
+			if earlyWakeErr = d.Wake(); earlyWakeErr != nil {
+				close(wakeFailed)
+			}
+		case <-stop:
+		}
+	}()
+
+	line, err := d.readDeferredResponseUntil(wakeFailed)
+	close(stop)
+	// an early wake may still be in progress, it must finish before anything else is sent to the device
+	<-wakeDone
+	if earlyWakeErr != nil {
+		return fmt.Errorf("error waking device early: %w", earlyWakeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading wake response: %w", err)
+	}
+
+	if line != "ok" {
+		return d.responseError(StageDeferred, line, fmt.Errorf("%w: %s", ErrUnknown, line))
+	}
+
+	return nil
+}
+
+// Wake wakes a sleeping device early, by sending the auto-baud sequence (a break followed by 0x55). The serial device
+// must implement BreakSender. Wake may be called from another goroutine while Sleep is waiting for the device to wake.
+func (d *Device) Wake() error {
+	return d.sendAutoBaudSequence()
 }
 
 // GetHWEUI gets the device's preprogrammed EUI node address as a hex string
@@ -114,5 +164,11 @@ func (d *Device) executeCommandReturningFirmwareVersion(format string, a ...inte
 		return nil, err
 	}
 
-	return ParseFirmwareVersion(line)
+	version, err := ParseFirmwareVersion(line)
+	if err != nil {
+		return nil, err
+	}
+	d.firmware = version
+
+	return version, nil
 }
@@ -0,0 +1,49 @@
+package rn2483
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EraseFirmwareConfirmation must be given as EraseFirmwareOptions.Confirmation to confirm that the caller understands
+// that erasing the firmware leaves the device unusable until new firmware is written with the bootloader
+const EraseFirmwareConfirmation = "I understand this erases the device firmware and requires reflashing it"
+
+var (
+	// ErrEraseNotConfirmed is returned when erasing the firmware without the expected confirmation
+	ErrEraseNotConfirmed = errors.New("firmware erase not confirmed")
+	// ErrSKUMismatch is returned when the device is not the SKU the caller expected
+	ErrSKUMismatch = errors.New("device SKU does not match")
+)
+
+// EraseFirmwareOptions must be completed to erase a device's firmware
+type EraseFirmwareOptions struct {
+	// Confirmation must be exactly EraseFirmwareConfirmation
+	Confirmation string
+	// SKU must match the SKU reported by the device, ensuring firmware for the right device is to hand
+	SKU DeviceSKU
+}
+
+// EraseFirmware erases the device's application firmware (sys eraseFW), after which the device runs its bootloader
+// and must be reflashed before it can be used again (see the bootloader package). The erase only proceeds if confirmed
+// and the device reports the expected, known, SKU. The device does not respond to the command.
+func (d *Device) EraseFirmware(opts EraseFirmwareOptions) error {
+	if opts.Confirmation != EraseFirmwareConfirmation {
+		return fmt.Errorf("%w: confirmation must be %q", ErrEraseNotConfirmed, EraseFirmwareConfirmation)
+	}
+
+	fw, err := d.GetVersion()
+	if err != nil {
+		return fmt.Errorf("error getting firmware version: %w", err)
+	}
+	if !fw.IsKnownSKU() || fw.SKU != opts.SKU {
+		return fmt.Errorf("%w: expected %s, device reports %s", ErrSKUMismatch, opts.SKU, fw.SKU)
+	}
+
+	if err := d.Sendf("sys eraseFW"); err != nil {
+		return err
+	}
+	d.firmware = nil
+
+	return nil
+}
@@ -1,5 +1,10 @@
 package rn2483
 
+import (
+	"fmt"
+	"strconv"
+)
+
 // PinName identifies the GPIO pin that may be asserted
 type PinName string
 
@@ -52,3 +57,108 @@ var AllPins = []PinName{
 func (d *Device) SetDigitalGPIO(gpio PinName, value bool) error {
 	return d.ExecuteCommandCheckedStrict("sys set pindig %s %d", string(gpio), encodeBoolean(value))
 }
+
+// PinMode identifies how a GPIO pin is configured
+type PinMode string
+
+const (
+	PinModeDigitalOutput PinMode = "digout"
+	PinModeDigitalInput  PinMode = "digin"
+	PinModeAnalog        PinMode = "ana"
+)
+
+// AnalogPins lists the GPIO pins that can be configured as analog inputs
+var AnalogPins = []PinName{
+	PinGPIO00,
+	PinGPIO01,
+	PinGPIO02,
+	PinGPIO03,
+	PinGPIO05,
+	PinGPIO06,
+	PinGPIO07,
+	PinGPIO08,
+	PinGPIO09,
+	PinGPIO10,
+	PinGPIO11,
+	PinGPIO12,
+	PinGPIO13,
+}
+
+// SupportsAnalog determines whether the pin can be configured as an analog input
+func (p PinName) SupportsAnalog() bool {
+	for _, pin := range AnalogPins {
+		if p == pin {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalogValue is a value read from an analog input by the device's 10-bit ADC
+type AnalogValue uint16
+
+// MaxAnalogValue is the largest value that can be read from an analog input
+const MaxAnalogValue AnalogValue = 1023
+
+// Fraction is the analog value as a fraction of the ADC's full scale, between 0 and 1
+func (v AnalogValue) Fraction() float64 {
+	return float64(v) / float64(MaxAnalogValue)
+}
+
+// SetPinMode configures the specified GPIO pin as a digital output, digital input or analog input
+func (d *Device) SetPinMode(gpio PinName, mode PinMode) error {
+	if mode == PinModeAnalog && !gpio.SupportsAnalog() {
+		return fmt.Errorf("%w: %s does not support analog mode", ErrInvalidParam, gpio)
+	}
+	if err := d.require(CapabilityGPIOInput); err != nil {
+		return err
+	}
+
+	return d.ExecuteCommandCheckedStrict("sys set pinmode %s %s", string(gpio), string(mode))
+}
+
+// GetDigitalGPIO reads the current state of the specified GPIO pin
+func (d *Device) GetDigitalGPIO(gpio PinName) (bool, error) {
+	if err := d.require(CapabilityGPIOInput); err != nil {
+		return false, err
+	}
+
+	line, err := d.ExecuteCommandChecked("sys get pindig %s", string(gpio))
+	if err != nil {
+		return false, err
+	}
+
+	switch line {
+	case "0":
+		return false, nil
+	case "1":
+		return true, nil
+	default:
+		return false, d.responseError(StageImmediate, line, fmt.Errorf("%w: %s", ErrUnknown, line))
+	}
+}
+
+// GetAnalogGPIO reads the value of the specified GPIO pin, which must be configured as an analog input
+func (d *Device) GetAnalogGPIO(gpio PinName) (AnalogValue, error) {
+	if !gpio.SupportsAnalog() {
+		return 0, fmt.Errorf("%w: %s does not support analog mode", ErrInvalidParam, gpio)
+	}
+	if err := d.require(CapabilityGPIOInput); err != nil {
+		return 0, err
+	}
+
+	line, err := d.ExecuteCommandChecked("sys get pinana %s", string(gpio))
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := strconv.ParseUint(line, 10, 16)
+	if err != nil {
+		return 0, d.responseError(StageImmediate, line, fmt.Errorf("error parsing analog value: %w", err))
+	}
+	if AnalogValue(value) > MaxAnalogValue {
+		return 0, d.responseError(StageImmediate, line, fmt.Errorf("analog value out of range: %d", value))
+	}
+
+	return AnalogValue(value), nil
+}
@@ -2,6 +2,7 @@ package rn2483
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 )
 
@@ -17,6 +18,14 @@ var (
 	UserNVMLength = (UserNVMEnd + 1) - UserNVMStart
 )
 
+// NVM is byte addressable non-volatile memory, as provided by Device
+type NVM interface {
+	ReadNVM(address uint16) (byte, error)
+	WriteNVM(address uint16, value byte) error
+}
+
+var _ NVM = (*Device)(nil)
+
 // WriteNVM writes a single byte of data to user NVM
 func (d *Device) WriteNVM(address uint16, value byte) error {
 	return d.ExecuteCommandCheckedStrict("sys set nvm %s %s", UInt16ToHex(address), ByteToHex(value))
@@ -33,7 +42,7 @@ func (d *Device) ReadNVM(address uint16) (byte, error) {
 }
 
 // ReadNVM reads a block of data from user NVM
-func ReadNVM(d *Device, start, amount uint16) ([]byte, error) {
+func ReadNVM(d NVM, start, amount uint16) ([]byte, error) {
 	var buffer bytes.Buffer
 
 	for i := start; i < (start + amount); i++ {
@@ -47,8 +56,8 @@ func ReadNVM(d *Device, start, amount uint16) ([]byte, error) {
 	return buffer.Bytes(), nil
 }
 
-// WriteNVM writes a block of data to user NVM
-func WriteNVM(d *Device, address uint16, data []byte) error {
+// WriteNVM writes a block of data to user NVM, writing every byte regardless of whether it has changed (see UpdateNVM)
+func WriteNVM(d NVM, address uint16, data []byte) error {
 	for i, b := range data {
 		writeAddress := address + uint16(i)
 		if err := d.WriteNVM(writeAddress, b); err != nil {
@@ -58,3 +67,109 @@ func WriteNVM(d *Device, address uint16, data []byte) error {
 
 	return nil
 }
+
+// ErrNVMVerifyFailed is returned when data read back from NVM after writing does not match what was written
+var ErrNVMVerifyFailed = errors.New("NVM verification failed")
+
+// NVMWriteStats reports the work done by UpdateNVM
+type NVMWriteStats struct {
+	// Written is the number of bytes that differed from the stored data and so were written
+	Written int
+	// Skipped is the number of bytes that already held the desired value and so were not written
+	Skipped int
+}
+
+// UpdateNVM writes a block of data to user NVM, only writing the bytes that differ from those already stored, then
+// reads back the written bytes to verify them. Unlike WriteNVM this avoids needless wear on the EEPROM and serial
+// round-trips for unchanged bytes, and when given an NVMCache it avoids reading the existing data from the device.
+func UpdateNVM(d NVM, address uint16, data []byte) (NVMWriteStats, error) {
+	var stats NVMWriteStats
+	var written []uint16
+
+	for i, b := range data {
+		writeAddress := address + uint16(i)
+		existing, err := d.ReadNVM(writeAddress)
+		if err != nil {
+			return stats, fmt.Errorf("error reading NVM at %s: %w", UInt16ToHex(writeAddress), err)
+		}
+		if existing == b {
+			stats.Skipped++
+			continue
+		}
+
+		if err := d.WriteNVM(writeAddress, b); err != nil {
+			return stats, fmt.Errorf("error writing NVM at %s: %w", UInt16ToHex(writeAddress), err)
+		}
+		stats.Written++
+		written = append(written, writeAddress)
+	}
+
+	device := d
+	if cache, ok := d.(*NVMCache); ok {
+		device = cache.nvm
+	}
+	for _, verifyAddress := range written {
+		expected := data[verifyAddress-address]
+		actual, err := device.ReadNVM(verifyAddress)
+		if err != nil {
+			return stats, fmt.Errorf("error verifying NVM at %s: %w", UInt16ToHex(verifyAddress), err)
+		}
+		if actual != expected {
+			if cache, ok := d.(*NVMCache); ok {
+				cache.Invalidate()
+			}
+			return stats, fmt.Errorf("%w: at %s read %s, expected %s", ErrNVMVerifyFailed, UInt16ToHex(verifyAddress),
+				ByteToHex(actual), ByteToHex(expected))
+		}
+	}
+
+	return stats, nil
+}
+
+// NVMCache wraps NVM, remembering every byte read or written so that each is only read from the device once. The
+// underlying NVM must not be modified by anything else while the cache is in use, or the cache must be invalidated.
+type NVMCache struct {
+	nvm   NVM
+	known map[uint16]byte
+}
+
+var _ NVM = (*NVMCache)(nil)
+
+// NewNVMCache creates a new, empty, NVMCache
+func NewNVMCache(nvm NVM) *NVMCache {
+	return &NVMCache{
+		nvm:   nvm,
+		known: map[uint16]byte{},
+	}
+}
+
+// ReadNVM reads a single byte from the cache, reading it from the underlying NVM if it is not yet known
+func (c *NVMCache) ReadNVM(address uint16) (byte, error) {
+	if value, ok := c.known[address]; ok {
+		return value, nil
+	}
+
+	value, err := c.nvm.ReadNVM(address)
+	if err != nil {
+		return 0, err
+	}
+	c.known[address] = value
+
+	return value, nil
+}
+
+// WriteNVM writes a single byte through to the underlying NVM, updating the cache
+func (c *NVMCache) WriteNVM(address uint16, value byte) error {
+	delete(c.known, address)
+	if err := c.nvm.WriteNVM(address, value); err != nil {
+		return err
+	}
+	c.known[address] = value
+
+	return nil
+}
+
+// Invalidate forgets all cached data, so that it will be read from the underlying NVM again
+func (c *NVMCache) Invalidate() {
+	c.known = map[uint16]byte{}
+}
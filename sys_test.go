@@ -1,12 +1,15 @@
 package rn2483_test
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/go-logr/stdr"
+	"github.com/jonboulle/clockwork"
 	"github.com/poy/onpar"
 	. "github.com/poy/onpar/expect"
 	. "github.com/poy/onpar/matchers"
@@ -18,24 +21,44 @@ import (
 
 type testContext struct {
 	logger logr.Logger
+	clock  clockwork.FakeClock
 	fake   *fake.Device
 	device *rn2483.Device
 }
 
-func prepareTestContext(t *testing.T) *testContext {
+// slowBreaks delays sending breaks until released, signalling when a break is waiting to be sent
+type slowBreaks struct {
+	io.ReadWriteCloser
+	waiting chan struct{}
+	release chan struct{}
+}
+
+func (s *slowBreaks) SendBreak(duration time.Duration) error {
+	s.waiting <- struct{}{}
+	<-s.release
+	return rn2483.AdaptTransport(s.ReadWriteCloser).SendBreak(duration)
+}
+
+func prepareTestContext(t *testing.T, options ...func(cfg *rn2483.Config)) *testContext {
 	logger := testutils.CreateTestLogger(t)
 	stdr.SetVerbosity(100)
+	clock := clockwork.NewFakeClock()
 
 	f := fake.New(fake.Config{
 		Logger: logger.WithName("fake-device"),
+		Clock:  clock,
 	})
-	d := rn2483.New(rn2483.Config{
+	cfg := rn2483.Config{
 		Serial: &rn2483.DebugSerial{
 			Serial:     f,
 			Logger:     logger.WithName("dbg-serial"),
 			AssumeText: true,
 		},
-	})
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+	d := rn2483.New(cfg)
 	t.Cleanup(func() {
 		if err := d.Close(); err != nil {
 			logger.Error(err, "error cleaning up fake device")
@@ -44,6 +67,7 @@ func prepareTestContext(t *testing.T) *testContext {
 
 	return &testContext{
 		logger: logger,
+		clock:  clock,
 		fake:   f,
 		device: d,
 	}
@@ -70,10 +94,122 @@ func TestSys(t *testing.T) {
 	})
 
 	o.Spec("can reset the device", func(t *testing.T, ctx *testContext) {
-		_, err := ctx.device.Reset()
+		_, err := ctx.device.PauseMAC()
 		Expect(t, err).To(Not(HaveOccurred()))
 
-		// TODO: actually assert that the fake has reverted some kind of non-persisted state
+		_, err = ctx.device.Reset()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, ctx.fake.Mac.IsPaused()).To(BeFalse())
+	})
+
+	o.Group("sleep", func() {
+		o.Spec("returns once the device wakes", func(t *testing.T, ctx *testContext) {
+			errChan := make(chan error)
+			go func() {
+				errChan <- ctx.device.Sleep(5 * time.Second)
+			}()
+
+			ctx.clock.BlockUntil(1)
+			select {
+			case <-errChan:
+				t.Fatalf("sleep returned before the device woke")
+			default:
+			}
+
+			ctx.clock.Advance(5 * time.Second)
+			Expect(t, <-errChan).To(Not(HaveOccurred()))
+
+			_, err := ctx.device.GetVersion()
+			Expect(t, err).To(Not(HaveOccurred()))
+		})
+
+		o.Spec("can be woken early", func(t *testing.T, ctx *testContext) {
+			sleepCtx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errChan := make(chan error)
+			go func() {
+				errChan <- ctx.device.SleepContext(sleepCtx, time.Hour)
+			}()
+
+			ctx.clock.BlockUntil(1)
+			cancel()
+			Expect(t, <-errChan).To(Not(HaveOccurred()))
+
+			_, err := ctx.device.GetVersion()
+			Expect(t, err).To(Not(HaveOccurred()))
+		})
+
+		o.Spec("waits for an early wake to finish before returning", func(t *testing.T, ctx *testContext) {
+			breaks := &slowBreaks{
+				waiting: make(chan struct{}),
+				release: make(chan struct{}),
+			}
+			ctx = prepareTestContext(t, func(cfg *rn2483.Config) {
+				breaks.ReadWriteCloser = cfg.Serial
+				cfg.Serial = breaks
+			})
+
+			sleepCtx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errChan := make(chan error)
+			go func() {
+				errChan <- ctx.device.SleepContext(sleepCtx, 5*time.Second)
+			}()
+
+			// the device wakes by itself while the early wake is still in progress
+			ctx.clock.BlockUntil(1)
+			cancel()
+			<-breaks.waiting
+			ctx.clock.Advance(5 * time.Second)
+
+			select {
+			case <-errChan:
+				t.Fatalf("sleep returned before the early wake finished")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			close(breaks.release)
+			Expect(t, <-errChan).To(Not(HaveOccurred()))
+
+			_, err := ctx.device.GetVersion()
+			Expect(t, err).To(Not(HaveOccurred()))
+		})
+
+		o.Spec("returns straight away when the device cannot be woken early", func(t *testing.T, ctx *testContext) {
+			ctx = prepareTestContext(t, func(cfg *rn2483.Config) {
+				// hides the device's ability to send breaks
+				cfg.Serial = struct{ io.ReadWriteCloser }{cfg.Serial}
+			})
+
+			sleepCtx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errChan := make(chan error)
+			go func() {
+				errChan <- ctx.device.SleepContext(sleepCtx, time.Hour)
+			}()
+
+			ctx.clock.BlockUntil(1)
+			cancel()
+			select {
+			case err := <-errChan:
+				Expect(t, err).To(testutils.MatchError(rn2483.ErrBreakUnsupported))
+			case <-time.After(time.Second):
+				t.Fatalf("sleep did not return after failing to wake the device early")
+			}
+
+			// the device's response on waking by itself is discarded
+			ctx.clock.Advance(time.Hour)
+			Expect(t, ctx.device.Flush(50*time.Millisecond)).To(Not(HaveOccurred()))
+			_, err := ctx.device.GetVersion()
+			Expect(t, err).To(Not(HaveOccurred()))
+		})
+
+		o.Spec("rejects durations that are too short", func(t *testing.T, ctx *testContext) {
+			Expect(t, ctx.device.Sleep(time.Millisecond)).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		})
 	})
 
 	o.Spec("can read voltage", func(t *testing.T, ctx *testContext) {
@@ -93,6 +229,63 @@ func TestSys(t *testing.T) {
 		}
 	})
 
+	o.Group("GPIO inputs", func() {
+		o.Spec("can read digital inputs", func(t *testing.T, ctx *testContext) {
+			Expect(t, ctx.device.SetPinMode(rn2483.PinGPIO04, rn2483.PinModeDigitalInput)).To(Not(HaveOccurred()))
+
+			for _, level := range []bool{true, false} {
+				level := level
+				ctx.fake.Update(func(d *fake.Device) {
+					d.Sys.DigitalInputs[rn2483.PinGPIO04] = level
+				})
+
+				value, err := ctx.device.GetDigitalGPIO(rn2483.PinGPIO04)
+				Expect(t, err).To(Not(HaveOccurred()))
+				Expect(t, value).To(Equal(level))
+			}
+		})
+
+		o.Spec("can read back digital outputs", func(t *testing.T, ctx *testContext) {
+			Expect(t, ctx.device.SetDigitalGPIO(rn2483.PinGPIO10, true)).To(Not(HaveOccurred()))
+
+			value, err := ctx.device.GetDigitalGPIO(rn2483.PinGPIO10)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, value).To(BeTrue())
+		})
+
+		o.Spec("can read analog inputs", func(t *testing.T, ctx *testContext) {
+			Expect(t, ctx.device.SetPinMode(rn2483.PinGPIO00, rn2483.PinModeAnalog)).To(Not(HaveOccurred()))
+			ctx.fake.Update(func(d *fake.Device) {
+				d.Sys.AnalogInputs[rn2483.PinGPIO00] = 512
+			})
+
+			value, err := ctx.device.GetAnalogGPIO(rn2483.PinGPIO00)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, value).To(Equal(rn2483.AnalogValue(512)))
+			Expect(t, value.Fraction()).To(And(BeAbove(0.49), BeBelow(0.51)))
+		})
+
+		o.Spec("analog mode is rejected for pins that do not support it", func(t *testing.T, ctx *testContext) {
+			err := ctx.device.SetPinMode(rn2483.PinGPIO04, rn2483.PinModeAnalog)
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+
+			_, err = ctx.device.GetAnalogGPIO(rn2483.PinGPIO14)
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		})
+
+		o.Spec("analog reads are rejected for pins not in analog mode", func(t *testing.T, ctx *testContext) {
+			_, err := ctx.device.GetAnalogGPIO(rn2483.PinGPIO00)
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		})
+
+		o.Spec("digital outputs cannot be set while in input mode", func(t *testing.T, ctx *testContext) {
+			Expect(t, ctx.device.SetPinMode(rn2483.PinGPIO04, rn2483.PinModeDigitalInput)).To(Not(HaveOccurred()))
+
+			err := ctx.device.SetDigitalGPIO(rn2483.PinGPIO04, true)
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidParam))
+		})
+	})
+
 	o.Group("non-volatile memory access", func() {
 		o.Spec("can read NVM", func(t *testing.T, ctx *testContext) {
 			data, err := rn2483.ReadNVM(ctx.device, rn2483.UserNVMStart, rn2483.UserNVMLength)
@@ -116,6 +309,42 @@ func TestSys(t *testing.T) {
 			Expect(t, data).To(Equal(testData))
 		})
 
+		o.Spec("updates only write bytes that differ", func(t *testing.T, ctx *testContext) {
+			Expect(t, rn2483.WriteNVM(ctx.device, rn2483.UserNVMStart, []byte("hello"))).To(Not(HaveOccurred()))
+
+			nvm := &countingNVM{NVM: ctx.device}
+			stats, err := rn2483.UpdateNVM(nvm, rn2483.UserNVMStart, []byte("help!"))
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, stats).To(Equal(rn2483.NVMWriteStats{Written: 2, Skipped: 3}))
+			Expect(t, nvm.writes).To(Equal(2))
+
+			data, err := rn2483.ReadNVM(ctx.device, rn2483.UserNVMStart, 5)
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, data).To(Equal([]byte("help!")))
+		})
+
+		o.Spec("cached updates avoid reading from the device", func(t *testing.T, ctx *testContext) {
+			nvm := &countingNVM{NVM: ctx.device}
+			cache := rn2483.NewNVMCache(nvm)
+
+			stats, err := rn2483.UpdateNVM(cache, rn2483.UserNVMStart, []byte{1, 2, 3})
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, stats).To(Equal(rn2483.NVMWriteStats{Written: 3}))
+
+			reads := nvm.reads
+			stats, err = rn2483.UpdateNVM(cache, rn2483.UserNVMStart, []byte{1, 2, 4})
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, stats).To(Equal(rn2483.NVMWriteStats{Written: 1, Skipped: 2}))
+			// only the written byte is read back, to verify it
+			Expect(t, nvm.reads-reads).To(Equal(1))
+		})
+
+		o.Spec("updates are verified", func(t *testing.T, ctx *testContext) {
+			nvm := &countingNVM{NVM: ctx.device, dropWrites: true}
+			_, err := rn2483.UpdateNVM(rn2483.NewNVMCache(nvm), rn2483.UserNVMStart, []byte{1})
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrNVMVerifyFailed))
+		})
+
 		o.Group("reading & writing out of bounds fails", func() {
 			invalidAddresses := []uint16{
 				0, 0x2FF, 0x400, 0x500,
@@ -133,5 +362,67 @@ func TestSys(t *testing.T) {
 			}
 		})
 	})
+
+	o.Group("firmware erase", func() {
+		// the device does not respond to the erase, so its effect must be polled for
+		bootloaderActive := func(f *fake.Device) func() bool {
+			return func() bool {
+				var active bool
+				f.Update(func(d *fake.Device) {
+					active = d.Bootloader.Active
+				})
+				return active
+			}
+		}
+
+		o.Spec("requires confirmation", func(t *testing.T, ctx *testContext) {
+			err := ctx.device.EraseFirmware(rn2483.EraseFirmwareOptions{
+				Confirmation: "yes",
+				SKU:          rn2483.DeviceRN2483,
+			})
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrEraseNotConfirmed))
+			Expect(t, bootloaderActive(ctx.fake)()).To(BeFalse())
+		})
+
+		o.Spec("requires the device's SKU", func(t *testing.T, ctx *testContext) {
+			err := ctx.device.EraseFirmware(rn2483.EraseFirmwareOptions{
+				Confirmation: rn2483.EraseFirmwareConfirmation,
+				SKU:          rn2483.DeviceRN2903,
+			})
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrSKUMismatch))
+			Expect(t, bootloaderActive(ctx.fake)()).To(BeFalse())
+		})
+
+		o.Spec("starts the bootloader", func(t *testing.T, ctx *testContext) {
+			err := ctx.device.EraseFirmware(rn2483.EraseFirmwareOptions{
+				Confirmation: rn2483.EraseFirmwareConfirmation,
+				SKU:          rn2483.DeviceRN2483,
+			})
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, bootloaderActive(ctx.fake)).To(ViaPolling(BeTrue()))
+		})
+	})
+}
+
+
+// countingNVM counts the accesses made through it, optionally dropping writes to simulate failing EEPROM
+type countingNVM struct {
+	rn2483.NVM
+
+	reads      int
+	writes     int
+	dropWrites bool
+}
+
+func (n *countingNVM) ReadNVM(address uint16) (byte, error) {
+	n.reads++
+	return n.NVM.ReadNVM(address)
 }
 
+func (n *countingNVM) WriteNVM(address uint16, value byte) error {
+	n.writes++
+	if n.dropWrites {
+		return nil
+	}
+	return n.NVM.WriteNVM(address, value)
+}
@@ -29,5 +29,6 @@ func (d *Device) GetVDD() (Voltage, error) {
 		return 0, fmt.Errorf("error parsing voltage: %w", err)
 	}
 
+	d.metrics.VDDMeasured(v)
 	return v, nil
 }
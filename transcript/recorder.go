@@ -0,0 +1,144 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"go.uber.org/multierr"
+
+	"github.com/omaskery/rn2483"
+)
+
+// RecorderConfig configures a Recorder
+type RecorderConfig struct {
+	// Serial is the device being recorded
+	Serial io.ReadWriteCloser
+	// Output is where the transcript is written, one JSON encoded Entry per line
+	Output io.Writer
+	// Clock is used to timestamp entries, defaulting to the real clock
+	Clock clockwork.Clock
+}
+
+// Recorder wraps a serial device and writes a transcript of every line sent to or received from the device. It is a
+// rn2483.Transport, passing control of the connection (flushing, read deadlines, breaks and baud rate changes) through
+// to the device, so that recording does not change how the session behaves.
+type Recorder struct {
+	serial rn2483.Transport
+	clock  clockwork.Clock
+
+	lock    sync.Mutex
+	encoder *json.Encoder
+	pending map[Direction]*bytes.Buffer
+	err     error
+}
+
+// NewRecorder creates a new Recorder
+func NewRecorder(cfg RecorderConfig) *Recorder {
+	if cfg.Clock == nil {
+		cfg.Clock = clockwork.NewRealClock()
+	}
+
+	return &Recorder{
+		serial:  rn2483.AdaptTransport(cfg.Serial),
+		clock:   cfg.Clock,
+		encoder: json.NewEncoder(cfg.Output),
+		pending: map[Direction]*bytes.Buffer{
+			DirectionTx: {},
+			DirectionRx: {},
+		},
+	}
+}
+
+// Err returns the first error encountered writing the transcript, if any
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.err
+}
+
+func (r *Recorder) record(direction Direction, data []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	buffer := r.pending[direction]
+	buffer.Write(data)
+
+	for {
+		index := bytes.IndexByte(buffer.Bytes(), '\n')
+		if index < 0 {
+			break
+		}
+
+		r.writeEntry(direction, buffer.Next(index+1))
+	}
+}
+
+func (r *Recorder) writeEntry(direction Direction, line []byte) {
+	if r.err != nil {
+		return
+	}
+
+	if err := r.encoder.Encode(NewEntry(r.clock.Now(), direction, line)); err != nil {
+		r.err = fmt.Errorf("error writing transcript entry: %w", err)
+	}
+}
+
+var _ rn2483.Transport = (*Recorder)(nil)
+
+// Read implements the io.ReadWriteCloser interface by calling the underlying Serial implementation and recording the
+// read data
+func (r *Recorder) Read(p []byte) (n int, err error) {
+	n, err = r.serial.Read(p)
+	if n > 0 {
+		r.record(DirectionRx, p[:n])
+	}
+	return
+}
+
+// Write implements the io.ReadWriteCloser interface by recording the data and then calling the underlying Serial
+// implementation
+func (r *Recorder) Write(p []byte) (n int, err error) {
+	r.record(DirectionTx, p)
+	return r.serial.Write(p)
+}
+
+// Close implements the io.ReadWriteCloser interface by recording any incomplete lines and then calling the underlying
+// Serial implementation
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	for _, direction := range []Direction{DirectionTx, DirectionRx} {
+		if buffer := r.pending[direction]; buffer.Len() > 0 {
+			r.writeEntry(direction, buffer.Next(buffer.Len()))
+		}
+	}
+	err := r.err
+	r.lock.Unlock()
+
+	return multierr.Combine(err, r.serial.Close())
+}
+
+// Flush implements the rn2483.Flusher interface by calling the underlying Serial implementation
+func (r *Recorder) Flush() error {
+	return r.serial.Flush()
+}
+
+// SetReadDeadline implements the rn2483.ReadDeadliner interface by calling the underlying Serial implementation
+func (r *Recorder) SetReadDeadline(deadline time.Time) error {
+	return r.serial.SetReadDeadline(deadline)
+}
+
+// SendBreak implements the rn2483.BreakSender interface by calling the underlying Serial implementation
+func (r *Recorder) SendBreak(duration time.Duration) error {
+	return r.serial.SendBreak(duration)
+}
+
+// SetBaudRate implements the rn2483.BaudRateSetter interface by calling the underlying Serial implementation
+func (r *Recorder) SetBaudRate(baud uint) error {
+	return r.serial.SetBaudRate(baud)
+}
@@ -0,0 +1,148 @@
+package transcript
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	ErrDivergence = errors.New("data sent diverged from transcript")
+	ErrIncomplete = errors.New("transcript was not fully replayed")
+)
+
+// Replayer plays back a transcript as a serial device: each line written to it must match the next line sent in the
+// transcript, and the lines received in the transcript are made available to read as the replay progresses
+type Replayer struct {
+	lock     sync.Mutex
+	cond     *sync.Cond
+	entries  []Entry
+	next     int
+	written  bytes.Buffer
+	readable bytes.Buffer
+	err      error
+	closed   bool
+}
+
+// NewReplayer creates a new Replayer for the given transcript entries
+func NewReplayer(entries []Entry) *Replayer {
+	r := &Replayer{
+		entries: entries,
+	}
+	r.cond = sync.NewCond(&r.lock)
+
+	r.releaseReceived()
+
+	return r
+}
+
+// releaseReceived makes all received lines up to the next sent line available to read
+func (r *Replayer) releaseReceived() {
+	for r.next < len(r.entries) && r.entries[r.next].Direction == DirectionRx {
+		data, _ := r.entries[r.next].Data()
+		r.readable.Write(data)
+		r.next++
+	}
+	r.cond.Broadcast()
+}
+
+// Verify returns an error if the replay diverged from the transcript, or if any sent lines in the transcript have not
+// yet been replayed
+func (r *Replayer) Verify() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	for i := r.next; i < len(r.entries); i++ {
+		if r.entries[i].Direction == DirectionTx {
+			expected, _ := r.entries[i].Data()
+			return fmt.Errorf("%w: next expected line %q (entry %d)", ErrIncomplete, expected, i)
+		}
+	}
+
+	return nil
+}
+
+var _ io.ReadWriteCloser = (*Replayer)(nil)
+
+// Read implements the io.ReadWriteCloser interface, blocking until received data is available in the transcript. Once
+// the transcript is exhausted, the replay has diverged, or the Replayer is closed then io.EOF is returned.
+func (r *Replayer) Read(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for r.readable.Len() < 1 {
+		if r.closed || r.err != nil || r.next >= len(r.entries) {
+			return 0, io.EOF
+		}
+		r.cond.Wait()
+	}
+
+	return r.readable.Read(p)
+}
+
+// Write implements the io.ReadWriteCloser interface, checking each complete line written against the transcript
+func (r *Replayer) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	r.written.Write(p)
+
+	for {
+		index := bytes.IndexByte(r.written.Bytes(), '\n')
+		if index < 0 {
+			break
+		}
+
+		line := r.written.Next(index + 1)
+		if err := r.matchSent(line); err != nil {
+			r.err = err
+			r.cond.Broadcast()
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (r *Replayer) matchSent(line []byte) error {
+	// data received before this line was sent may not have been read yet, but it has been released already
+	r.releaseReceived()
+
+	if r.next >= len(r.entries) {
+		return fmt.Errorf("%w: sent %q after the end of the transcript", ErrDivergence, line)
+	}
+
+	expected, _ := r.entries[r.next].Data()
+	if !bytes.Equal(line, expected) {
+		return fmt.Errorf("%w: sent %q but expected %q (entry %d)", ErrDivergence, line, expected, r.next)
+	}
+
+	r.next++
+	r.releaseReceived()
+
+	return nil
+}
+
+// Close implements the io.ReadWriteCloser interface
+func (r *Replayer) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.closed = true
+	r.cond.Broadcast()
+
+	return nil
+}
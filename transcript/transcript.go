@@ -0,0 +1,101 @@
+// Package transcript records the traffic flowing to and from a device so that it can later be replayed, allowing a
+// session with real hardware to be captured once and turned into a regression test
+package transcript
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+// Direction indicates whether data was sent to or received from the device
+type Direction string
+
+const (
+	// DirectionTx is data sent to the device (commands)
+	DirectionTx Direction = "tx"
+	// DirectionRx is data received from the device (responses)
+	DirectionRx Direction = "rx"
+)
+
+// Entry is a single line of data sent to or received from the device
+type Entry struct {
+	// Time is when the line was completed
+	Time time.Time `json:"time"`
+	// Direction indicates whether the line was sent to or received from the device
+	Direction Direction `json:"dir"`
+	// Text holds the line, including any line terminator, when it is valid UTF-8
+	Text string `json:"text,omitempty"`
+	// Hex holds the line, including any line terminator, encoded as hex when it is not valid UTF-8
+	Hex string `json:"hex,omitempty"`
+}
+
+// NewEntry creates an Entry, choosing an encoding for the data that will survive being written as JSON
+func NewEntry(t time.Time, direction Direction, data []byte) Entry {
+	e := Entry{
+		Time:      t,
+		Direction: direction,
+	}
+
+	if utf8.Valid(data) {
+		e.Text = string(data)
+	} else {
+		e.Hex = hex.EncodeToString(data)
+	}
+
+	return e
+}
+
+// Data returns the raw data of the line
+func (e *Entry) Data() ([]byte, error) {
+	if e.Hex != "" {
+		return hex.DecodeString(e.Hex)
+	}
+	return []byte(e.Text), nil
+}
+
+// Load reads a transcript, as written by a Recorder, from the reader
+func Load(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) < 1 {
+			continue
+		}
+
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("error parsing transcript line %d: %w", line, err)
+		}
+		if e.Direction != DirectionTx && e.Direction != DirectionRx {
+			return nil, fmt.Errorf("unknown direction on transcript line %d: %s", line, e.Direction)
+		}
+		if _, err := e.Data(); err != nil {
+			return nil, fmt.Errorf("error decoding data on transcript line %d: %w", line, err)
+		}
+
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading transcript: %w", err)
+	}
+
+	return entries, nil
+}
+
+// LoadFile reads a transcript, as written by a Recorder, from the file at the given path
+func LoadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening transcript: %w", err)
+	}
+	defer f.Close()
+
+	return Load(f)
+}
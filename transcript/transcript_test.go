@@ -0,0 +1,154 @@
+package transcript_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
+	"github.com/omaskery/rn2483/transcript"
+)
+
+type testContext struct {
+	logger  logr.Logger
+	entries []transcript.Entry
+}
+
+// session is the sequence of device interactions recorded and replayed by the tests
+func session(d *rn2483.Device) error {
+	if _, err := d.GetVersion(); err != nil {
+		return err
+	}
+	if err := d.SetRadioPower(3); err != nil {
+		return err
+	}
+	if _, err := d.GetRadioPower(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func TestTranscript(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *testContext) {
+		logger := testutils.CreateTestLogger(t)
+
+		var output bytes.Buffer
+		recorder := transcript.NewRecorder(transcript.RecorderConfig{
+			Serial: fake.New(fake.Config{
+				Logger: logger.WithName("fake-device"),
+			}),
+			Output: &output,
+		})
+
+		d := rn2483.New(rn2483.Config{
+			Serial: recorder,
+		})
+		Expect(t, session(d)).To(Not(HaveOccurred()))
+		Expect(t, d.Close()).To(Not(HaveOccurred()))
+
+		entries, err := transcript.Load(&output)
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		return t, &testContext{
+			logger:  logger,
+			entries: entries,
+		}
+	})
+
+	o.Spec("records every command and response", func(t *testing.T, ctx *testContext) {
+		Expect(t, ctx.entries).To(HaveLen(6))
+		Expect(t, ctx.entries[0].Direction).To(Equal(transcript.DirectionTx))
+		Expect(t, ctx.entries[0].Text).To(Equal("sys get ver\r\n"))
+		Expect(t, ctx.entries[1].Direction).To(Equal(transcript.DirectionRx))
+		Expect(t, ctx.entries[1].Text).To(Equal("RN2483 1.0.4 Mar 23 1991 13:37:00\r\n"))
+		Expect(t, ctx.entries[5].Text).To(Equal("3\r\n"))
+	})
+
+	o.Spec("replays a matching session", func(t *testing.T, ctx *testContext) {
+		replayer := transcript.NewReplayer(ctx.entries)
+		d := rn2483.New(rn2483.Config{
+			Serial: replayer,
+		})
+		defer d.Close()
+
+		Expect(t, session(d)).To(Not(HaveOccurred()))
+		Expect(t, replayer.Verify()).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("fails when the commands sent diverge", func(t *testing.T, ctx *testContext) {
+		replayer := transcript.NewReplayer(ctx.entries)
+		d := rn2483.New(rn2483.Config{
+			Serial: replayer,
+		})
+		defer d.Close()
+
+		_, err := d.GetVersion()
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		err = d.SetRadioPower(4)
+		Expect(t, err).To(testutils.MatchError(transcript.ErrDivergence))
+		Expect(t, replayer.Verify()).To(testutils.MatchError(transcript.ErrDivergence))
+	})
+
+	o.Spec("reports an incomplete replay", func(t *testing.T, ctx *testContext) {
+		replayer := transcript.NewReplayer(ctx.entries)
+		d := rn2483.New(rn2483.Config{
+			Serial: replayer,
+		})
+		defer d.Close()
+
+		_, err := d.GetVersion()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, replayer.Verify()).To(testutils.MatchError(transcript.ErrIncomplete))
+	})
+
+	o.Spec("describes incomplete replays of data that is not valid text", func(t *testing.T, ctx *testContext) {
+		replayer := transcript.NewReplayer([]transcript.Entry{
+			transcript.NewEntry(ctx.entries[0].Time, transcript.DirectionTx, []byte{0xFE, 0x80, '\r', '\n'}),
+		})
+
+		err := replayer.Verify()
+		Expect(t, err).To(testutils.MatchError(transcript.ErrIncomplete))
+		Expect(t, err.Error()).To(ContainSubstring(`"\xfe\x80\r\n"`))
+	})
+
+	o.Spec("passes control of the connection through to the device", func(t *testing.T, ctx *testContext) {
+		f := fake.New(fake.Config{
+			Logger: ctx.logger.WithName("fake-device"),
+		})
+		f.Sys.BaudMismatch = true
+
+		var output bytes.Buffer
+		recorder := transcript.NewRecorder(transcript.RecorderConfig{
+			Serial: f,
+			Output: &output,
+		})
+		d := rn2483.New(rn2483.Config{
+			Serial: recorder,
+		})
+		defer d.Close()
+
+		_, err := d.AutoBaud()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, f.Sys.BaudMismatch).To(BeFalse())
+	})
+
+	o.Spec("preserves data that is not valid text", func(t *testing.T, ctx *testContext) {
+		data := []byte{0xFE, 0x80, '\r', '\n'}
+		entry := transcript.NewEntry(ctx.entries[0].Time, transcript.DirectionRx, data)
+		Expect(t, entry.Text).To(Equal(""))
+
+		decoded, err := entry.Data()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, decoded).To(Equal(data))
+	})
+}
@@ -0,0 +1,110 @@
+package rn2483
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrUnsupportedByTransport is returned by transports that cannot perform an operation, such as changing the baud rate
+// of a network connection
+var ErrUnsupportedByTransport = errors.New("not supported by the transport")
+
+// Transport connects a Device to the hardware, such as a serial port, a network connection (see netserial) or a fake
+// device. Alongside reading and writing, a transport provides control of the connection, failing with
+// ErrUnsupportedByTransport where it cannot (or ErrBreakUnsupported, for SendBreak). Any io.ReadWriteCloser can be
+// used as a Transport through AdaptTransport. Transports only carry bytes: the Device frames the data it reads into
+// lines itself, keeping the start of any line that is interrupted by a read deadline.
+type Transport interface {
+	io.ReadWriteCloser
+	Flusher
+	ReadDeadliner
+	BreakSender
+	BaudRateSetter
+}
+
+// Flusher is implemented by transports able to discard data that has been received but not yet read
+type Flusher interface {
+	Flush() error
+}
+
+// ReadDeadliner is implemented by transports able to abandon reads at a deadline, as net.Conn and os.File are. Reads
+// abandoned at the deadline must fail with an error matching os.ErrDeadlineExceeded. Response timeouts (see
+// Config.ResponseTimeout) use read deadlines where available, rather than leaving a read in progress.
+type ReadDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// BaudRateSetter is implemented by transports able to change the baud rate used by the host
+type BaudRateSetter interface {
+	SetBaudRate(baud uint) error
+}
+
+// AdaptTransport provides a Transport for an io.ReadWriteCloser, exposing whichever of Flusher, ReadDeadliner,
+// BreakSender and BaudRateSetter it implements. On Linux, serial ports opened as an *os.File can also be flushed, have
+// their baud rate changed and send breaks.
+func AdaptTransport(rwc io.ReadWriteCloser) Transport {
+	if t, ok := rwc.(Transport); ok {
+		return t
+	}
+
+	if f, ok := rwc.(*os.File); ok {
+		return adaptFile(f)
+	}
+
+	return &adaptedTransport{rwc}
+}
+
+// adaptedTransport exposes the optional interfaces implemented by a io.ReadWriteCloser
+type adaptedTransport struct {
+	io.ReadWriteCloser
+}
+
+func (t *adaptedTransport) Flush() error {
+	flusher, ok := t.ReadWriteCloser.(Flusher)
+	if !ok {
+		return ErrUnsupportedByTransport
+	}
+
+	return flusher.Flush()
+}
+
+func (t *adaptedTransport) SetReadDeadline(deadline time.Time) error {
+	deadliner, ok := t.ReadWriteCloser.(ReadDeadliner)
+	if !ok {
+		return ErrUnsupportedByTransport
+	}
+
+	return deadliner.SetReadDeadline(deadline)
+}
+
+func (t *adaptedTransport) SendBreak(duration time.Duration) error {
+	sender, ok := t.ReadWriteCloser.(BreakSender)
+	if !ok {
+		return ErrBreakUnsupported
+	}
+
+	return sender.SendBreak(duration)
+}
+
+func (t *adaptedTransport) SetBaudRate(baud uint) error {
+	setter, ok := t.ReadWriteCloser.(BaudRateSetter)
+	if !ok {
+		return ErrUnsupportedByTransport
+	}
+
+	return setter.SetBaudRate(baud)
+}
+
+var _ Transport = (*adaptedTransport)(nil)
+
+// ChangeBaudRate changes the baud rate used by the host, then resynchronises the device with it using auto-baud (see
+// Device.AutoBaud). The transport must implement BaudRateSetter and BreakSender.
+func (d *Device) ChangeBaudRate(baud uint) (*FirmwareVersion, error) {
+	if err := d.serial.SetBaudRate(baud); err != nil {
+		return nil, err
+	}
+
+	return d.AutoBaud()
+}
@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+package rn2483
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/omaskery/rn2483/internal/termios"
+)
+
+// fileTransport controls a serial port opened as a file using its terminal attributes. Files that are not terminals,
+// such as pipes, are reported as not supporting these operations.
+type fileTransport struct {
+	*os.File
+}
+
+func adaptFile(f *os.File) Transport {
+	return &fileTransport{f}
+}
+
+func (t *fileTransport) Flush() error {
+	return unsupportedUnlessTerminal(termios.FlushInput(t.File), ErrUnsupportedByTransport)
+}
+
+func (t *fileTransport) SendBreak(duration time.Duration) error {
+	return unsupportedUnlessTerminal(termios.SendBreak(t.File, duration), ErrBreakUnsupported)
+}
+
+func (t *fileTransport) SetBaudRate(baud uint) error {
+	return unsupportedUnlessTerminal(termios.SetBaudRate(t.File, baud), ErrUnsupportedByTransport)
+}
+
+// unsupportedUnlessTerminal replaces the errors returned by terminal operations on files that are not terminals
+func unsupportedUnlessTerminal(err error, unsupported error) error {
+	if errors.Is(err, unix.ENOTTY) || errors.Is(err, unix.EINVAL) {
+		return fmt.Errorf("%w: %v", unsupported, err)
+	}
+
+	return err
+}
+
+var _ Transport = (*fileTransport)(nil)
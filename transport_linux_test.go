@@ -0,0 +1,116 @@
+//go:build linux
+// +build linux
+
+package rn2483_test
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/fake/pty"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+func TestFileTransport(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.BeforeEach(func(t *testing.T) (*testing.T, *os.File) {
+		logger := testutils.CreateTestLogger(t)
+
+		server, err := pty.Serve(pty.Config{
+			Logger: logger.WithName("pty"),
+			Device: fake.New(fake.Config{
+				Logger: logger.WithName("fake-device"),
+				Faults: fake.InjectFaults(1, fake.FaultRule{
+					Pattern: regexp.MustCompile("^sys get vdd$"),
+					Fault:   fake.Fault{Kind: fake.FaultNoResponse},
+					Limit:   1,
+				}),
+			}),
+		})
+		if err != nil {
+			t.Skipf("unable to allocate pseudo-terminal: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := server.Close(); err != nil {
+				logger.Error(err, "error closing pty server")
+			}
+		})
+
+		terminal, err := os.OpenFile(server.Path(), os.O_RDWR|syscall.O_NOCTTY, 0)
+		Expect(t, err).To(Not(HaveOccurred()))
+
+		return t, terminal
+	})
+
+	o.Spec("can flush and set the baud rate of serial ports", func(t *testing.T, terminal *os.File) {
+		transport := rn2483.AdaptTransport(terminal)
+		defer transport.Close()
+
+		Expect(t, transport.Flush()).To(Not(HaveOccurred()))
+		Expect(t, transport.SetBaudRate(115200)).To(Not(HaveOccurred()))
+		Expect(t, transport.SetBaudRate(12345)).To(HaveOccurred())
+	})
+
+	o.Spec("times out responses using read deadlines", func(t *testing.T, terminal *os.File) {
+		d := rn2483.New(rn2483.Config{
+			Serial:          terminal,
+			ResponseTimeout: 100 * time.Millisecond,
+		})
+		defer d.Close()
+
+		_, err := d.GetVDD()
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrResponseTimeout))
+
+		_, err = d.GetHWEUI()
+		Expect(t, err).To(Not(HaveOccurred()))
+	})
+}
+
+func TestFileTransportWithoutTerminal(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.Spec("can open devices connected over sockets", func(t *testing.T) {
+		logger := testutils.CreateTestLogger(t)
+
+		fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+		Expect(t, err).To(Not(HaveOccurred()))
+		host := os.NewFile(uintptr(fds[0]), "host")
+		remote := os.NewFile(uintptr(fds[1]), "remote")
+
+		f := fake.New(fake.Config{
+			Logger: logger.WithName("fake-device"),
+		})
+		go func() {
+			_, _ = io.Copy(f, remote)
+		}()
+		go func() {
+			_, _ = io.Copy(remote, f)
+		}()
+		t.Cleanup(func() {
+			_ = remote.Close()
+			_ = f.Close()
+		})
+
+		d, info, err := rn2483.Open(rn2483.Config{
+			Serial: host,
+		}, rn2483.InitOptions{
+			FlushTimeout: 5 * time.Millisecond,
+		})
+		Expect(t, err).To(Not(HaveOccurred()))
+		defer d.Close()
+		Expect(t, info.HWEUI).To(Equal("0004A30B001C0530"))
+	})
+}
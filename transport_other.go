@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package rn2483
+
+import (
+	"os"
+)
+
+// adaptFile exposes only the read deadlines of files, as controlling serial ports is only implemented for Linux
+func adaptFile(f *os.File) Transport {
+	return &adaptedTransport{f}
+}
@@ -0,0 +1,183 @@
+package rn2483_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+// readTracker is a network connection that records whether a read is in progress
+type readTracker struct {
+	net.Conn
+	reading int32
+}
+
+func (r *readTracker) Read(p []byte) (int, error) {
+	atomic.AddInt32(&r.reading, 1)
+	defer atomic.AddInt32(&r.reading, -1)
+	return r.Conn.Read(p)
+}
+
+// baudRateChanger simulates changing the baud rate of a serial port connected to the fake device, leaving the device
+// out of sync with the host until auto-baud is performed
+type baudRateChanger struct {
+	*fake.Device
+	bauds []uint
+}
+
+func (b *baudRateChanger) SetBaudRate(baud uint) error {
+	b.bauds = append(b.bauds, baud)
+	b.Update(func(f *fake.Device) {
+		f.Sys.BaudMismatch = true
+	})
+	return nil
+}
+
+func TestTransport(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	// connectOverPipe connects the fake device to a network connection, which supports read deadlines
+	connectOverPipe := func(t *testing.T, f *fake.Device) net.Conn {
+		client, server := net.Pipe()
+		go func() {
+			_, _ = io.Copy(f, server)
+		}()
+		go func() {
+			_, _ = io.Copy(server, f)
+		}()
+		t.Cleanup(func() {
+			_ = server.Close()
+			_ = f.Close()
+		})
+
+		return client
+	}
+
+	o.Spec("adapted transports report unsupported operations", func(t *testing.T) {
+		f := fake.New(fake.Config{
+			Logger: testutils.CreateTestLogger(t).WithName("fake-device"),
+		})
+		defer f.Close()
+
+		transport := rn2483.AdaptTransport(struct{ io.ReadWriteCloser }{f})
+		Expect(t, transport.Flush()).To(testutils.MatchError(rn2483.ErrUnsupportedByTransport))
+		Expect(t, transport.SetReadDeadline(time.Now())).To(testutils.MatchError(rn2483.ErrUnsupportedByTransport))
+		Expect(t, transport.SetBaudRate(115200)).To(testutils.MatchError(rn2483.ErrUnsupportedByTransport))
+		Expect(t, transport.SendBreak(time.Millisecond)).To(testutils.MatchError(rn2483.ErrBreakUnsupported))
+	})
+
+	o.Spec("adapted transports expose the operations supported", func(t *testing.T) {
+		f := fake.New(fake.Config{
+			Logger: testutils.CreateTestLogger(t).WithName("fake-device"),
+		})
+		defer f.Close()
+
+		transport := rn2483.AdaptTransport(f)
+		Expect(t, transport.SendBreak(time.Millisecond)).To(Not(HaveOccurred()))
+		Expect(t, transport.Flush()).To(testutils.MatchError(rn2483.ErrUnsupportedByTransport))
+	})
+
+	o.Spec("files that are not terminals report unsupported operations", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		Expect(t, err).To(Not(HaveOccurred()))
+		defer w.Close()
+
+		transport := rn2483.AdaptTransport(r)
+		defer transport.Close()
+
+		Expect(t, transport.Flush()).To(testutils.MatchError(rn2483.ErrUnsupportedByTransport))
+		Expect(t, transport.SetBaudRate(115200)).To(testutils.MatchError(rn2483.ErrUnsupportedByTransport))
+		Expect(t, transport.SendBreak(time.Millisecond)).To(testutils.MatchError(rn2483.ErrBreakUnsupported))
+	})
+
+	o.Spec("response timeouts use read deadlines where supported", func(t *testing.T) {
+		logger := testutils.CreateTestLogger(t)
+		f := fake.New(fake.Config{
+			Logger: logger.WithName("fake-device"),
+			Faults: fake.InjectFaults(1, fake.FaultRule{
+				Pattern: regexp.MustCompile("^sys get vdd$"),
+				Fault:   fake.Fault{Kind: fake.FaultNoResponse},
+				Limit:   1,
+			}),
+		})
+		conn := &readTracker{Conn: connectOverPipe(t, f)}
+
+		d := rn2483.New(rn2483.Config{
+			Serial:          conn,
+			ResponseTimeout: 50 * time.Millisecond,
+		})
+		defer d.Close()
+
+		_, err := d.GetVDD()
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrResponseTimeout))
+		Expect(t, atomic.LoadInt32(&conn.reading)).To(Equal(int32(0)))
+
+		_, err = d.GetHWEUI()
+		Expect(t, err).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("keeps partial lines across read deadlines", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer server.Close()
+
+		d := rn2483.New(rn2483.Config{
+			Serial:          client,
+			ResponseTimeout: 50 * time.Millisecond,
+		})
+		defer d.Close()
+
+		go func() {
+			_, _ = io.WriteString(server, "33")
+		}()
+		_, err := d.ReadResponse()
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrResponseTimeout))
+
+		go func() {
+			_, _ = io.WriteString(server, "01\r\n")
+		}()
+		line, err := d.ReadResponse()
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, line).To(Equal("3301"))
+	})
+
+	o.Spec("can change the baud rate", func(t *testing.T) {
+		logger := testutils.CreateTestLogger(t)
+		changer := &baudRateChanger{
+			Device: fake.New(fake.Config{
+				Logger: logger.WithName("fake-device"),
+			}),
+		}
+
+		d := rn2483.New(rn2483.Config{
+			Serial: changer,
+		})
+		defer d.Close()
+
+		version, err := d.ChangeBaudRate(115200)
+		Expect(t, err).To(Not(HaveOccurred()))
+		Expect(t, version.IsKnownSKU()).To(BeTrue())
+		Expect(t, changer.bauds).To(Equal([]uint{115200}))
+
+		Expect(t, d.SetRadioPower(5)).To(Not(HaveOccurred()))
+	})
+
+	o.Spec("cannot change the baud rate of transports without support", func(t *testing.T) {
+		_, d := faultyDevice(t, rn2483.Config{})
+
+		_, err := d.ChangeBaudRate(115200)
+		Expect(t, err).To(testutils.MatchError(rn2483.ErrUnsupportedByTransport))
+	})
+}
@@ -0,0 +1,200 @@
+package rn2483
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidVersionConstraint is returned when parsing a malformed version constraint
+	ErrInvalidVersionConstraint = errors.New("invalid version constraint")
+	// ErrUnsupportedFirmware is returned when the device's firmware version does not satisfy the required constraint
+	ErrUnsupportedFirmware = errors.New("unsupported firmware version")
+)
+
+// Compare compares the version numbers of two firmware versions, ignoring their SKU and release time, returning -1 if
+// fw is older than other, 1 if it is newer, or 0 if they are the same version
+func (fw *FirmwareVersion) Compare(other *FirmwareVersion) int {
+	return compareVersions(
+		[3]int{fw.Major, fw.Minor, fw.Revision},
+		[3]int{other.Major, other.Minor, other.Revision},
+	)
+}
+
+// Older determines whether fw is an older version than other
+func (fw *FirmwareVersion) Older(other *FirmwareVersion) bool {
+	return fw.Compare(other) < 0
+}
+
+// Newer determines whether fw is a newer version than other
+func (fw *FirmwareVersion) Newer(other *FirmwareVersion) bool {
+	return fw.Compare(other) > 0
+}
+
+// Satisfies determines whether fw satisfies the version constraint
+func (fw *FirmwareVersion) Satisfies(constraint *VersionConstraint) bool {
+	return constraint.Check(fw)
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+type versionClause struct {
+	operator string
+	version  [3]int
+}
+
+func (c versionClause) check(version [3]int) bool {
+	comparison := compareVersions(version, c.version)
+	switch c.operator {
+	case "=", "==":
+		return comparison == 0
+	case "!=":
+		return comparison != 0
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	default:
+		return false
+	}
+}
+
+// VersionConstraint is a set of conditions on a firmware version number, such as ">=1.0.4" or ">=1.0.3, <1.0.5"
+type VersionConstraint struct {
+	raw     string
+	clauses []versionClause
+}
+
+// versionOperators lists the supported comparison operators, longest first so that prefixes are matched correctly
+var versionOperators = []string{">=", "<=", "==", "!=", ">", "<", "="}
+
+// ParseVersionConstraint parses a comma separated list of comparisons, all of which must be satisfied. Each comparison
+// is an operator (=, ==, !=, >, >=, < or <=) followed by a version number, and a version number alone must match
+// exactly. Missing minor or revision numbers are treated as zero.
+func ParseVersionConstraint(s string) (*VersionConstraint, error) {
+	constraint := &VersionConstraint{
+		raw: s,
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		operator := "="
+		for _, candidate := range versionOperators {
+			if strings.HasPrefix(part, candidate) {
+				operator = candidate
+				part = strings.TrimSpace(part[len(candidate):])
+				break
+			}
+		}
+
+		version, err := parseVersionNumber(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidVersionConstraint, s, err)
+		}
+
+		constraint.clauses = append(constraint.clauses, versionClause{
+			operator: operator,
+			version:  version,
+		})
+	}
+
+	return constraint, nil
+}
+
+// MustParseVersionConstraint parses a version constraint, panicking if it is invalid
+func MustParseVersionConstraint(s string) *VersionConstraint {
+	constraint, err := ParseVersionConstraint(s)
+	if err != nil {
+		panic(err)
+	}
+	return constraint
+}
+
+func parseVersionNumber(s string) ([3]int, error) {
+	var version [3]int
+
+	parts := strings.Split(s, ".")
+	if len(parts) > len(version) {
+		return version, fmt.Errorf("too many components in version %q", s)
+	}
+
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return version, fmt.Errorf("invalid version number %q", s)
+		}
+		version[i] = value
+	}
+
+	return version, nil
+}
+
+// Check determines whether the firmware version satisfies every condition of the constraint
+func (c *VersionConstraint) Check(fw *FirmwareVersion) bool {
+	version := [3]int{fw.Major, fw.Minor, fw.Revision}
+	for _, clause := range c.clauses {
+		if !clause.check(version) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the constraint as it was originally parsed
+func (c *VersionConstraint) String() string {
+	return c.raw
+}
+
+// VerifyFirmware queries the device's firmware version and checks it satisfies the constraint configured with
+// Config.RequiredFirmware, if any, returning ErrUnsupportedFirmware if not
+func (d *Device) VerifyFirmware() (*FirmwareVersion, error) {
+	fw, err := d.GetVersion()
+	if err != nil {
+		return nil, fmt.Errorf("error getting firmware version: %w", err)
+	}
+
+	return fw, d.checkRequiredFirmware(fw)
+}
+
+// enforceRequiredFirmware refuses to execute commands while the device's firmware does not satisfy
+// Config.RequiredFirmware, querying the firmware version before the first command if it is not yet known. Commands
+// reporting the firmware version are always executed, so that it can be inspected.
+func (d *Device) enforceRequiredFirmware(command string) error {
+	if d.requiredFirmware == nil || versionCommands[command] {
+		return nil
+	}
+
+	fw, err := d.firmwareVersion()
+	if err != nil {
+		return fmt.Errorf("error getting firmware version: %w", err)
+	}
+
+	return d.checkRequiredFirmware(fw)
+}
+
+// checkRequiredFirmware fails with ErrUnsupportedFirmware if fw does not satisfy Config.RequiredFirmware
+func (d *Device) checkRequiredFirmware(fw *FirmwareVersion) error {
+	if d.requiredFirmware != nil && !fw.Satisfies(d.requiredFirmware) {
+		return fmt.Errorf("%w: %s %s does not satisfy %s", ErrUnsupportedFirmware, fw.SKU, fw.VersionString(),
+			d.requiredFirmware)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package rn2483_test
+
+import (
+	"testing"
+
+	"github.com/poy/onpar"
+	. "github.com/poy/onpar/expect"
+	. "github.com/poy/onpar/matchers"
+
+	"github.com/omaskery/rn2483"
+	"github.com/omaskery/rn2483/fake"
+	"github.com/omaskery/rn2483/testutils"
+)
+
+func TestVersion(t *testing.T) {
+	o := onpar.New()
+	defer o.Run(t)
+
+	o.Spec("versions can be compared", func(t *testing.T) {
+		v101 := parseVersion(t, "RN2483 1.0.1 Dec 15 2015 09:38:09")
+		v104 := parseVersion(t, "RN2483 1.0.4 Oct 12 2017 14:59:25")
+		v104RN2903 := parseVersion(t, "RN2903 1.0.4 Oct 12 2017 14:59:25")
+
+		Expect(t, v101.Compare(v104)).To(Equal(-1))
+		Expect(t, v104.Compare(v101)).To(Equal(1))
+		Expect(t, v104.Compare(v104RN2903)).To(Equal(0))
+		Expect(t, v101.Older(v104)).To(BeTrue())
+		Expect(t, v104.Newer(v101)).To(BeTrue())
+		Expect(t, v104.Newer(v104RN2903)).To(BeFalse())
+	})
+
+	o.Group("constraints", func() {
+		cases := []struct {
+			constraint string
+			version    string
+			expected   bool
+		}{
+			{">=1.0.4", "1.0.4", true},
+			{">=1.0.4", "1.0.3", false},
+			{">1.0.4", "1.0.4", false},
+			{"<1.1", "1.0.9", true},
+			{"<=1.0.3", "1.0.4", false},
+			{"1.0.3", "1.0.3", true},
+			{"==1.0.3", "1.0.4", false},
+			{"!=1.0.3", "1.0.4", true},
+			{">=1.0.3, <1.0.5", "1.0.4", true},
+			{">=1.0.3, <1.0.5", "1.0.5", false},
+			{">= 2", "10.0.0", true},
+		}
+		for _, c := range cases {
+			c := c
+			o.Spec(c.constraint+" with "+c.version, func(t *testing.T) {
+				constraint, err := rn2483.ParseVersionConstraint(c.constraint)
+				Expect(t, err).To(Not(HaveOccurred()))
+				Expect(t, constraint.String()).To(Equal(c.constraint))
+
+				version := parseVersion(t, "RN2483 "+c.version+" Oct 12 2017 14:59:25")
+				Expect(t, version.Satisfies(constraint)).To(Equal(c.expected))
+			})
+		}
+
+		o.Spec("malformed constraints are rejected", func(t *testing.T) {
+			for _, constraint := range []string{"", ">=", "~1.0", ">=1.0.0.1", ">=1.x", ">=1.0.4,"} {
+				_, err := rn2483.ParseVersionConstraint(constraint)
+				Expect(t, err).To(testutils.MatchError(rn2483.ErrInvalidVersionConstraint))
+			}
+		})
+	})
+
+	o.Group("required firmware", func() {
+		o.Spec("satisfied", func(t *testing.T) {
+			ctx := prepareTestContext(t, func(cfg *rn2483.Config) {
+				cfg.RequiredFirmware = rn2483.MustParseVersionConstraint(">=1.0.4")
+			})
+
+			version, err := ctx.device.VerifyFirmware()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, version.VersionString()).To(Equal("1.0.4"))
+		})
+
+		o.Spec("unsatisfied", func(t *testing.T) {
+			ctx := prepareTestContext(t, func(cfg *rn2483.Config) {
+				cfg.RequiredFirmware = rn2483.MustParseVersionConstraint(">=1.0.5")
+			})
+			ctx.fake.Update(func(d *fake.Device) {
+				d.Sys.FirmwareVersion = "RN2483 1.0.3 Mar 14 2017 10:07:43"
+			})
+
+			version, err := ctx.device.VerifyFirmware()
+			Expect(t, err).To(testutils.MatchError(rn2483.ErrUnsupportedFirmware))
+			Expect(t, version.VersionString()).To(Equal("1.0.3"))
+		})
+
+		o.Spec("refuses commands when unsatisfied", func(t *testing.T) {
+			ctx := prepareTestContext(t, func(cfg *rn2483.Config) {
+				cfg.RequiredFirmware = rn2483.MustParseVersionConstraint(">=1.0.5")
+			})
+
+			Expect(t, ctx.device.SetRadioPower(5)).To(testutils.MatchError(rn2483.ErrUnsupportedFirmware))
+			ctx.fake.Update(func(d *fake.Device) {
+				Expect(t, d.Radio.Power).To(Not(Equal(5)))
+			})
+
+			version, err := ctx.device.GetVersion()
+			Expect(t, err).To(Not(HaveOccurred()))
+			Expect(t, version.VersionString()).To(Equal("1.0.4"))
+		})
+
+		o.Spec("executes commands when satisfied", func(t *testing.T) {
+			ctx := prepareTestContext(t, func(cfg *rn2483.Config) {
+				cfg.RequiredFirmware = rn2483.MustParseVersionConstraint(">=1.0.4")
+			})
+
+			Expect(t, ctx.device.SetRadioPower(5)).To(Not(HaveOccurred()))
+		})
+
+		o.Spec("not configured", func(t *testing.T) {
+			ctx := prepareTestContext(t)
+
+			_, err := ctx.device.VerifyFirmware()
+			Expect(t, err).To(Not(HaveOccurred()))
+		})
+	})
+}